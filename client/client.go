@@ -0,0 +1,365 @@
+// Package client is a Go client for the Greenlight API. It covers every endpoint, with typed
+// request and response structs, typed errors for validation, conflict, rate-limit and
+// authentication failures, automatic retries with backoff when the API is rate limiting or
+// unavailable, and iterators over paginated lists.
+//
+// A typical session authenticates and then works with movies:
+//
+//	c, err := client.New("http://localhost:4000")
+//	if err != nil {
+//		return err
+//	}
+//
+//	token, err := c.CreateAuthenticationToken(ctx, client.CredentialsInput{Email: email, Password: password})
+//	if err != nil {
+//		return err
+//	}
+//	c.SetToken(token.Plaintext)
+//
+//	for movie, err := range c.Movies(ctx, client.ListMoviesParams{Genres: []string{"drama"}}) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(movie.Title, movie.Runtime)
+//	}
+//
+// The movie, user and other resource types mirror the JSON the API sends, including its
+// formats, such as runtimes written as "102 mins". The package doesn't depend on the API's
+// own code, so it can be used from any module.
+package client
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Define the default retry settings. A request which is rate limited (429 Too Many
+// Requests) or finds the API unavailable (503 Service Unavailable) is retried up to
+// DefaultMaxRetries times, waiting for the Retry-After header of the response or, without
+// one, for an exponential backoff between DefaultMinBackoff and DefaultMaxBackoff.
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Client is a client for the Greenlight API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	userAgent  string
+	language   string
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu    sync.RWMutex
+	token string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client requests are sent with. The default is a client with
+// a 60 second timeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sets the authentication token sent with every request, as SetToken does.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithLanguage sets the Accept-Language header of every request, which chooses the
+// language of error messages and of each movie's display_title, such as "fr" or "pt-BR, en".
+func WithLanguage(language string) Option {
+	return func(c *Client) {
+		c.language = language
+	}
+}
+
+// WithRetries sets the retry settings: the number of times a rate limited or unavailable
+// request is retried (0 disables retries), and the bounds of the exponential backoff
+// between attempts when the response has no Retry-After header.
+func WithRetries(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// New returns a Client for the API at baseURL, such as "https://api.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: base URL %q must be http or https", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+		userAgent:  "greenlight-go-client",
+		maxRetries: DefaultMaxRetries,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// SetToken sets the authentication token sent with every request from now on, such as the
+// one returned by CreateAuthenticationToken. An empty token sends requests anonymously.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+// request describes a request to the API. The body is held in memory, or given by a
+// reader when it may be too large for that, so that the request can be sent again when it
+// is retried. Bodies given by a reader which isn't an io.Seeker can't be sent again, and
+// such requests aren't retried.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	header      http.Header
+	body        []byte
+	bodyReader  io.Reader
+	contentType string
+}
+
+// newRequest returns a request with the value encoded as its JSON body, or without a body
+// if the value is nil.
+func newRequest(method, path string, body any) (*request, error) {
+	req := &request{method: method, path: path, header: make(http.Header)}
+
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("client: encoding request body: %w", err)
+		}
+		req.body = js
+		req.contentType = "application/json"
+	}
+
+	return req, nil
+}
+
+// idempotentMethods are the methods for which an Idempotency-Key header is added to each
+// request, so that the API replays the original response rather than applying the request
+// twice if it's retried after reaching the handler.
+var idempotentMethods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// do sends the request, retrying it while the API answers 429 Too Many Requests or 503
+// Service Unavailable, and decodes the JSON response body into dst unless it is nil. A
+// response with any other status outside 2xx is returned as an error from newError.
+func (c *Client) do(ctx context.Context, req *request, dst any) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if dst != nil && resp.StatusCode != http.StatusNotModified {
+		err = json.NewDecoder(resp.Body).Decode(dst)
+		if err != nil {
+			return fmt.Errorf("client: decoding response of %s %s: %w", req.method, req.path, err)
+		}
+	}
+
+	return nil
+}
+
+// send sends the request, retrying it as described by do, and returns the response with
+// its body open. Responses outside 2xx (other than 304 Not Modified) are returned as an
+// error, with their body closed.
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	if idempotentMethods[req.method] && req.header.Get("Idempotency-Key") == "" {
+		if key := newIdempotencyKey(); key != "" {
+			req.header.Set("Idempotency-Key", key)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.sendOnce(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+			return resp, nil
+		}
+
+		apiErr := newError(resp)
+		resp.Body.Close()
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if !retryable || attempt >= c.maxRetries || !req.replayable() {
+			return nil, apiErr
+		}
+
+		timer := time.NewTimer(c.backoff(attempt, resp))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendOnce sends the request a single time.
+func (c *Client) sendOnce(ctx context.Context, req *request) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+
+	var body io.Reader
+	switch {
+	case req.body != nil:
+		body = bytes.NewReader(req.body)
+	case req.bodyReader != nil:
+		if seeker, ok := req.bodyReader.(io.Seeker); ok {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("client: rewinding request body: %w", err)
+			}
+		}
+		body = req.bodyReader
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
+
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json, application/problem+json")
+	}
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if c.language != "" {
+		httpReq.Header.Set("Accept-Language", c.language)
+	}
+
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("client: %s %s: %w", req.method, req.path, err)
+	}
+
+	return resp, nil
+}
+
+// replayable reports whether the request's body can be sent again.
+func (req *request) replayable() bool {
+	if req.bodyReader == nil {
+		return true
+	}
+	_, ok := req.bodyReader.(io.Seeker)
+	return ok
+}
+
+// backoff returns how long to wait before retrying a request for the given attempt. The
+// Retry-After header of the response is used if it has one (as a number of seconds or an
+// HTTP date); otherwise the wait doubles with each attempt, from minBackoff up to
+// maxBackoff, with full jitter so that clients rate limited together don't retry together.
+func (c *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	if wait, ok := retryAfter(resp); ok {
+		return min(wait, c.maxBackoff)
+	}
+
+	wait := c.maxBackoff
+	if attempt < 32 {
+		wait = min(c.minBackoff<<attempt, c.maxBackoff)
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	return rand.N(wait) + 1
+}
+
+// retryAfter returns the wait given by the Retry-After header of a response.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// newIdempotencyKey returns a random Idempotency-Key header value.
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		// The key only makes retries safer, so carry on without one rather than fail.
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// errMissingID is returned by the methods which take a resource ID when it isn't positive,
+// rather than sending a request which can only be answered with 404 Not Found.
+var errMissingID = errors.New("client: id must be a positive integer")
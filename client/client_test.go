@@ -0,0 +1,499 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for the test server, which retries quickly.
+func newTestClient(t *testing.T, ts *httptest.Server, opts ...Option) *Client {
+	t.Helper()
+
+	opts = append([]Option{WithRetries(3, time.Millisecond, 10*time.Millisecond)}, opts...)
+
+	c, err := New(ts.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// writeJSON writes a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// flakyServer answers the first failures requests with the given status and Retry-After
+// header, and later ones with a movie, recording the Idempotency-Key of each request.
+type flakyServer struct {
+	status     int
+	retryAfter string
+	failures   int
+
+	mu   sync.Mutex
+	keys []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.keys = append(s.keys, r.Header.Get("Idempotency-Key"))
+	attempt := len(s.keys)
+	s.mu.Unlock()
+
+	if attempt <= s.failures {
+		if s.retryAfter != "" {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(s.status)
+		w.Write([]byte(`{"title": "Unavailable", "status": ` + strconv.Itoa(s.status) + `}`))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{"movie": map[string]any{"id": 1, "title": "Casablanca", "runtime": "102 mins", "version": 1}})
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+	}{
+		{"Rate limited with Retry-After", http.StatusTooManyRequests, "0"},
+		{"Rate limited without Retry-After", http.StatusTooManyRequests, ""},
+		{"Unavailable with Retry-After", http.StatusServiceUnavailable, "0"},
+		{"Unavailable with a Retry-After date", http.StatusServiceUnavailable, time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &flakyServer{status: tt.status, retryAfter: tt.retryAfter, failures: 2}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			movie, err := newTestClient(t, ts).CreateMovie(context.Background(), CreateMovieInput{Title: "Casablanca"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if movie.ID != 1 || movie.Runtime != 102 {
+				t.Errorf("got movie %+v", movie)
+			}
+
+			// Every attempt is the same request, so it carries the same idempotency key.
+			if len(server.keys) != 3 || server.keys[0] == "" || len(slices.Compact(slices.Clone(server.keys))) != 1 {
+				t.Errorf("got idempotency keys %q; want the same key on 3 attempts", server.keys)
+			}
+		})
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	t.Run("Rate limited", func(t *testing.T) {
+		server := &flakyServer{status: http.StatusTooManyRequests, retryAfter: "7", failures: 10}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		// The wait asked for is capped at the maximum backoff.
+		_, err := newTestClient(t, ts).Healthcheck(context.Background())
+
+		var rateLimitErr *RateLimitError
+		if !errors.As(err, &rateLimitErr) {
+			t.Fatalf("got error %v; want a RateLimitError", err)
+		}
+		if rateLimitErr.RetryAfter != 7*time.Second || rateLimitErr.Code != CodeRateLimitExceeded {
+			t.Errorf("got RetryAfter %v and code %q", rateLimitErr.RetryAfter, rateLimitErr.Code)
+		}
+		if len(server.keys) != 4 {
+			t.Errorf("got %d attempts; want 4", len(server.keys))
+		}
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		server := &flakyServer{status: http.StatusServiceUnavailable, failures: 10}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		_, err := newTestClient(t, ts, WithRetries(1, time.Millisecond, time.Millisecond)).Healthcheck(context.Background())
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("got error %v; want a 503 APIError", err)
+		}
+		if len(server.keys) != 2 {
+			t.Errorf("got %d attempts; want 2", len(server.keys))
+		}
+	})
+
+	t.Run("Retries disabled", func(t *testing.T) {
+		server := &flakyServer{status: http.StatusServiceUnavailable, failures: 10}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		_, err := newTestClient(t, ts, WithRetries(0, 0, 0)).Healthcheck(context.Background())
+		if err == nil || len(server.keys) != 1 {
+			t.Errorf("got error %v after %d attempts; want an error after 1", err, len(server.keys))
+		}
+	})
+
+	t.Run("Context canceled while waiting", func(t *testing.T) {
+		server := &flakyServer{status: http.StatusServiceUnavailable, retryAfter: "60", failures: 10}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := newTestClient(t, ts, WithRetries(3, time.Millisecond, time.Hour)).Healthcheck(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v; want context.DeadlineExceeded", err)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{minBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	respWith := func(retryAfter string) *http.Response {
+		resp := &http.Response{Header: make(http.Header)}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+
+	for attempt := range 6 {
+		limit := min(100*time.Millisecond<<attempt, time.Second)
+
+		for range 20 {
+			if wait := c.backoff(attempt, respWith("")); wait <= 0 || wait > limit {
+				t.Fatalf("attempt %d: got wait %v; want (0, %v]", attempt, wait, limit)
+			}
+		}
+	}
+
+	if wait := c.backoff(0, respWith("0")); wait != 0 {
+		t.Errorf("Retry-After 0: got wait %v", wait)
+	}
+	if wait := c.backoff(0, respWith("120")); wait != time.Second {
+		t.Errorf("Retry-After 120: got wait %v; want the maximum of 1s", wait)
+	}
+}
+
+func TestErrorDecoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name:   "Validation problem",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"type": "https://greenlight.tomcat.net/problems/validation_failed", "title": "Validation failed", "status": 422, "code": "validation_failed", "errors": [{"field": "title", "code": "required", "message": "must be provided"}, {"field": "title", "code": "max_length", "message": "too long", "params": {"max": 500}}]}`,
+			check: func(t *testing.T, err error) {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("got %T; want *ValidationError", err)
+				}
+				if got := validationErr.FieldErrors()["title"]; !slices.Equal(got, []string{"must be provided", "too long"}) {
+					t.Errorf("got title errors %q", got)
+				}
+				if validationErr.Errors[1].Params["max"] != float64(500) {
+					t.Errorf("got params %v", validationErr.Errors[1].Params)
+				}
+			},
+		},
+		{
+			name:   "Legacy validation error",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"error": {"year": "must be provided", "title": "must be provided"}}`,
+			check: func(t *testing.T, err error) {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Code != CodeValidationFailed {
+					t.Fatalf("got %v; want a ValidationError", err)
+				}
+				if len(validationErr.Errors) != 2 || validationErr.Errors[0].Field != "title" {
+					t.Errorf("got errors %+v", validationErr.Errors)
+				}
+			},
+		},
+		{
+			name:   "Edit conflict",
+			status: http.StatusConflict,
+			body:   `{"title": "Edit conflict", "status": 409, "code": "edit_conflict", "detail": "unable to update the record"}`,
+			check: func(t *testing.T, err error) {
+				var conflictErr *ConflictError
+				if !errors.As(err, &conflictErr) || conflictErr.Code != CodeEditConflict || conflictErr.Detail != "unable to update the record" {
+					t.Fatalf("got %v; want an edit conflict", err)
+				}
+			},
+		},
+		{
+			name:   "Precondition failed",
+			status: http.StatusPreconditionFailed,
+			body:   `{"code": "precondition_failed"}`,
+			check: func(t *testing.T, err error) {
+				var conflictErr *ConflictError
+				if !errors.As(err, &conflictErr) || conflictErr.Code != CodePreconditionFailed {
+					t.Fatalf("got %v; want a precondition failure", err)
+				}
+			},
+		},
+		{
+			name:   "Bad request",
+			status: http.StatusBadRequest,
+			body:   `{"title": "Bad request", "status": 400, "code": "bad_request", "reason": "body_too_large", "detail": "body must not be larger than 1048576 bytes"}`,
+			check: func(t *testing.T, err error) {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != CodeBadRequest || apiErr.Reason != "body_too_large" {
+					t.Fatalf("got %v; want a bad request for body_too_large", err)
+				}
+			},
+		},
+		{
+			name:   "Authentication required",
+			status: http.StatusUnauthorized,
+			body:   `{"code": "authentication_required"}`,
+			check: func(t *testing.T, err error) {
+				var authErr *AuthError
+				if !errors.As(err, &authErr) || authErr.Code != CodeAuthenticationRequired {
+					t.Fatalf("got %v; want an AuthError", err)
+				}
+			},
+		},
+		{
+			name:   "Legacy not found",
+			status: http.StatusNotFound,
+			body:   `{"error": "the requested resource could not be found"}`,
+			check: func(t *testing.T, err error) {
+				var apiErr *APIError
+				if !IsNotFound(err) || !errors.As(err, &apiErr) || apiErr.Code != CodeNotFound || apiErr.Detail != "the requested resource could not be found" {
+					t.Fatalf("got %v; want a not found error", err)
+				}
+			},
+		},
+		{
+			name:   "Not JSON",
+			status: http.StatusBadGateway,
+			body:   "bad gateway\n",
+			check: func(t *testing.T, err error) {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Detail != "bad gateway" {
+					t.Fatalf("got %v; want a 502 APIError", err)
+				}
+				if got, want := err.Error(), "greenlight: 502: bad gateway"; got != want {
+					t.Errorf("got message %q; want %q", got, want)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			_, err := newTestClient(t, ts).Healthcheck(context.Background())
+			if err == nil {
+				t.Fatal("got no error")
+			}
+
+			tt.check(t, err)
+		})
+	}
+}
+
+// pagedServer serves a list of movies, pageSize at a time, counting the pages requested.
+// If failPage is not zero, that page fails.
+type pagedServer struct {
+	total    int
+	pageSize int
+	failPage int
+
+	mu    sync.Mutex
+	pages []int
+}
+
+func (s *pagedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+	s.mu.Lock()
+	s.pages = append(s.pages, page)
+	s.mu.Unlock()
+
+	if page == s.failPage {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"code": "server_error"}`))
+		return
+	}
+
+	movies := []map[string]any{}
+	for id := (page-1)*s.pageSize + 1; id <= min(page*s.pageSize, s.total); id++ {
+		movies = append(movies, map[string]any{"id": id, "title": "Movie " + strconv.Itoa(id), "version": 1})
+	}
+
+	metadata := map[string]any{}
+	if s.total > 0 {
+		metadata = map[string]any{
+			"current_page":  page,
+			"page_size":     s.pageSize,
+			"first_page":    1,
+			"last_page":     (s.total + s.pageSize - 1) / s.pageSize,
+			"total_records": s.total,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"movies": movies, "metadata": metadata})
+}
+
+func TestMoviesIterator(t *testing.T) {
+	tests := []struct {
+		name      string
+		server    *pagedServer
+		start     int
+		stopAfter int
+		wantIDs   []int64
+		wantPages []int
+		wantErr   bool
+	}{
+		{
+			name:      "Every page",
+			server:    &pagedServer{total: 5, pageSize: 2},
+			wantIDs:   []int64{1, 2, 3, 4, 5},
+			wantPages: []int{1, 2, 3},
+		},
+		{
+			name:      "From a later page",
+			server:    &pagedServer{total: 5, pageSize: 2},
+			start:     2,
+			wantIDs:   []int64{3, 4, 5},
+			wantPages: []int{2, 3},
+		},
+		{
+			name:      "Stopped early",
+			server:    &pagedServer{total: 5, pageSize: 2},
+			stopAfter: 3,
+			wantIDs:   []int64{1, 2, 3},
+			wantPages: []int{1, 2},
+		},
+		{
+			name:      "Empty list",
+			server:    &pagedServer{total: 0, pageSize: 2},
+			wantPages: []int{1},
+		},
+		{
+			name:      "Failing page",
+			server:    &pagedServer{total: 5, pageSize: 2, failPage: 2},
+			wantIDs:   []int64{1, 2},
+			wantPages: []int{1, 2},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.server)
+			defer ts.Close()
+
+			c := newTestClient(t, ts)
+
+			var ids []int64
+			var errs []error
+
+			params := ListMoviesParams{PageParams: PageParams{Page: tt.start, PageSize: tt.server.pageSize}}
+			for movie, err := range c.Movies(context.Background(), params) {
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+
+				ids = append(ids, movie.ID)
+				if len(ids) == tt.stopAfter {
+					break
+				}
+			}
+
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got movies %v; want %v", ids, tt.wantIDs)
+			}
+			if !slices.Equal(tt.server.pages, tt.wantPages) {
+				t.Errorf("fetched pages %v; want %v", tt.server.pages, tt.wantPages)
+			}
+			if tt.wantErr != (len(errs) == 1) || len(errs) > 1 {
+				t.Errorf("got errors %v; want error %t", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuntimeJSON(t *testing.T) {
+	js, err := json.Marshal(Runtime(102))
+	if err != nil || string(js) != `"102 mins"` {
+		t.Errorf("got %s, %v; want \"102 mins\"", js, err)
+	}
+
+	var r Runtime
+	if err := json.Unmarshal([]byte(`"95 mins"`), &r); err != nil || r != 95 {
+		t.Errorf("got %d, %v; want 95", r, err)
+	}
+
+	for _, bad := range []string{`95`, `"95"`, `"95 minutes"`, `"ninety mins"`} {
+		if err := json.Unmarshal([]byte(bad), &r); !errors.Is(err, ErrInvalidRuntimeFormat) {
+			t.Errorf("%s: got error %v; want ErrInvalidRuntimeFormat", bad, err)
+		}
+	}
+}
+
+func TestExportMoviesIncomplete(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		wantErr bool
+	}{
+		{"Complete", "complete", false},
+		{"Failed", "failed", true},
+		{"Cut off", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "Export-Status")
+				w.Write([]byte(`{"id": 1, "title": "Casablanca"}` + "\n"))
+				if tt.status != "" {
+					w.Header().Set("Export-Status", tt.status)
+				}
+			}))
+			defer ts.Close()
+
+			body, err := newTestClient(t, ts).ExportMovies(context.Background(), ExportParams{Format: "ndjson"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			movies, err := io.ReadAll(body)
+			if len(movies) == 0 {
+				t.Error("got an empty body")
+			}
+			if errors.Is(err, ErrIncompleteExport) != tt.wantErr || (err != nil && !tt.wantErr) {
+				t.Errorf("got error %v; want ErrIncompleteExport %t", err, tt.wantErr)
+			}
+		})
+	}
+}
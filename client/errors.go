@@ -0,0 +1,219 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Define the stable codes of the API's errors, which are the "code" member of its problem
+// details. Clients should check codes rather than messages, which are translated.
+const (
+	CodeServerError                = "server_error"
+	CodeNotFound                   = "not_found"
+	CodeMethodNotAllowed           = "method_not_allowed"
+	CodeBadRequest                 = "bad_request"
+	CodeValidationFailed           = "validation_failed"
+	CodeEditConflict               = "edit_conflict"
+	CodePreconditionFailed         = "precondition_failed"
+	CodePatchTestFailed            = "patch_test_failed"
+	CodeInvalidStatusTransition    = "invalid_status_transition"
+	CodeUnsupportedMediaType       = "unsupported_media_type"
+	CodeIdempotencyKeyMismatch     = "idempotency_key_mismatch"
+	CodeIdempotencyKeyInUse        = "idempotency_key_in_use"
+	CodeRateLimitExceeded          = "rate_limit_exceeded"
+	CodeInvalidCredentials         = "invalid_credentials"
+	CodeInvalidAuthenticationToken = "invalid_authentication_token"
+	CodeAuthenticationRequired     = "authentication_required"
+	CodeInactiveAccount            = "inactive_account"
+	CodeNotPermitted               = "not_permitted"
+	CodeFailedDependency           = "failed_dependency"
+)
+
+// FieldError is a single validation error: the path of the field which failed validation
+// (such as "title" or "genres[2]"), a stable code (such as "max_length"), the message in
+// the language of the request, and the values the rule checked against (such as
+// {"max": 500}).
+type FieldError struct {
+	Field   string         `json:"field"`
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Params  map[string]any `json:"params,omitempty"`
+}
+
+// APIError is an error response from the API, decoded from its RFC 7807 problem details.
+// Responses in the legacy {"error": ...} shape are decoded too, in which case Code is
+// empty unless it can be told from the status, and Detail holds the message.
+//
+// Validation, conflict, rate-limit and authentication failures are returned as the more
+// specific ValidationError, ConflictError, RateLimitError and AuthError, which all wrap an
+// APIError, so errors.As(err, &apiErr) works for every error response.
+type APIError struct {
+	StatusCode int          // The HTTP status code of the response.
+	Type       string       // The URI identifying the kind of problem.
+	Code       string       // The stable code of the problem, such as "edit_conflict".
+	Reason     string       // For bad requests, what was wrong, such as "body_too_large".
+	Title      string       // A short summary of the kind of problem.
+	Detail     string       // An explanation of this occurrence of the problem.
+	Instance   string       // The request URI the problem occurred on.
+	Errors     []FieldError // The validation errors, for 422 Unprocessable Entity responses.
+
+	body []byte // The response body, for endpoints whose errors carry more, such as batches.
+}
+
+// Error returns the detail of the problem, or its title if it has no detail.
+func (e *APIError) Error() string {
+	message := e.Detail
+	if message == "" {
+		message = e.Title
+	}
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+
+	if e.Code != "" {
+		return fmt.Sprintf("greenlight: %d %s: %s", e.StatusCode, e.Code, message)
+	}
+	return fmt.Sprintf("greenlight: %d: %s", e.StatusCode, message)
+}
+
+// ValidationError is returned for 422 Unprocessable Entity responses, when the request
+// failed validation. The errors of each field are in Errors, and FieldErrors gives them by
+// field.
+type ValidationError struct {
+	*APIError
+}
+
+// Unwrap returns the underlying APIError.
+func (e *ValidationError) Unwrap() error { return e.APIError }
+
+// FieldErrors returns the messages of the validation errors by field. Fields with more
+// than one error have each of their messages, in the order the API gave them.
+func (e *ValidationError) FieldErrors() map[string][]string {
+	fields := make(map[string][]string, len(e.Errors))
+	for _, fe := range e.Errors {
+		fields[fe.Field] = append(fields[fe.Field], fe.Message)
+	}
+	return fields
+}
+
+// ConflictError is returned for 409 Conflict and 412 Precondition Failed responses, when
+// the request conflicts with the current state of the resource: it was changed since the
+// client read it (Code is CodeEditConflict or CodePreconditionFailed), a JSON Patch test
+// failed, a moderation step isn't allowed in the movie's status, or an idempotency key is
+// in use.
+type ConflictError struct {
+	*APIError
+}
+
+// Unwrap returns the underlying APIError.
+func (e *ConflictError) Unwrap() error { return e.APIError }
+
+// RateLimitError is returned for 429 Too Many Requests responses which were still rate
+// limited after every retry. RetryAfter is the wait the API asked for, if it gave one.
+type RateLimitError struct {
+	*APIError
+	RetryAfter time.Duration
+}
+
+// Unwrap returns the underlying APIError.
+func (e *RateLimitError) Unwrap() error { return e.APIError }
+
+// AuthError is returned for 401 Unauthorized and 403 Forbidden responses: the credentials
+// or authentication token are invalid, a token is required, the account isn't activated,
+// or the user doesn't have the permission the endpoint needs.
+type AuthError struct {
+	*APIError
+}
+
+// Unwrap returns the underlying APIError.
+func (e *AuthError) Unwrap() error { return e.APIError }
+
+// maxErrorBodyBytes limits how much of an error response is read.
+const maxErrorBodyBytes = 1 << 20
+
+// newError decodes an error response into the most specific of the error types above.
+func newError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+
+	apiErr := &APIError{StatusCode: resp.StatusCode, body: body}
+
+	// Decode the problem details, along with the "error" member of the legacy shape.
+	var problem struct {
+		Type     string          `json:"type"`
+		Title    string          `json:"title"`
+		Detail   string          `json:"detail"`
+		Instance string          `json:"instance"`
+		Code     string          `json:"code"`
+		Reason   string          `json:"reason"`
+		Errors   json.RawMessage `json:"errors"`
+		Error    json.RawMessage `json:"error"`
+	}
+
+	if err := json.Unmarshal(body, &problem); err == nil {
+		apiErr.Type = problem.Type
+		apiErr.Title = problem.Title
+		apiErr.Detail = problem.Detail
+		apiErr.Instance = problem.Instance
+		apiErr.Code = problem.Code
+		apiErr.Reason = problem.Reason
+
+		// In problem details, errors is a list of field errors. In the legacy shape, error
+		// is either a message or a map of messages by field.
+		_ = json.Unmarshal(problem.Errors, &apiErr.Errors)
+
+		if len(problem.Error) > 0 {
+			var message string
+			var fields map[string]string
+
+			switch {
+			case json.Unmarshal(problem.Error, &message) == nil:
+				apiErr.Detail = message
+			case json.Unmarshal(problem.Error, &fields) == nil:
+				for _, field := range slices.Sorted(maps.Keys(fields)) {
+					apiErr.Errors = append(apiErr.Errors, FieldError{Field: field, Message: fields[field]})
+				}
+			}
+		}
+	} else {
+		apiErr.Detail = strings.TrimSpace(string(body))
+	}
+
+	if apiErr.Code == "" {
+		switch resp.StatusCode {
+		case http.StatusUnprocessableEntity:
+			apiErr.Code = CodeValidationFailed
+		case http.StatusTooManyRequests:
+			apiErr.Code = CodeRateLimitExceeded
+		case http.StatusNotFound:
+			apiErr.Code = CodeNotFound
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnprocessableEntity:
+		return &ValidationError{APIError: apiErr}
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return &ConflictError{APIError: apiErr}
+	case http.StatusTooManyRequests:
+		wait, _ := retryAfter(resp)
+		return &RateLimitError{APIError: apiErr, RetryAfter: wait}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AuthError{APIError: apiErr}
+	default:
+		return apiErr
+	}
+}
+
+// IsNotFound reports whether the error is a 404 Not Found response, which the API sends
+// for resources which don't exist and for those the user isn't allowed to see.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Healthcheck returns the status of the API, with its environment and version.
+func (c *Client) Healthcheck(ctx context.Context) (*Health, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/healthcheck", nil)
+
+	var health Health
+	if err := c.do(ctx, req, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// OpenAPIDocument returns the API's OpenAPI 3.1 document.
+func (c *Client) OpenAPIDocument(ctx context.Context) (json.RawMessage, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/openapi.json", nil)
+
+	var doc json.RawMessage
+	if err := c.do(ctx, req, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,667 @@
+package client
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// moviePath returns the path of a movie, or of one of its subresources.
+func moviePath(id int64, parts ...string) string {
+	path := "/v1/movies/" + strconv.FormatInt(id, 10)
+	for _, part := range parts {
+		path += "/" + url.PathEscape(part)
+	}
+	return path
+}
+
+// movieResponse is the envelope of the endpoints which return a single movie.
+type movieResponse struct {
+	Movie *Movie `json:"movie"`
+}
+
+// sendMovie sends a request which returns a single movie.
+func (c *Client) sendMovie(ctx context.Context, req *request) (*Movie, error) {
+	var resp movieResponse
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Movie, nil
+}
+
+// setExpectedVersion adds the X-Expected-Version header for a version the client expects
+// the movie to have, unless it is zero.
+func (req *request) setExpectedVersion(version int32) {
+	if version != 0 {
+		req.header.Set("X-Expected-Version", strconv.Itoa(int(version)))
+	}
+}
+
+// ListMovies returns a page of movies matching the filters, with the counts of any
+// facets which were asked for. Movies iterates over every page.
+func (c *Client) ListMovies(ctx context.Context, params ListMoviesParams) (*MovieList, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/movies", nil)
+
+	req.query = url.Values{}
+	params.FilterParams.encode(req.query)
+	params.ProjectionParams.encode(req.query)
+	params.PageParams.encode(req.query)
+	setList(req.query, "facets", params.Facets)
+
+	var list MovieList
+	if err := c.do(ctx, req, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Movies iterates over every movie matching the filters, fetching the pages as it goes,
+// starting from params.Page (or the first page). Iteration stops at the first error.
+func (c *Client) Movies(ctx context.Context, params ListMoviesParams) iter.Seq2[*Movie, error] {
+	return paginate(params.Page, func(page int) ([]*Movie, Metadata, error) {
+		params.Page = page
+		list, err := c.ListMovies(ctx, params)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		return list.Movies, list.Metadata, nil
+	})
+}
+
+// GetMovie returns a movie.
+func (c *Client) GetMovie(ctx context.Context, id int64, params ProjectionParams) (*Movie, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodGet, moviePath(id), nil)
+	req.query = url.Values{}
+	params.encode(req.query)
+
+	return c.sendMovie(ctx, req)
+}
+
+// CreateMovie creates a movie.
+func (c *Client) CreateMovie(ctx context.Context, input CreateMovieInput) (*Movie, error) {
+	req, err := newRequest(http.MethodPost, "/v1/movies", input)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMovie(ctx, req)
+}
+
+// UpdateMovie changes the fields of a movie given in the input.
+func (c *Client) UpdateMovie(ctx context.Context, id int64, input UpdateMovieInput) (*Movie, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, err := newRequest(http.MethodPatch, moviePath(id), input)
+	if err != nil {
+		return nil, err
+	}
+	req.setExpectedVersion(input.ExpectedVersion)
+
+	return c.sendMovie(ctx, req)
+}
+
+// DeleteMovie moves a movie to the trash. If expectedVersion isn't zero, the movie is
+// only deleted if it still has that version.
+func (c *Client) DeleteMovie(ctx context.Context, id int64, expectedVersion int32) error {
+	if id < 1 {
+		return errMissingID
+	}
+
+	req, _ := newRequest(http.MethodDelete, moviePath(id), nil)
+	req.setExpectedVersion(expectedVersion)
+
+	return c.do(ctx, req, nil)
+}
+
+// movieListResponse is the envelope of the paginated movie lists other than ListMovies.
+type movieListResponse struct {
+	Movies   []*Movie `json:"movies"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// ListTrashedMovies returns a page of the deleted movies which haven't been purged yet.
+func (c *Client) ListTrashedMovies(ctx context.Context, params PageParams) ([]*Movie, Metadata, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/movies/trash", nil)
+	req.query = url.Values{}
+	params.encode(req.query)
+
+	var resp movieListResponse
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, Metadata{}, err
+	}
+	return resp.Movies, resp.Metadata, nil
+}
+
+// TrashedMovies iterates over every deleted movie which hasn't been purged yet.
+func (c *Client) TrashedMovies(ctx context.Context, params PageParams) iter.Seq2[*Movie, error] {
+	return paginate(params.Page, func(page int) ([]*Movie, Metadata, error) {
+		params.Page = page
+		return c.ListTrashedMovies(ctx, params)
+	})
+}
+
+// RestoreMovie takes a deleted movie back out of the trash.
+func (c *Client) RestoreMovie(ctx context.Context, id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodPost, moviePath(id, "restore"), nil)
+	return c.sendMovie(ctx, req)
+}
+
+// ErrIncompleteExport is returned by the body of an export, instead of io.EOF, when the
+// API didn't finish the export: either it failed part way through, or the response was cut
+// off. The movies read before it are a truncated export.
+var ErrIncompleteExport = errors.New("client: export is incomplete")
+
+// ExportMovies streams every movie matching the filters in the chosen format. The caller
+// must close the returned body, and must read it to the end to know that the export is
+// complete: reading the body ends with ErrIncompleteExport rather than io.EOF if it isn't.
+func (c *Client) ExportMovies(ctx context.Context, params ExportParams) (io.ReadCloser, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/movies/export", nil)
+
+	req.query = url.Values{}
+	params.FilterParams.encode(req.query)
+	setString(req.query, "format", params.Format)
+	setString(req.query, "sort", params.Sort)
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &exportBody{resp: resp}, nil
+}
+
+// exportBody is the body of an export, which checks the Export-Status trailer the API sends
+// once the last movie has been written. Trailers are only known once the body has been read
+// to the end.
+type exportBody struct {
+	resp *http.Response
+}
+
+func (b *exportBody) Read(p []byte) (int, error) {
+	n, err := b.resp.Body.Read(p)
+	if errors.Is(err, io.EOF) && b.resp.Trailer.Get("Export-Status") != "complete" {
+		return n, fmt.Errorf("%w: %s movies were written before it ended", ErrIncompleteExport, cmp.Or(b.resp.Trailer.Get("Export-Count"), "an unknown number of"))
+	}
+	return n, err
+}
+
+func (b *exportBody) Close() error {
+	return b.resp.Body.Close()
+}
+
+// ImportMovies imports movies from a CSV or NDJSON file. Small files are imported straight
+// away and their report is returned; large ones, and every file when params.Async is set,
+// are imported by a background job which can be polled with ImportJob. Requests whose
+// file isn't an io.Seeker can't be sent again, so they aren't retried.
+func (c *Client) ImportMovies(ctx context.Context, file io.Reader, params ImportParams) (*ImportResult, error) {
+	req := &request{method: http.MethodPost, path: "/v1/movies/import", header: make(http.Header), bodyReader: file}
+
+	switch params.Format {
+	case "csv":
+		req.contentType = "text/csv"
+	case "ndjson":
+		req.contentType = "application/x-ndjson"
+	default:
+		return nil, fmt.Errorf("client: import format %q must be csv or ndjson", params.Format)
+	}
+
+	req.query = url.Values{}
+	setString(req.query, "mode", params.Mode)
+	if params.DryRun {
+		req.query.Set("dry_run", "true")
+	}
+	if params.Async {
+		req.query.Set("async", "true")
+	}
+
+	var resp struct {
+		Import    *ImportReport `json:"import"`
+		ImportJob *ImportJob    `json:"import_job"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &ImportResult{Report: resp.Import, Job: resp.ImportJob}, nil
+}
+
+// ImportJob returns the status and report of a background import job.
+func (c *Client) ImportJob(ctx context.Context, id int64) (*ImportJob, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodGet, "/v1/imports/"+strconv.FormatInt(id, 10), nil)
+
+	var resp struct {
+		ImportJob *ImportJob `json:"import_job"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.ImportJob, nil
+}
+
+// BatchMovies applies a list of create, update and delete operations in one request, and
+// returns the result of each, in order. In atomic mode, if an operation fails none of them
+// are applied, and the results are returned along with the error of the failed operation's
+// status, such as a ValidationError.
+func (c *Client) BatchMovies(ctx context.Context, input BatchInput) ([]BatchResult, error) {
+	req, err := newRequest(http.MethodPost, "/v1/movies/batch", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Results []BatchResult `json:"results"`
+	}
+
+	err = c.do(ctx, req, &resp)
+	if err != nil {
+		// The response of a failed atomic batch still holds the results.
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			_ = json.Unmarshal(apiErr.body, &resp)
+		}
+		return resp.Results, err
+	}
+
+	return resp.Results, nil
+}
+
+// MovieChangesSince returns the movies changed and deleted since a sync token, which is
+// empty for the first sync. pageSize limits how many changes are returned at a time, and
+// is the API's default if zero.
+func (c *Client) MovieChangesSince(ctx context.Context, since string, pageSize int) (*MovieChanges, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/movies/changes", nil)
+	req.query = url.Values{}
+	setString(req.query, "since", since)
+	setInt(req.query, "page_size", pageSize)
+
+	var changes MovieChanges
+	if err := c.do(ctx, req, &changes); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
+
+// ListMovieRevisions returns a page of the revision history of a movie, newest first.
+func (c *Client) ListMovieRevisions(ctx context.Context, id int64, params PageParams) ([]*MovieRevision, Metadata, error) {
+	if id < 1 {
+		return nil, Metadata{}, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodGet, moviePath(id, "revisions"), nil)
+	req.query = url.Values{}
+	params.encode(req.query)
+
+	var resp struct {
+		Revisions []*MovieRevision `json:"revisions"`
+		Metadata  Metadata         `json:"metadata"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, Metadata{}, err
+	}
+	return resp.Revisions, resp.Metadata, nil
+}
+
+// MovieRevisions iterates over the whole revision history of a movie.
+func (c *Client) MovieRevisions(ctx context.Context, id int64, params PageParams) iter.Seq2[*MovieRevision, error] {
+	return paginate(params.Page, func(page int) ([]*MovieRevision, Metadata, error) {
+		params.Page = page
+		return c.ListMovieRevisions(ctx, id, params)
+	})
+}
+
+// GetMovieRevision returns a single version of a movie.
+func (c *Client) GetMovieRevision(ctx context.Context, id int64, version int32) (*MovieRevision, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodGet, moviePath(id, "revisions", strconv.Itoa(int(version))), nil)
+
+	var resp struct {
+		Revision *MovieRevision `json:"revision"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Revision, nil
+}
+
+// RestoreMovieRevision rolls a movie back to the values of a previous version, which is
+// saved as a new version. If expectedVersion isn't zero, the movie is only changed if it
+// still has that version.
+func (c *Client) RestoreMovieRevision(ctx context.Context, id int64, version, expectedVersion int32) (*Movie, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodPost, moviePath(id, "revisions", strconv.Itoa(int(version)), "restore"), nil)
+	req.setExpectedVersion(expectedVersion)
+
+	return c.sendMovie(ctx, req)
+}
+
+// ListSubmissions returns a page of the movies going through moderation: every user's for
+// moderators, otherwise the user's own.
+func (c *Client) ListSubmissions(ctx context.Context, params ListSubmissionsParams) ([]*Movie, Metadata, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/movies/submissions", nil)
+	req.query = url.Values{}
+	params.PageParams.encode(req.query)
+	setString(req.query, "status", params.Status)
+
+	var resp movieListResponse
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, Metadata{}, err
+	}
+	return resp.Movies, resp.Metadata, nil
+}
+
+// Submissions iterates over every movie going through moderation with the status.
+func (c *Client) Submissions(ctx context.Context, params ListSubmissionsParams) iter.Seq2[*Movie, error] {
+	return paginate(params.Page, func(page int) ([]*Movie, Metadata, error) {
+		params.Page = page
+		return c.ListSubmissions(ctx, params)
+	})
+}
+
+// SubmitMovie sends a draft or rejected movie to the moderators.
+func (c *Client) SubmitMovie(ctx context.Context, id int64) (*Movie, error) {
+	return c.moderate(ctx, id, "submit", nil)
+}
+
+// ApproveMovie publishes a pending movie.
+func (c *Client) ApproveMovie(ctx context.Context, id int64) (*Movie, error) {
+	return c.moderate(ctx, id, "approve", nil)
+}
+
+// RejectMovie rejects a pending movie with a reason, which is sent to its submitter.
+func (c *Client) RejectMovie(ctx context.Context, id int64, reason string) (*Movie, error) {
+	return c.moderate(ctx, id, "reject", map[string]string{"reason": reason})
+}
+
+// moderate sends a moderation step for a movie.
+func (c *Client) moderate(ctx context.Context, id int64, step string, body any) (*Movie, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, err := newRequest(http.MethodPost, moviePath(id, step), body)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMovie(ctx, req)
+}
+
+// CheckDuplicates returns the movies which a movie with the given title, year and runtime
+// would duplicate, most similar first. Year and runtime are optional.
+func (c *Client) CheckDuplicates(ctx context.Context, title string, year int32, runtime Runtime, params DuplicateParams) ([]DuplicateCandidate, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/movies/duplicates", nil)
+	req.query = url.Values{"title": {title}}
+	setInt(req.query, "year", int(year))
+	setInt(req.query, "runtime", int(runtime))
+	params.encode(req.query)
+
+	return c.sendDuplicates(ctx, req)
+}
+
+// ListMovieDuplicates returns the movies which look like duplicates of a movie, most
+// similar first.
+func (c *Client) ListMovieDuplicates(ctx context.Context, id int64, params DuplicateParams) ([]DuplicateCandidate, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodGet, moviePath(id, "duplicates"), nil)
+	req.query = url.Values{}
+	params.encode(req.query)
+
+	return c.sendDuplicates(ctx, req)
+}
+
+// sendDuplicates sends a request which returns duplicate candidates.
+func (c *Client) sendDuplicates(ctx context.Context, req *request) ([]DuplicateCandidate, error) {
+	var resp struct {
+		Duplicates []DuplicateCandidate `json:"duplicates"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Duplicates, nil
+}
+
+// MergeMovie merges a duplicate movie into the movie with the given ID, and returns the
+// movie along with the duplicate's rows which clashed with the movie's own and weren't
+// moved to it.
+func (c *Client) MergeMovie(ctx context.Context, id, duplicateID int64) (*Movie, *MergeDropped, error) {
+	if id < 1 || duplicateID < 1 {
+		return nil, nil, errMissingID
+	}
+
+	req, err := newRequest(http.MethodPost, moviePath(id, "merge"), map[string]int64{"duplicate_id": duplicateID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resp struct {
+		Movie   *Movie        `json:"movie"`
+		Dropped *MergeDropped `json:"dropped"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, nil, err
+	}
+	return resp.Movie, resp.Dropped, nil
+}
+
+// SimilarMovies returns the movies most like a movie, best first. limit is the API's
+// default if zero.
+func (c *Client) SimilarMovies(ctx context.Context, id int64, limit int) ([]Recommendation, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodGet, moviePath(id, "similar"), nil)
+	req.query = url.Values{}
+	setInt(req.query, "limit", limit)
+
+	return c.sendRecommendations(ctx, req)
+}
+
+// Recommendations returns personal movie picks for the current user, best first. limit
+// is the API's default if zero.
+func (c *Client) Recommendations(ctx context.Context, limit int) ([]Recommendation, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/users/me/recommendations", nil)
+	req.query = url.Values{}
+	setInt(req.query, "limit", limit)
+
+	return c.sendRecommendations(ctx, req)
+}
+
+// sendRecommendations sends a request which returns recommendations.
+func (c *Client) sendRecommendations(ctx context.Context, req *request) ([]Recommendation, error) {
+	var resp struct {
+		Recommendations []Recommendation `json:"recommendations"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Recommendations, nil
+}
+
+// SetMovieExternalID sets the movie's identifier in another catalogue, such as "imdb".
+func (c *Client) SetMovieExternalID(ctx context.Context, id int64, source, externalID string) (*Movie, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, err := newRequest(http.MethodPut, moviePath(id, "external-ids", source), map[string]string{"id": externalID})
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMovie(ctx, req)
+}
+
+// DeleteMovieExternalID removes the movie's identifier in another catalogue.
+func (c *Client) DeleteMovieExternalID(ctx context.Context, id int64, source string) error {
+	return c.deleteSubresource(ctx, id, "external-ids", source)
+}
+
+// MovieByExternalID looks up a movie by its identifier in another catalogue.
+func (c *Client) MovieByExternalID(ctx context.Context, source, externalID string) (*Movie, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/external-ids/"+url.PathEscape(source)+"/"+url.PathEscape(externalID), nil)
+	return c.sendMovie(ctx, req)
+}
+
+// SetAlternateTitle sets the movie's title in a language or region, such as "fr", "pt-BR"
+// or "CA".
+func (c *Client) SetAlternateTitle(ctx context.Context, id int64, locale, title string) (*Movie, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, err := newRequest(http.MethodPut, moviePath(id, "titles", locale), map[string]string{"title": title})
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMovie(ctx, req)
+}
+
+// DeleteAlternateTitle removes the movie's title in a language or region.
+func (c *Client) DeleteAlternateTitle(ctx context.Context, id int64, locale string) error {
+	return c.deleteSubresource(ctx, id, "titles", locale)
+}
+
+// SetRelease sets the movie's release date and certification in a country, given by its
+// two-letter code.
+func (c *Client) SetRelease(ctx context.Context, id int64, country string, input ReleaseInput) (*Movie, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, err := newRequest(http.MethodPut, moviePath(id, "releases", country), input)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMovie(ctx, req)
+}
+
+// DeleteRelease removes the movie's release in a country.
+func (c *Client) DeleteRelease(ctx context.Context, id int64, country string) error {
+	return c.deleteSubresource(ctx, id, "releases", country)
+}
+
+// UploadMovieImage uploads a poster or backdrop of a movie, and returns it with its
+// thumbnails.
+func (c *Client) UploadMovieImage(ctx context.Context, id int64, input UploadImageInput) (*MovieImage, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	if err := mw.WriteField("kind", input.Kind); err != nil {
+		return nil, err
+	}
+
+	filename := input.Filename
+	if filename == "" {
+		filename = "image"
+	}
+
+	part, err := mw.CreateFormFile("image", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(input.Image); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	req := &request{
+		method:      http.MethodPost,
+		path:        moviePath(id, "images"),
+		header:      make(http.Header),
+		body:        body.Bytes(),
+		contentType: mw.FormDataContentType(),
+	}
+
+	var resp struct {
+		Image *MovieImage `json:"image"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Image, nil
+}
+
+// ListMovieImages returns the movie's images, with signed URLs to download them.
+func (c *Client) ListMovieImages(ctx context.Context, id int64) ([]MovieImage, error) {
+	if id < 1 {
+		return nil, errMissingID
+	}
+
+	req, _ := newRequest(http.MethodGet, moviePath(id, "images"), nil)
+
+	var resp struct {
+		Images []MovieImage `json:"images"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Images, nil
+}
+
+// DeleteMovieImage removes an image of the movie along with its thumbnails.
+func (c *Client) DeleteMovieImage(ctx context.Context, id, imageID int64) error {
+	return c.deleteSubresource(ctx, id, "images", strconv.FormatInt(imageID, 10))
+}
+
+// deleteSubresource deletes a subresource of a movie, such as one of its releases.
+func (c *Client) deleteSubresource(ctx context.Context, id int64, parts ...string) error {
+	if id < 1 {
+		return errMissingID
+	}
+
+	req, _ := newRequest(http.MethodDelete, moviePath(id, parts...), nil)
+
+	return c.do(ctx, req, nil)
+}
+
+// MovieStats returns statistics about the movies matching the filters, grouped if
+// params.GroupBy is set.
+func (c *Client) MovieStats(ctx context.Context, params StatsParams) (*MovieStats, error) {
+	req, _ := newRequest(http.MethodGet, "/v1/stats/movies", nil)
+	req.query = url.Values{}
+	params.FilterParams.encode(req.query)
+	setString(req.query, "group_by", params.GroupBy)
+
+	var resp struct {
+		Stats *MovieStats `json:"stats"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Stats, nil
+}
@@ -0,0 +1,34 @@
+package client
+
+import "iter"
+
+// paginate returns an iterator over the items of a paginated list, which fetches each
+// page with fetch as the iteration reaches it, starting from the given page (or the first
+// page if it is zero). It stops after the last page given by the pagination metadata, at
+// the first empty page, or at the first error, which is yielded with a nil item.
+func paginate[T any](start int, fetch func(page int) ([]T, Metadata, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		page := max(start, 1)
+
+		for {
+			items, metadata, err := fetch(page)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if len(items) == 0 || metadata.CurrentPage >= metadata.LastPage {
+				return
+			}
+
+			page = metadata.CurrentPage + 1
+		}
+	}
+}
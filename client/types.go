@@ -0,0 +1,517 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Movie is a movie. Fields the request didn't choose with a projection are zero, and the
+// related resources (ExternalIDs, AlternateTitles, Releases, Images and Creator) are only
+// set when they were included.
+type Movie struct {
+	ID              int64             `json:"id"`
+	Title           string            `json:"title"`
+	Year            int32             `json:"year,omitempty"`
+	Runtime         Runtime           `json:"runtime,omitempty"`
+	Genres          []string          `json:"genres,omitempty"`
+	Version         int32             `json:"version"`
+	DeletedAt       *time.Time        `json:"deleted_at,omitempty"`
+	ExternalIDs     map[string]string `json:"external_ids,omitempty"`
+	DisplayTitle    string            `json:"display_title,omitempty"`
+	AlternateTitles map[string]string `json:"alternate_titles,omitempty"`
+	Releases        []Release         `json:"releases,omitempty"`
+	Images          []MovieImage      `json:"images,omitempty"`
+	Status          string            `json:"status,omitempty"`
+	StatusReason    string            `json:"status_reason,omitempty"`
+	SubmittedBy     int64             `json:"submitted_by,omitempty"`
+	CreatedBy       int64             `json:"created_by,omitempty"`
+	UpdatedBy       int64             `json:"updated_by,omitempty"`
+	UpdatedAt       time.Time         `json:"updated_at,omitzero"`
+	Creator         *MovieCreator     `json:"creator,omitempty"`
+}
+
+// MovieCreator is the user who created a movie.
+type MovieCreator struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// ErrInvalidRuntimeFormat is returned when decoding a runtime which isn't in the
+// "<minutes> mins" format.
+var ErrInvalidRuntimeFormat = errors.New("client: invalid runtime format")
+
+// Runtime is a movie's runtime in minutes, written in JSON as "<minutes> mins".
+type Runtime int32
+
+// MarshalJSON implements the json.Marshaler interface, writing the runtime as a string
+// such as "102 mins".
+func (r Runtime) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(fmt.Sprintf("%d mins", r))), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, reading a runtime written as a
+// string such as "102 mins".
+func (r *Runtime) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return ErrInvalidRuntimeFormat
+	}
+
+	minutes, ok := strings.CutSuffix(s, " mins")
+	if !ok {
+		return ErrInvalidRuntimeFormat
+	}
+
+	i, err := strconv.ParseInt(minutes, 10, 32)
+	if err != nil {
+		return ErrInvalidRuntimeFormat
+	}
+
+	*r = Runtime(i)
+	return nil
+}
+
+// Release is a movie's release date (YYYY-MM-DD) and certification in a country, given
+// as an ISO 3166-1 alpha-2 code.
+type Release struct {
+	Country       string `json:"country"`
+	Date          string `json:"date"`
+	Certification string `json:"certification,omitempty"`
+}
+
+// MovieImage is a poster or backdrop of a movie, with a signed URL to download it and its
+// thumbnails.
+type MovieImage struct {
+	ID          int64            `json:"id"`
+	Kind        string           `json:"kind"`
+	ContentType string           `json:"content_type"`
+	Width       int              `json:"width"`
+	Height      int              `json:"height"`
+	Size        int64            `json:"size"`
+	URL         string           `json:"url,omitempty"`
+	Thumbnails  []ImageThumbnail `json:"thumbnails"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// ImageThumbnail is a smaller copy of a MovieImage, with a signed URL to download it.
+type ImageThumbnail struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	URL         string `json:"url,omitempty"`
+}
+
+// Metadata is the pagination metadata of a list. It is empty when no records matched.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// FacetBucket is a value of a facet and the number of matching movies with it.
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// MovieRevision is a saved version of a movie: a snapshot of the movie after the
+// operation, who performed it and the fields it changed.
+type MovieRevision struct {
+	ID        int64                  `json:"id"`
+	MovieID   int64                  `json:"movie_id"`
+	Version   int32                  `json:"version"`
+	Operation string                 `json:"operation"`
+	UserID    int64                  `json:"user_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Movie     Movie                  `json:"movie"`
+	Diff      map[string]FieldChange `json:"diff"`
+}
+
+// FieldChange is the value of a movie field before and after a revision.
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Tombstone records a movie deleted since a sync token.
+type Tombstone struct {
+	ID        int64     `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// DuplicateCandidate is a movie which looks like a duplicate, with its overall similarity
+// score and the score of each signal, all between 0 and 1.
+type DuplicateCandidate struct {
+	Movie  *Movie          `json:"movie"`
+	Score  float64         `json:"score"`
+	Scores DuplicateScores `json:"scores"`
+}
+
+// MergeDropped holds the external IDs, alternate titles and releases of a merged duplicate
+// which weren't moved to the kept movie, because it already had its own for the same
+// source, locale or country. They stay with the duplicate in the trash.
+type MergeDropped struct {
+	ExternalIDs     map[string]string `json:"external_ids,omitempty"`
+	AlternateTitles map[string]string `json:"alternate_titles,omitempty"`
+	Releases        []Release         `json:"releases,omitempty"`
+}
+
+// DuplicateScores are the similarity scores of a DuplicateCandidate's title, year and
+// runtime. Runtime is nil if either movie's runtime isn't known.
+type DuplicateScores struct {
+	Title   float64  `json:"title"`
+	Year    float64  `json:"year"`
+	Runtime *float64 `json:"runtime,omitempty"`
+}
+
+// Recommendation is a recommended movie, with its score and the reasons it was chosen.
+type Recommendation struct {
+	Movie   *Movie   `json:"movie"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// Define the statuses of an ImportJob.
+const (
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+)
+
+// ImportJob is a background movie import. Its Report is updated as the import progresses,
+// and Error describes why it failed if its Status is ImportJobFailed.
+type ImportJob struct {
+	ID        int64        `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Format    string       `json:"format"`
+	Mode      string       `json:"mode"`
+	DryRun    bool         `json:"dry_run"`
+	Status    string       `json:"status"`
+	Report    ImportReport `json:"report"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// ImportReport is the outcome of a movie import. Errors lists the rejected rows, up to a
+// limit after which ErrorsTruncated is set.
+type ImportReport struct {
+	DryRun          bool             `json:"dry_run"`
+	TotalRows       int              `json:"total_rows"`
+	Created         int              `json:"created"`
+	Updated         int              `json:"updated"`
+	Failed          int              `json:"failed"`
+	Errors          []ImportRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
+
+// ImportRowError describes why a row of an import file was rejected. Rows are numbered
+// from 1, not counting the CSV header.
+type ImportRowError struct {
+	Row         int          `json:"row"`
+	ExternalKey string       `json:"external_key,omitempty"`
+	Errors      []FieldError `json:"errors"`
+}
+
+// MovieStats holds statistics about the catalogue: the totals over all matching movies
+// and, if a grouping was asked for, those of each group. AsOf is the time the statistics
+// were last refreshed, if they were read from a cache.
+type MovieStats struct {
+	GroupBy        string        `json:"group_by,omitempty"`
+	Count          int           `json:"count"`
+	AverageRuntime float64       `json:"average_runtime"`
+	Groups         []StatsBucket `json:"groups,omitempty"`
+	AsOf           *time.Time    `json:"as_of,omitempty"`
+}
+
+// StatsBucket holds the statistics of one group of MovieStats. Cumulative is the running
+// total of the counts, for groupings by time.
+type StatsBucket struct {
+	Key            string  `json:"key"`
+	Count          int     `json:"count"`
+	AverageRuntime float64 `json:"average_runtime"`
+	Cumulative     int     `json:"cumulative,omitempty"`
+}
+
+// User is a user account.
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Activated bool      `json:"activated"`
+}
+
+// Token is an authentication token; Plaintext is the value to pass to SetToken.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// Health is the response of the healthcheck endpoint.
+type Health struct {
+	Status     string `json:"status"`
+	SystemInfo struct {
+		Environment string `json:"environment"`
+		Version     string `json:"version"`
+	} `json:"system_info"`
+}
+
+// CreateMovieInput holds the fields of a new movie. Status is optional: users with the
+// movies:write permission create published movies by default, and users with only
+// movies:submit create pending movies, which wait for a moderator. Either may ask for a
+// draft instead.
+type CreateMovieInput struct {
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime Runtime  `json:"runtime"`
+	Genres  []string `json:"genres"`
+	Status  string   `json:"status,omitempty"`
+}
+
+// UpdateMovieInput holds the fields of a movie to change; nil fields are left as they
+// are. ExpectedVersion, if not zero, is the version the client expects the movie to have,
+// and the update fails with a ConflictError if it has changed since.
+type UpdateMovieInput struct {
+	Title           *string  `json:"title,omitempty"`
+	Year            *int32   `json:"year,omitempty"`
+	Runtime         *Runtime `json:"runtime,omitempty"`
+	Genres          []string `json:"genres,omitempty"`
+	ExpectedVersion int32    `json:"-"`
+}
+
+// Define the modes of a movie batch.
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// BatchInput is a list of create, update and delete operations applied in one request.
+// Mode is BatchAtomic (the default) or BatchBestEffort.
+type BatchInput struct {
+	Mode       string           `json:"mode,omitempty"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is a single operation of a batch. Op is "create", "update" or "delete".
+// ID is required for updates and deletes, and Version is the version the client expects
+// the movie to have, if not zero. Movie holds the fields of the movie for creates (a
+// CreateMovieInput), or the fields to change for updates (an UpdateMovieInput).
+type BatchOperation struct {
+	Op      string `json:"op"`
+	ID      int64  `json:"id,omitempty"`
+	Version int32  `json:"version,omitempty"`
+	Movie   any    `json:"movie,omitempty"`
+}
+
+// BatchResult is the outcome of a single operation of a batch. Status is the HTTP status
+// code the operation would have had as a request of its own. When the operation failed,
+// Code is the stable code of its error and Error its message, and Errors holds the
+// validation errors of a validation failure.
+type BatchResult struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	Status int          `json:"status"`
+	ID     int64        `json:"id,omitempty"`
+	Movie  *Movie       `json:"movie,omitempty"`
+	Code   string       `json:"code,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// MovieChanges holds the movies changed and deleted since a sync token. NextToken is the
+// token to pass to the next call, straight away if HasMore is true.
+type MovieChanges struct {
+	Movies     []*Movie    `json:"movies"`
+	Tombstones []Tombstone `json:"tombstones"`
+	Sync       struct {
+		NextToken string `json:"next_token"`
+		HasMore   bool   `json:"has_more"`
+	} `json:"sync"`
+}
+
+// MovieList is a page of movies, with the counts of any facets which were asked for.
+type MovieList struct {
+	Movies   []*Movie                 `json:"movies"`
+	Metadata Metadata                 `json:"metadata"`
+	Facets   map[string][]FacetBucket `json:"facets,omitempty"`
+}
+
+// RegisterUserInput holds the details of a new user.
+type RegisterUserInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// CredentialsInput holds a user's email address and password.
+type CredentialsInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// PageParams are the pagination and sorting parameters of the list endpoints. Zero values
+// are left out, so the API's defaults apply.
+type PageParams struct {
+	Page     int
+	PageSize int
+	Sort     string
+}
+
+func (p PageParams) encode(qs url.Values) {
+	setInt(qs, "page", p.Page)
+	setInt(qs, "page_size", p.PageSize)
+	setString(qs, "sort", p.Sort)
+}
+
+// Condition is a filter expression, such as {Field: "year", Op: "gte", Value: "1990"}
+// for filter[year][gte]=1990. Lists of values, for the "in" and "contains" operators, are
+// comma-separated. An empty Op uses the field's default operator.
+type Condition struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// FilterParams are the filter parameters shared by the movie list, export and statistics
+// endpoints: a full-text search of the titles, genres every movie must have, and filter
+// expressions.
+type FilterParams struct {
+	Title   string
+	Genres  []string
+	Filters []Condition
+}
+
+func (p FilterParams) encode(qs url.Values) {
+	setString(qs, "title", p.Title)
+	setList(qs, "genres", p.Genres)
+
+	for _, c := range p.Filters {
+		key := "filter[" + c.Field + "]"
+		if c.Op != "" {
+			key += "[" + c.Op + "]"
+		}
+		qs.Add(key, c.Value)
+	}
+}
+
+// ProjectionParams choose the fields of each movie and the related resources embedded in
+// it, and the languages its display_title is chosen from (overriding the client's
+// Accept-Language header).
+type ProjectionParams struct {
+	Fields  []string
+	Include []string
+	Lang    string
+}
+
+func (p ProjectionParams) encode(qs url.Values) {
+	setList(qs, "fields", p.Fields)
+	setList(qs, "include", p.Include)
+	setString(qs, "lang", p.Lang)
+}
+
+// ListMoviesParams are the parameters of the movie list.
+type ListMoviesParams struct {
+	FilterParams
+	ProjectionParams
+	PageParams
+	Facets []string
+}
+
+// ExportParams are the parameters of a movie export. Format is "csv", "ndjson" or "json"
+// (the default).
+type ExportParams struct {
+	FilterParams
+	Format string
+	Sort   string
+}
+
+// ListSubmissionsParams are the parameters of the moderation list. Status is "draft",
+// "pending" (the default), "published" or "rejected".
+type ListSubmissionsParams struct {
+	PageParams
+	Status string
+}
+
+// DuplicateParams are the parameters of the duplicate detection endpoints. MinScore is
+// the lowest similarity score returned (0.7 by default), and Limit the largest number of
+// candidates.
+type DuplicateParams struct {
+	MinScore float64
+	Limit    int
+}
+
+func (p DuplicateParams) encode(qs url.Values) {
+	if p.MinScore != 0 {
+		qs.Set("min_score", strconv.FormatFloat(p.MinScore, 'f', -1, 64))
+	}
+	setInt(qs, "limit", p.Limit)
+}
+
+// ImportParams are the parameters of a movie import. Format is "csv" or "ndjson". Mode is
+// "insert" (the default) or "upsert". DryRun checks the file without importing it, and
+// Async imports it with a background job whatever its size.
+type ImportParams struct {
+	Format string
+	Mode   string
+	DryRun bool
+	Async  bool
+}
+
+// ImportResult is the outcome of an import: a Report if the file was imported straight
+// away, or a Job to poll with ImportJob if it is being imported in the background.
+type ImportResult struct {
+	Report *ImportReport
+	Job    *ImportJob
+}
+
+// UploadImageInput is an image to upload. Kind is "poster" or "backdrop", and Image holds
+// the JPEG, PNG or GIF file.
+type UploadImageInput struct {
+	Kind     string
+	Filename string
+	Image    []byte
+}
+
+// StatsParams are the parameters of the catalogue statistics. GroupBy is empty, "genre",
+// "year", "decade" or "month".
+type StatsParams struct {
+	FilterParams
+	GroupBy string
+}
+
+// ReleaseInput is a movie's release date (YYYY-MM-DD) and certification in a country.
+type ReleaseInput struct {
+	Date          string `json:"date"`
+	Certification string `json:"certification,omitempty"`
+}
+
+func setString(qs url.Values, key, value string) {
+	if value != "" {
+		qs.Set(key, value)
+	}
+}
+
+func setInt(qs url.Values, key string, value int) {
+	if value != 0 {
+		qs.Set(key, strconv.Itoa(value))
+	}
+}
+
+func setList(qs url.Values, key string, values []string) {
+	if len(values) > 0 {
+		qs.Set(key, strings.Join(values, ","))
+	}
+}
+
+// Ptr returns a pointer to the value, for the optional fields of UpdateMovieInput.
+func Ptr[T any](value T) *T {
+	return &value
+}
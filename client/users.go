@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// userResponse is the envelope of the endpoints which return a user.
+type userResponse struct {
+	User *User `json:"user"`
+}
+
+// RegisterUser registers a user, who is sent an email with a token to activate their
+// account with ActivateUser.
+func (c *Client) RegisterUser(ctx context.Context, input RegisterUserInput) (*User, error) {
+	req, err := newRequest(http.MethodPost, "/v1/users", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp userResponse
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.User, nil
+}
+
+// ActivateUser activates a user's account with the token from their activation email.
+func (c *Client) ActivateUser(ctx context.Context, token string) (*User, error) {
+	req, err := newRequest(http.MethodPut, "/v1/users/activated", map[string]string{"token": token})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp userResponse
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.User, nil
+}
+
+// CreateAuthenticationToken creates an authentication token from a user's email address
+// and password. Pass its Plaintext to SetToken to make requests as the user.
+func (c *Client) CreateAuthenticationToken(ctx context.Context, input CredentialsInput) (*Token, error) {
+	req, err := newRequest(http.MethodPost, "/v1/tokens/authentication", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Token *Token `json:"authentication_token"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Token, nil
+}
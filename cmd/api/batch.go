@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// Define constants for the modes of a movie batch. In atomic mode all of the operations are
+// applied in a single transaction, and none of them take effect if any one fails. In
+// best-effort mode each operation is applied on its own, whatever happens to the others.
+const (
+	batchModeAtomic     = "atomic"
+	batchModeBestEffort = "best_effort"
+)
+
+// maxBatchOperations is the maximum number of operations accepted in a single batch.
+const maxBatchOperations = 100
+
+// movieStore is implemented by both data.MovieModel and *data.MovieTx, so that batch
+// operations can be applied either on their own or as part of a single transaction.
+type movieStore interface {
+	Get(id int64) (*data.Movie, error)
+	Insert(movie *data.Movie, userID int64) error
+	Update(movie *data.Movie, userID int64) error
+	Delete(id int64, version int32, userID int64) error
+}
+
+// batchOperation is a single operation of a movie batch. Op is "create", "update" or
+// "delete". ID is required for updates and deletes. Version is the version of the movie the
+// client expects, and is optional. Movie holds the fields of the movie for creates, or the
+// fields to change for updates, in the same format as POST and PATCH /v1/movies.
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Version int32           `json:"version"`
+	Movie   json.RawMessage `json:"movie"`
+}
+
+// batchResult is the outcome of a single operation of a movie batch. Status is the HTTP
+// status code the operation would have had as a request of its own. When the operation
+// failed, Code, Reason, Error and Errors are set to the "code", "reason", "detail" and
+// "errors" members of that response's problem details, so a failed validation is reported with the same list
+// of coded field errors as failedValidationResponse sends.
+type batchResult struct {
+	Index  int                    `json:"index"`
+	Op     string                 `json:"op"`
+	Status int                    `json:"status"`
+	ID     int64                  `json:"id,omitempty"`
+	Movie  *data.Movie            `json:"movie,omitempty"`
+	Code   string                 `json:"code,omitempty"`
+	Reason string                 `json:"reason,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+	Errors []validator.FieldError `json:"errors,omitempty"`
+}
+
+// batchMoviesHandler handles HTTP POST requests to apply a list of create, update and delete
+// operations to the movies in one request. The request body has the form:
+//
+//	{"mode": "atomic", "operations": [{"op": "update", "id": 1, "version": 3, "movie": {...}}, ...]}
+//
+// The response holds a result for each operation, in the same order. In best-effort mode
+// the response is always 200 OK and each result reports its own outcome. In atomic mode
+// (the default) the response is 200 OK if every operation succeeded; otherwise the batch is
+// rolled back, the response has the status of the first failed operation, and every other
+// operation is reported as 424 Failed Dependency.
+func (app *application) batchMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Mode == "" {
+		input.Mode = batchModeAtomic
+	}
+
+	v := validator.New()
+
+	v.Apply("mode", validator.Enum(input.Mode, batchModeAtomic, batchModeBestEffort).WithMessage("batch_mode"))
+	v.Apply("operations",
+		validator.MinItems(input.Operations, 1).WithMessage("batch_operations_min"),
+		validator.MaxItems(input.Operations, maxBatchOperations).WithMessage("batch_operations_max"),
+	)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+	locale := app.errorLocale(w, r)
+	results := make([]batchResult, len(input.Operations))
+
+	if input.Mode == batchModeBestEffort {
+		for i, op := range input.Operations {
+			result, err := app.applyBatchOperation(app.models.Movies, op, userID, locale)
+			if err != nil {
+				// An unexpected error only fails the operation it happened in.
+				app.logError(r, err)
+				result = batchResult{Op: op.Op, Status: http.StatusInternalServerError, Code: codeServerError, Error: errorMessage(locale, codeServerError, nil)}
+			}
+
+			result.Index = i
+			results[i] = result
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Apply the operations in a single transaction. Rollback is a no-op once the
+	// transaction has been committed.
+	tx, err := app.models.Movies.BeginTx()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	for i, op := range input.Operations {
+		result, err := app.applyBatchOperation(tx, op, userID, locale)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		result.Index = i
+		results[i] = result
+
+		if result.Code == "" {
+			continue
+		}
+
+		// The operation failed, so none of the batch is applied. Report every other
+		// operation as not applied, and use the status of the failure for the response.
+		for j, other := range input.Operations {
+			if j == i {
+				continue
+			}
+
+			results[j] = batchResult{
+				Index:  j,
+				Op:     other.Op,
+				Status: http.StatusFailedDependency,
+				Code:   codeFailedDependency,
+				Error:  errorMessage(locale, codeFailedDependency, messageParams{"index": i}),
+			}
+		}
+
+		err = app.writeJSON(w, result.Status, envelope{"results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// applyBatchOperation applies a single batch operation using the given store, attributing
+// any revision to the given user. Failures which the client can act on, such as validation
+// errors and edit conflicts, are reported in the result, with messages in the given locale;
+// only unexpected errors are returned.
+func (app *application) applyBatchOperation(store movieStore, op batchOperation, userID int64, locale string) (batchResult, error) {
+	result := batchResult{Op: op.Op, ID: op.ID}
+
+	// fail sets the status, code and error message of the result, as they would be in the
+	// error response for a request of its own.
+	fail := func(status int, code string, message string) (batchResult, error) {
+		result.Status = status
+		result.Code = code
+		result.Error = message
+		return result, nil
+	}
+
+	// failValidation fails the result with the errors of the validator, as they would be in
+	// the response of failedValidationResponse.
+	failValidation := func(v *validator.Validator) (batchResult, error) {
+		result.Errors = v.Localized(locale)
+		return fail(http.StatusUnprocessableEntity, codeValidationFailed, errorMessage(locale, codeValidationFailed, nil))
+	}
+
+	// badRequest fails the result with the message and reason of a bad request error, as
+	// they would be in the response of badRequestResponse.
+	badRequest := func(err error) (batchResult, error) {
+		message, reason := badRequestMessage(locale, err)
+		result.Reason = reason
+		return fail(http.StatusBadRequest, codeBadRequest, message)
+	}
+
+	// invalid fails the result with a single validation error for the field.
+	invalid := func(field, code string) (batchResult, error) {
+		v := validator.New()
+		v.AddErrorCode(field, code, nil)
+		return failValidation(v)
+	}
+
+	// A missing movie member decodes as nothing, as does an explicit null.
+	hasMovie := len(op.Movie) > 0 && !bytes.Equal(op.Movie, []byte("null"))
+
+	switch op.Op {
+	case "create":
+		if op.ID != 0 {
+			return invalid("id", "batch_id_on_create")
+		}
+		if !hasMovie {
+			return invalid("movie", "required")
+		}
+
+		var changes movieChanges
+
+		err := app.decodeJSON(bytes.NewReader(op.Movie), &changes)
+		if err != nil {
+			return badRequest(err)
+		}
+
+		movie := &data.Movie{}
+		changes.apply(movie)
+
+		v := validator.New()
+		if data.ValidateMovie(v, movie); !v.Valid() {
+			return failValidation(v)
+		}
+
+		err = store.Insert(movie, userID)
+		if err != nil {
+			return result, err
+		}
+
+		result.Status = http.StatusCreated
+		result.ID = movie.ID
+		result.Movie = movie
+		return result, nil
+
+	case "update":
+		if !hasMovie {
+			return invalid("movie", "required")
+		}
+
+		var changes movieChanges
+
+		err := app.decodeJSON(bytes.NewReader(op.Movie), &changes)
+		if err != nil {
+			return badRequest(err)
+		}
+
+		movie, err := store.Get(op.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return fail(http.StatusNotFound, codeNotFound, errorMessage(locale, codeNotFound, nil))
+			default:
+				return result, err
+			}
+		}
+
+		// If the client gave the version it expects, the movie must still have it.
+		if op.Version != 0 && op.Version != movie.Version {
+			return fail(http.StatusConflict, codeEditConflict, errorMessage(locale, codeEditConflict, nil))
+		}
+
+		changes.apply(movie)
+
+		v := validator.New()
+		if data.ValidateMovie(v, movie); !v.Valid() {
+			return failValidation(v)
+		}
+
+		err = store.Update(movie, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return fail(http.StatusConflict, codeEditConflict, errorMessage(locale, codeEditConflict, nil))
+			default:
+				return result, err
+			}
+		}
+
+		result.Status = http.StatusOK
+		result.Movie = movie
+		return result, nil
+
+	case "delete":
+		err := store.Delete(op.ID, op.Version, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return fail(http.StatusNotFound, codeNotFound, errorMessage(locale, codeNotFound, nil))
+			case errors.Is(err, data.ErrEditConflict):
+				return fail(http.StatusConflict, codeEditConflict, errorMessage(locale, codeEditConflict, nil))
+			default:
+				return result, err
+			}
+		}
+
+		result.Status = http.StatusOK
+		return result, nil
+
+	default:
+		return invalid("op", "batch_op")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"greenlight.tomcat.net/internal/data"
+)
+
+// fakeMovieStore is an in-memory movieStore.
+type fakeMovieStore struct {
+	movies map[int64]*data.Movie
+	nextID int64
+}
+
+func newFakeMovieStore(movies ...*data.Movie) *fakeMovieStore {
+	store := &fakeMovieStore{movies: make(map[int64]*data.Movie), nextID: 100}
+	for _, movie := range movies {
+		store.movies[movie.ID] = movie
+	}
+	return store
+}
+
+func (s *fakeMovieStore) Get(id int64) (*data.Movie, error) {
+	movie, ok := s.movies[id]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+	clone := *movie
+	return &clone, nil
+}
+
+func (s *fakeMovieStore) Insert(movie *data.Movie, userID int64) error {
+	s.nextID++
+	movie.ID = s.nextID
+	movie.Version = 1
+	s.movies[movie.ID] = movie
+	return nil
+}
+
+func (s *fakeMovieStore) Update(movie *data.Movie, userID int64) error {
+	if s.movies[movie.ID].Version != movie.Version {
+		return data.ErrEditConflict
+	}
+	movie.Version++
+	s.movies[movie.ID] = movie
+	return nil
+}
+
+func (s *fakeMovieStore) Delete(id int64, version int32, userID int64) error {
+	movie, ok := s.movies[id]
+	if !ok {
+		return data.ErrRecordNotFound
+	}
+	if version != 0 && movie.Version != version {
+		return data.ErrEditConflict
+	}
+	delete(s.movies, id)
+	return nil
+}
+
+func TestApplyBatchOperation(t *testing.T) {
+	app := newTestApplication(t)
+
+	store := newFakeMovieStore(&data.Movie{ID: 1, Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime"}, Version: 3})
+
+	tests := []struct {
+		name       string
+		op         batchOperation
+		wantStatus int
+		wantCode   string
+		wantReason string
+		wantFields []string
+	}{
+		{
+			name:       "create",
+			op:         batchOperation{Op: "create", Movie: json.RawMessage(`{"title":"Up","year":2009,"runtime":"96 mins","genres":["animation"]}`)},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "invalid create",
+			op:         batchOperation{Op: "create", Movie: json.RawMessage(`{"title":"","year":1800,"runtime":"96 mins","genres":["animation"]}`)},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   codeValidationFailed,
+			wantFields: []string{"title", "year"},
+		},
+		{
+			name:       "create without movie",
+			op:         batchOperation{Op: "create"},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   codeValidationFailed,
+			wantFields: []string{"movie"},
+		},
+		{
+			name:       "unknown op",
+			op:         batchOperation{Op: "upsert"},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   codeValidationFailed,
+			wantFields: []string{"op"},
+		},
+		{
+			name:       "malformed movie",
+			op:         batchOperation{Op: "create", Movie: json.RawMessage(`{"title":1}`)},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   codeBadRequest,
+			wantReason: "body_json_type_field",
+		},
+		{
+			name:       "stale update",
+			op:         batchOperation{Op: "update", ID: 1, Version: 2, Movie: json.RawMessage(`{"title":"Heat (1995)"}`)},
+			wantStatus: http.StatusConflict,
+			wantCode:   codeEditConflict,
+		},
+		{
+			name:       "update",
+			op:         batchOperation{Op: "update", ID: 1, Version: 3, Movie: json.RawMessage(`{"title":"Heat (1995)"}`)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delete missing",
+			op:         batchOperation{Op: "delete", ID: 42},
+			wantStatus: http.StatusNotFound,
+			wantCode:   codeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := app.applyBatchOperation(store, tt.op, 1, "fr")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Status != tt.wantStatus || result.Code != tt.wantCode {
+				t.Errorf("got status %d and code %q; want %d and %q", result.Status, result.Code, tt.wantStatus, tt.wantCode)
+			}
+
+			if tt.wantCode != "" && result.Error == "" {
+				t.Error("got no error message")
+			}
+			if result.Reason != tt.wantReason {
+				t.Errorf("got reason %q; want %q", result.Reason, tt.wantReason)
+			}
+
+			var fields []string
+			for _, fe := range result.Errors {
+				if fe.Code == "" || fe.Message == "" {
+					t.Errorf("field error %+v has no code or message", fe)
+				}
+				if len(fields) == 0 || fields[len(fields)-1] != fe.Field {
+					fields = append(fields, fe.Field)
+				}
+			}
+
+			if len(fields) != len(tt.wantFields) {
+				t.Fatalf("got errors for %v; want %v", fields, tt.wantFields)
+			}
+			for i := range fields {
+				if fields[i] != tt.wantFields[i] {
+					t.Errorf("got errors for %v; want %v", fields, tt.wantFields)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// listMovieChangesHandler handles GET requests for the changes to the published catalogue
+// since a sync token, so that clients which keep their own copy of the catalogue (such as
+// the mobile app, offline) only download what has changed. A request without the since
+// parameter starts from the beginning, returning every movie. The response holds the
+// movies created or updated since the token, oldest change first, a tombstone for each
+// movie deleted since then, and a sync object:
+//
+//	{"movies": [...], "tombstones": [{"id": 12, "deleted_at": "..."}],
+//	 "sync": {"next_token": "...", "has_more": false}}
+//
+// The client passes next_token as the since parameter of its next request, straight away
+// if has_more is true, or at its next sync otherwise. The page_size parameter (default
+// 100, at most 1000) limits how many changes are returned at a time. Changes only become
+// visible after data.ChangesSettleDelay, so that no change is ever skipped.
+func (app *application) listMovieChangesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	since, err := data.ParseSyncToken(qs.Get("since"))
+	if err != nil {
+		v.AddErrorCode("since", "sync_token", nil)
+	}
+
+	pageSize := app.readInt(qs, "page_size", 100, v)
+
+	v.Apply("page_size",
+		validator.Min(pageSize, 1).WithMessage("greater_than_zero"),
+		validator.Max(pageSize, 1000).WithMessage("maximum"),
+	)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	changes, err := app.models.Movies.GetChangesSince(since, pageSize)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.presentMovies(w, r, changes.Movies...)
+
+	sync := envelope{"next_token": changes.Next.String(), "has_more": changes.HasMore}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": changes.Movies, "tombstones": changes.Tombstones, "sync": sync}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"greenlight.tomcat.net/client"
+	"greenlight.tomcat.net/internal/data"
+)
+
+// These tests run the client against an httptest server serving the real routes, so that
+// the client and the API are checked against each other rather than against fixtures.
+
+// newClientTestServer starts a server for the application's routes, wrapped by wrap if it
+// isn't nil, and returns a client for it which retries quickly.
+func newClientTestServer(t *testing.T, app *application, wrap func(http.Handler) http.Handler, opts ...client.Option) *client.Client {
+	t.Helper()
+
+	var handler http.Handler = app.routes()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	opts = append([]client.Option{client.WithRetries(3, time.Millisecond, 100*time.Millisecond)}, opts...)
+
+	c, err := client.New(ts.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientPublicRoutes(t *testing.T) {
+	app := newOpenAPITestApplication(t, true)
+	app.config.env = "testing"
+
+	c := newClientTestServer(t, app, nil)
+
+	health, err := c.Healthcheck(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "available" || health.SystemInfo.Environment != "testing" {
+		t.Errorf("got health %+v", health)
+	}
+
+	doc, err := c.OpenAPIDocument(context.Background())
+	if err != nil || len(doc) == 0 {
+		t.Errorf("got document of %d bytes and error %v", len(doc), err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	app := newOpenAPITestApplication(t, true)
+
+	t.Run("Authentication required", func(t *testing.T) {
+		c := newClientTestServer(t, app, nil)
+
+		_, err := c.GetMovie(context.Background(), 1, client.ProjectionParams{})
+
+		var authErr *client.AuthError
+		if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusUnauthorized || authErr.Code != client.CodeAuthenticationRequired {
+			t.Errorf("got error %v; want an AuthError", err)
+		}
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		c := newClientTestServer(t, app, nil, client.WithToken("not-a-token"))
+
+		_, err := c.GetMovie(context.Background(), 1, client.ProjectionParams{})
+
+		var authErr *client.AuthError
+		if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusUnauthorized {
+			t.Errorf("got error %v; want an AuthError", err)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		language string
+		want     string
+	}{
+		{"Validation failed", "", "must be provided"},
+		{"Validation failed in French", "fr", "doit être renseigné"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClientTestServer(t, app, nil, client.WithLanguage(tt.language))
+
+			// Invalid credentials are rejected before the database is queried.
+			_, err := c.CreateAuthenticationToken(context.Background(), client.CredentialsInput{Email: "", Password: "pa55word"})
+
+			var validationErr *client.ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Code != client.CodeValidationFailed {
+				t.Fatalf("got error %v; want a ValidationError", err)
+			}
+
+			if got := validationErr.FieldErrors()["email"]; len(got) == 0 || got[0] != tt.want {
+				t.Errorf("got email errors %q; want %q first", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	t.Run("Rate limited", func(t *testing.T) {
+		app := newOpenAPITestApplication(t, false)
+		app.config.limiter.enabled = true
+		app.config.limiter.rps = 20
+		app.config.limiter.burst = 1
+
+		// The API asks for a wait of 1s (Retry-After is in whole seconds), which the client
+		// caps at its maximum backoff; by then the limiter allows another request.
+		c := newClientTestServer(t, app, nil)
+
+		for i := range 3 {
+			if _, err := c.Healthcheck(context.Background()); err != nil {
+				t.Fatalf("request %d: %v", i+1, err)
+			}
+		}
+	})
+
+	t.Run("Rate limited without retries", func(t *testing.T) {
+		app := newOpenAPITestApplication(t, false)
+		app.config.limiter.enabled = true
+		app.config.limiter.rps = 0.1
+		app.config.limiter.burst = 1
+
+		c := newClientTestServer(t, app, nil, client.WithRetries(0, 0, 0))
+
+		if _, err := c.Healthcheck(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := c.Healthcheck(context.Background())
+
+		var rateLimitErr *client.RateLimitError
+		if !errors.As(err, &rateLimitErr) {
+			t.Fatalf("got error %v; want a RateLimitError", err)
+		}
+		if rateLimitErr.RetryAfter != 10*time.Second || rateLimitErr.Code != client.CodeRateLimitExceeded {
+			t.Errorf("got RetryAfter %v and code %q; want 10s", rateLimitErr.RetryAfter, rateLimitErr.Code)
+		}
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		app := newOpenAPITestApplication(t, false)
+
+		// Answer the first two requests as a proxy would while the API restarts.
+		var requests atomic.Int32
+		unavailable := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= 2 {
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}
+
+		c := newClientTestServer(t, app, unavailable)
+
+		health, err := c.Healthcheck(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if health.Status != "available" || requests.Load() != 3 {
+			t.Errorf("got health %+v after %d requests; want 3", health, requests.Load())
+		}
+	})
+}
+
+// TestClientMoviesIterator pages through movies listed by the real handlers, so it needs a
+// database (see newTestDB).
+func TestClientMoviesIterator(t *testing.T) {
+	app := newOpenAPITestApplication(t, true)
+	app.models = data.NewModels(newTestDB(t))
+
+	// Create a user who can read movies, and movies with a genre no other movie has.
+	user, _ := newTestUser(t, app, "movies:read")
+
+	genre := fmt.Sprintf("genre-%d", time.Now().UnixNano())
+	for i := range 5 {
+		movie := &data.Movie{Title: fmt.Sprintf("Movie %d", i+1), Year: 2000 + int32(i), Runtime: 100, Genres: []string{genre}}
+		if err := app.models.Movies.Insert(movie, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { app.models.Movies.DB.Exec("DELETE FROM movies WHERE id = $1", movie.ID) })
+	}
+
+	c := newClientTestServer(t, app, nil)
+
+	token, err := c.CreateAuthenticationToken(context.Background(), client.CredentialsInput{Email: user.Email, Password: "pa55word"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetToken(token.Plaintext)
+
+	params := client.ListMoviesParams{
+		FilterParams: client.FilterParams{Genres: []string{genre}},
+		PageParams:   client.PageParams{PageSize: 2, Sort: "year"},
+	}
+
+	var titles []string
+	for movie, err := range c.Movies(context.Background(), params) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		titles = append(titles, movie.Title)
+	}
+
+	if len(titles) != 5 || titles[0] != "Movie 1" || titles[4] != "Movie 5" {
+		t.Errorf("got movies %q; want Movie 1 to Movie 5", titles)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// readDuplicateFilters reads the min_score (default 0.7) and limit (default 20) query
+// parameters shared by the duplicate detection endpoints.
+func (app *application) readDuplicateFilters(r *http.Request, v *validator.Validator) (minScore float64, limit int) {
+	qs := r.URL.Query()
+
+	minScore = app.readFloat(qs, "min_score", 0.7, v)
+	limit = app.readInt(qs, "limit", 20, v)
+
+	v.Apply("min_score", validator.Range(minScore, 0, 1))
+	v.Apply("limit",
+		validator.Min(limit, 1).WithMessage("greater_than_zero"),
+		validator.Max(limit, 100).WithMessage("maximum"),
+	)
+
+	return minScore, limit
+}
+
+// listMovieDuplicatesHandler handles GET requests for the movies which look like duplicates
+// of an existing movie. Each candidate is scored from 0 to 1 by the similarity of its title,
+// year and runtime, and only candidates scoring at least min_score are returned, most
+// similar first. As with showMovieHandler, the movie must be visible to the current user, and
+// only published movies are offered as candidates.
+func (app *application) listMovieDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	minScore, limit := app.readDuplicateFilters(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie := app.getVisibleMovie(w, r, id, data.MovieProjection{Fields: []string{"title", "year", "runtime"}})
+	if movie == nil {
+		return
+	}
+
+	duplicates, err := app.models.Movies.FindDuplicates(movie, minScore, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"duplicates": duplicates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkDuplicatesHandler handles GET requests to check whether a movie which hasn't been
+// created yet would duplicate an existing one, given its title, year and (optionally)
+// runtime in minutes as query parameters. Results are scored as for
+// listMovieDuplicatesHandler.
+func (app *application) checkDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	movie := &data.Movie{
+		Title:   app.readString(qs, "title", ""),
+		Year:    int32(app.readInt(qs, "year", 0, v)),
+		Runtime: data.Runtime(app.readInt(qs, "runtime", 0, v)),
+	}
+
+	v.Apply("title", validator.Required(movie.Title))
+	v.Apply("year", validator.Required(movie.Year))
+	v.Apply("runtime", validator.Min(int32(movie.Runtime), 0).WithMessage("positive"))
+
+	minScore, limit := app.readDuplicateFilters(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	duplicates, err := app.models.Movies.FindDuplicates(movie, minScore, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"duplicates": duplicates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeMovieHandler handles POST requests to merge a duplicate movie into the movie in the
+// URL, given a request body such as {"duplicate_id": 42}. The duplicate's related rows (such
+// as its external IDs) are moved to the movie, and the duplicate is moved to the trash. The
+// movie keeps its own fields, and is returned with its new version. The external IDs,
+// alternate titles and releases which clashed with the movie's own, and so stayed with the
+// duplicate, are returned in "dropped", so that the client can apply any it still wants.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		DuplicateID int64 `json:"duplicate_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Apply("duplicate_id",
+		validator.Required(input.DuplicateID),
+		validator.Min(input.DuplicateID, 0).WithMessage("positive"),
+	)
+	v.Apply("duplicate_id", validator.Assert(input.DuplicateID != id, "duplicate_same_movie"))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie, dropped, err := app.models.Movies.Merge(id, input.DuplicateID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.presentMovies(w, r, movie)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieRepresentationETag(r, movie.Version, data.MovieProjection{}))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie, "dropped": dropped}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
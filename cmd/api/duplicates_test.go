@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.tomcat.net/internal/data"
+)
+
+// TestMergeMovieDropped checks that merging a duplicate reports the external IDs, titles
+// and releases which clashed with the kept movie's own, and moves the others. It needs a
+// database (see newTestDB).
+func TestMergeMovieDropped(t *testing.T) {
+	app := newTestApplication(t)
+	app.models = data.NewModels(newTestDB(t))
+
+	_, token := newTestUser(t, app, "movies:read", "movies:merge")
+
+	suffix := time.Now().UnixNano()
+
+	keep := &data.Movie{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama"}}
+	duplicate := &data.Movie{Title: "Casablanca", Year: 1942, Runtime: 103, Genres: []string{"romance"}}
+
+	for _, movie := range []*data.Movie{keep, duplicate} {
+		if err := app.models.Movies.Insert(movie, 0); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { app.models.Movies.DB.Exec("DELETE FROM movies WHERE id = $1", movie.ID) })
+	}
+
+	setup := []error{
+		app.models.Movies.SetExternalID(keep.ID, "imdb", fmt.Sprintf("tt%d", suffix)),
+		app.models.Movies.SetExternalID(duplicate.ID, "imdb", fmt.Sprintf("tt%d", suffix+1)),
+		app.models.Movies.SetExternalID(duplicate.ID, "tmdb", fmt.Sprint(suffix)),
+		app.models.Movies.SetAlternateTitle(keep.ID, "fr", "Casablanca"),
+		app.models.Movies.SetAlternateTitle(duplicate.ID, "fr", "Casablanca (VF)"),
+		app.models.Movies.SetAlternateTitle(duplicate.ID, "de", "Casablanca (DE)"),
+		app.models.Movies.SetRelease(keep.ID, &data.Release{Country: "US", Date: "1943-01-23"}),
+		app.models.Movies.SetRelease(duplicate.ID, &data.Release{Country: "US", Date: "1942-11-26"}),
+	}
+	for _, err := range setup {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/movies/%d/merge", keep.ID), strings.NewReader(fmt.Sprintf(`{"duplicate_id": %d}`, duplicate.ID)))
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	var resp struct {
+		Movie   data.Movie        `json:"movie"`
+		Dropped data.MergeDropped `json:"dropped"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	wantDropped := data.MergeDropped{
+		ExternalIDs:     data.ExternalIDs{"imdb": fmt.Sprintf("tt%d", suffix+1)},
+		AlternateTitles: data.AlternateTitles{"fr": "Casablanca (VF)"},
+		Releases:        data.Releases{{Country: "US", Date: "1942-11-26"}},
+	}
+	if !maps.Equal(resp.Dropped.ExternalIDs, wantDropped.ExternalIDs) ||
+		!maps.Equal(resp.Dropped.AlternateTitles, wantDropped.AlternateTitles) ||
+		len(resp.Dropped.Releases) != 1 || resp.Dropped.Releases[0] != wantDropped.Releases[0] {
+		t.Errorf("got dropped %+v; want %+v", resp.Dropped, wantDropped)
+	}
+
+	// The rows which didn't clash were moved, and the kept movie's own are unchanged.
+	if got := resp.Movie.ExternalIDs["tmdb"]; got != fmt.Sprint(suffix) {
+		t.Errorf("got tmdb ID %q; want it moved from the duplicate", got)
+	}
+	if got := resp.Movie.AlternateTitles; got["de"] != "Casablanca (DE)" || got["fr"] != "Casablanca" {
+		t.Errorf("got alternate titles %v", got)
+	}
+}
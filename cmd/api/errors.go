@@ -1,8 +1,13 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+
+	"greenlight.tomcat.net/internal/i18n"
+	"greenlight.tomcat.net/internal/validator"
 )
 
 // logError logs error details including HTTP method and URI from the request.
@@ -19,19 +24,190 @@ func (app *application) logError(r *http.Request, err error) {
 	app.logger.Error(err.Error(), "method", method, "uri", uri)
 }
 
-// errorResponse sends a JSON-formatted error message with the given status code.
-// It accepts:
-// - w: http.ResponseWriter to write the response
-// - r: *http.Request for request context logging
-// - status: HTTP status code to send
-// - message: error message or data to send in the response (can be any type)
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	// Wrap the message in an envelope with "error" key for consistent JSON structure
-	env := envelope{"error": message}
+// The stable, machine-readable codes of the error responses below. Each is sent as the
+// "code" member of a problem details object, and names the problem type in its "type" URI,
+// so that clients can tell errors apart without matching on their English messages.
+const (
+	codeServerError                = "server_error"
+	codeNotFound                   = "not_found"
+	codeMethodNotAllowed           = "method_not_allowed"
+	codeBadRequest                 = "bad_request"
+	codeValidationFailed           = "validation_failed"
+	codeEditConflict               = "edit_conflict"
+	codePreconditionFailed         = "precondition_failed"
+	codePatchTestFailed            = "patch_test_failed"
+	codeInvalidStatusTransition    = "invalid_status_transition"
+	codeUnsupportedMediaType       = "unsupported_media_type"
+	codeIdempotencyKeyMismatch     = "idempotency_key_mismatch"
+	codeIdempotencyKeyInUse        = "idempotency_key_in_use"
+	codeRateLimitExceeded          = "rate_limit_exceeded"
+	codeInvalidCredentials         = "invalid_credentials"
+	codeInvalidAuthenticationToken = "invalid_authentication_token"
+	codeAuthenticationRequired     = "authentication_required"
+	codeInactiveAccount            = "inactive_account"
+	codeNotPermitted               = "not_permitted"
+	codeFailedDependency           = "failed_dependency"
+)
+
+// messageParams holds the values of the placeholders of an error message, such as the
+// {method} of the method_not_allowed message.
+type messageParams map[string]any
+
+// errorMessage returns the message of the error with the given code in the locale, from the
+// "error.<code>.detail" entry of the i18n catalogs. The messages of error responses and the
+// per-operation results of a movie batch both come from here, so that they describe the
+// same errors in the same words.
+func errorMessage(locale, code string, params messageParams) string {
+	return i18n.Translate(locale, "error."+code+".detail", params)
+}
+
+// requestError is a problem with a request which makes it a bad request, such as a body
+// which isn't valid JSON. Its reason is a stable code, sent as the "reason" member of the
+// problem, which names its message in the i18n catalogs ("error.bad_request.<reason>");
+// params holds the values of the message's placeholders.
+type requestError struct {
+	reason string
+	params messageParams
+}
+
+// newRequestError returns a requestError with the given reason and message parameters.
+func newRequestError(reason string, params messageParams) *requestError {
+	return &requestError{reason: reason, params: params}
+}
+
+// Error returns the English message of the error.
+func (e *requestError) Error() string {
+	return e.message(i18n.DefaultLocale)
+}
+
+// message returns the message of the error in the locale.
+func (e *requestError) message(locale string) string {
+	return i18n.Translate(locale, "error."+codeBadRequest+"."+e.reason, e.params)
+}
+
+// badRequestMessage returns the message and reason of a bad request error in the locale.
+// Errors other than requestErrors have no reason or translation, so their message is the
+// English text of the error.
+func badRequestMessage(locale string, err error) (message, reason string) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.message(locale), reqErr.reason
+	}
+
+	return err.Error(), ""
+}
+
+// errorLocale returns the locale to send error messages in, which is the supported locale
+// best matching the lang parameter or Accept-Language header of the request.
+func (app *application) errorLocale(w http.ResponseWriter, r *http.Request) string {
+	return i18n.Match(app.readLocales(w, r))
+}
+
+// problemTypeBase is the base of the "type" URI of every problem, which is followed by the
+// problem's code.
+const problemTypeBase = "https://greenlight.tomcat.net/problems/"
+
+// The media types of error responses. Errors are sent as RFC 7807 problem details unless the
+// client asks for the legacy {"error": ...} shape by listing legacyErrorMediaType in its
+// Accept header, which existing clients can do while they move to problem details. Legacy
+// error responses are still sent as application/json.
+const (
+	problemMediaType     = "application/problem+json"
+	legacyErrorMediaType = "application/vnd.greenlight.legacy-error+json"
+)
+
+// problem is an RFC 7807 problem details object. Code is an extension member holding the
+// problem's stable code, and Errors is an extension member holding the field errors of a
+// failed validation, each with its own code and parameters. Reason is an extension member
+// telling bad requests apart, such as "body_too_large".
+type problem struct {
+	Type     string                 `json:"type"`
+	Title    string                 `json:"title"`
+	Status   int                    `json:"status"`
+	Detail   string                 `json:"detail,omitempty"`
+	Instance string                 `json:"instance,omitempty"`
+	Code     string                 `json:"code"`
+	Reason   string                 `json:"reason,omitempty"`
+	Errors   []validator.FieldError `json:"errors,omitempty"`
+}
+
+// wantsLegacyErrors reports whether the client asked for errors in the legacy shape.
+func wantsLegacyErrors(r *http.Request) bool {
+	for _, item := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(item, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), legacyErrorMediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorResponse sends an error response with the given status code and stable code. The
+// detail is the error message for the client, which is either a string, the parameters of
+// the code's message in the i18n catalogs (nil for messages without any), a requestError,
+// or, for failed validations, the validator holding the errors. Messages from the catalogs,
+// requestErrors and validation messages are translated into the locale chosen by
+// errorLocale, which is sent in the Content-Language header. String details have no
+// translation, so they are sent as they are and the whole response is in English.
+//
+// By default the response is an application/problem+json problem details object, with
+// every error of a failed validation in its "errors" member, in the order they were found.
+// Clients asking for legacyErrorMediaType get the legacy {"error": detail} shape instead,
+// where a failed validation is a map holding the first message for each field.
+// Because the shape depends on the Accept header, it's added to the Vary header.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code string, detail any) {
+	w.Header().Add("Vary", "Accept")
+
+	locale := app.errorLocale(w, r)
+	if _, ok := detail.(string); ok {
+		locale = i18n.DefaultLocale
+	}
+	w.Header().Set("Content-Language", locale)
+
+	var message any
+
+	switch detail := detail.(type) {
+	case string:
+		message = detail
+	case *requestError:
+		message = detail.message(locale)
+	case messageParams:
+		message = errorMessage(locale, code, detail)
+	case *validator.Validator:
+		message = detail.LocalizedErrors(locale)
+	}
+
+	var err error
+
+	if wantsLegacyErrors(r) {
+		detail = message
+
+		// Wrap the detail in an envelope with "error" key, as error responses always were.
+		err = app.writeJSON(w, status, envelope{"error": detail}, nil)
+	} else {
+		p := problem{
+			Type:     problemTypeBase + code,
+			Title:    i18n.Translate(locale, "error."+code+".title", nil),
+			Status:   status,
+			Instance: r.URL.RequestURI(),
+			Code:     code,
+		}
+
+		switch detail := detail.(type) {
+		case *validator.Validator:
+			p.Detail = errorMessage(locale, code, nil)
+			p.Errors = detail.Localized(locale)
+		case *requestError:
+			p.Detail = message.(string)
+			p.Reason = detail.reason
+		default:
+			p.Detail = message.(string)
+		}
+
+		err = app.writeProblem(w, p)
+	}
 
-	// Write JSON response using application helper. Pass nil for headers since we don't need
-	// to set any custom headers in this error response case.
-	err := app.writeJSON(w, status, env, nil)
 	if err != nil {
 		// If JSON writing fails, log the error and fall back to plain text response
 		app.logError(r, err)
@@ -39,6 +215,23 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 	}
 }
 
+// writeProblem writes a problem details object as an application/problem+json response with
+// the problem's status code.
+func (app *application) writeProblem(w http.ResponseWriter, p problem) error {
+	js, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", problemMediaType)
+	w.WriteHeader(p.Status)
+	w.Write(js)
+
+	return nil
+}
+
 // serverErrorResponse logs the provided error and sends a 500 Internal Server Error
 // response with a generic error message to the client. This is used when the server
 // encounters an unexpected issue that prevents it from fulfilling the request.
@@ -50,11 +243,9 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 	// Log the error details including request method and URI
 	app.logError(r, err)
 
-	// Create a generic user-facing error message that doesn't expose internal details
-	message := "the server encountered a problem and could not process your request"
-
-	// Send JSON error response with 500 status code using the application's errorResponse helper
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	// Send JSON error response with 500 status code using the application's errorResponse
+	// helper, with a generic user-facing error message that doesn't expose internal details
+	app.errorResponse(w, r, http.StatusInternalServerError, codeServerError, messageParams(nil))
 }
 
 // notFoundResponse sends a JSON-formatted 404 Not Found response to the client.
@@ -63,12 +254,9 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 // - w: http.ResponseWriter to write the HTTP response
 // - r: *http.Request to extract request context for logging
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
-	// Define a user-friendly error message for the 404 response
-	message := "the requested resource could not be found"
-
 	// Use the application's errorResponse helper to send the JSON response
-	// with the appropriate HTTP status code
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	// with the appropriate HTTP status code and a user-friendly error message
+	app.errorResponse(w, r, http.StatusNotFound, codeNotFound, messageParams(nil))
 }
 
 // methodNotAllowedResponse sends a JSON-formatted 405 Method Not Allowed response to the client.
@@ -78,36 +266,42 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 // - r: *http.Request to extract the request method for the error message
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	// Create a descriptive error message that includes the unsupported HTTP method
-	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
+	message := messageParams{"method": r.Method}
 
 	// Use the application's errorResponse helper to send the JSON response
 	// with the appropriate HTTP status code
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, message)
 }
 
 // badRequestResponse sends a JSON-formatted 400 Bad Request response to the client.
 // It's used when the client sends invalid or malformed data in the request.
 // Parameters:
-// - w: http.ResponseWriter to write the HTTP response
-// - r: *http.Request to extract request context for logging
-// - err: error containing details about what made the request invalid
+//   - w: http.ResponseWriter to write the HTTP response
+//   - r: *http.Request to extract request context for logging
+//   - err: error containing details about what made the request invalid, which is translated
+//     if it is a requestError and sent in English otherwise
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		app.errorResponse(w, r, http.StatusBadRequest, codeBadRequest, reqErr)
+		return
+	}
+
 	// Use the application's errorResponse helper to send the JSON response
 	// with a 400 status code and the error message from the provided error
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
 }
 
 // failedValidationResponse sends a JSON-formatted 422 Unprocessable Entity response to the client.
 // It's specifically used when the client's request data fails validation checks.
-// The 'errors' parameter should be a map where keys are field names and values are error messages.
 // Parameters:
 //   - w: http.ResponseWriter to write the HTTP response.
 //   - r: *http.Request to extract request context for logging.
-//   - errors: A map of validation errors, where keys are field names and values are error messages.
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+//   - v: The validator holding the validation errors.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
 	// Use the application's errorResponse helper to send the JSON response
 	// with a 422 status code and the validation errors.
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, codeValidationFailed, v)
 }
 
 // editConflictResponse sends a JSON-formatted 409 Conflict response to the client.
@@ -117,12 +311,71 @@ func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.
 //   - w: http.ResponseWriter to write the HTTP response
 //   - r: *http.Request to extract request context for logging
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
-	// Define a user-friendly error message explaining the edit conflict
-	message := "unable to update the record due to an edit conflict, please try again"
-
 	// Use the application's errorResponse helper to send the JSON response
-	// with HTTP 409 Conflict status code and the error message
-	app.errorResponse(w, r, http.StatusConflict, message)
+	// with HTTP 409 Conflict status code and a message explaining the edit conflict
+	app.errorResponse(w, r, http.StatusConflict, codeEditConflict, messageParams(nil))
+}
+
+// preconditionFailedResponse sends a JSON-formatted 412 Precondition Failed response to the client.
+// It's used when the version given in an If-Match or X-Expected-Version header doesn't match
+// the current version of the record, meaning it was modified since the client last read it.
+// Parameters:
+//   - w: http.ResponseWriter to write the HTTP response
+//   - r: *http.Request to extract request context for logging
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusPreconditionFailed, codePreconditionFailed, messageParams(nil))
+}
+
+// patchTestFailedResponse sends a JSON-formatted 409 Conflict response to the client.
+// It's used when a "test" operation in a JSON Patch request doesn't match the current state
+// of the record, in which case none of the patch operations are applied.
+// Parameters:
+//   - w: http.ResponseWriter to write the HTTP response
+//   - r: *http.Request to extract request context for logging
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusConflict, codePatchTestFailed, messageParams(nil))
+}
+
+// invalidStatusTransitionResponse sends a JSON-formatted 409 Conflict response to the client.
+// It's used when a movie's moderation status doesn't allow the requested step, such as
+// approving a movie which isn't pending.
+// Parameters:
+//   - w: http.ResponseWriter to write the HTTP response
+//   - r: *http.Request to extract request context for logging
+//   - status: the movie's current moderation status
+func (app *application) invalidStatusTransitionResponse(w http.ResponseWriter, r *http.Request, status string) {
+	message := messageParams{"status": status}
+	app.errorResponse(w, r, http.StatusConflict, codeInvalidStatusTransition, message)
+}
+
+// unsupportedMediaTypeResponse sends a JSON-formatted 415 Unsupported Media Type response to the client.
+// It's used when the Content-Type of the request body isn't one the endpoint accepts.
+// Parameters:
+//   - w: http.ResponseWriter to write the HTTP response
+//   - r: *http.Request to extract the Content-Type for the error message
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := messageParams{"media_type": r.Header.Get("Content-Type")}
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, message)
+}
+
+// idempotencyKeyMismatchResponse sends a JSON-formatted 422 Unprocessable Entity response to the client.
+// It's used when an Idempotency-Key header repeats the key of an earlier request with a different
+// method, URL or body.
+// Parameters:
+//   - w: http.ResponseWriter to write the HTTP response
+//   - r: *http.Request to extract request context for logging
+func (app *application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, codeIdempotencyKeyMismatch, messageParams(nil))
+}
+
+// idempotencyKeyInUseResponse sends a JSON-formatted 409 Conflict response to the client.
+// It's used when a request repeats the Idempotency-Key header of an earlier request which is
+// still being processed.
+// Parameters:
+//   - w: http.ResponseWriter to write the HTTP response
+//   - r: *http.Request to extract request context for logging
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusConflict, codeIdempotencyKeyInUse, messageParams(nil))
 }
 
 // rateLimitExceededResponse sends a JSON-formatted 429 Too Many Requests response to the client.
@@ -131,11 +384,9 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 //   - w: http.ResponseWriter to write the HTTP response.
 //   - r: *http.Request to extract request context for logging.
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
-	// Define a user-friendly error message indicating the rate limit has been exceeded.
-	message := "rate limit exceeded"
 	// Use the application's errorResponse helper to send the JSON response
 	// with HTTP 429 Too Many Requests status code and the error message.
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.errorResponse(w, r, http.StatusTooManyRequests, codeRateLimitExceeded, messageParams(nil))
 }
 
 // invalidCredentialsResponse sends a JSON-formatted 401 Unauthorized response to the client.
@@ -144,8 +395,7 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 //   - w: http.ResponseWriter to write the HTTP response.
 //   - r: *http.Request to extract request context for logging.
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
-	message := "invalid authentication credentials"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, codeInvalidCredentials, messageParams(nil))
 }
 
 // invalidAuthenticationTokenResponse sends a JSON-formatted 401 Unauthorized response to the client.
@@ -155,8 +405,7 @@ func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *htt
 //   - r: *http.Request to extract request context for logging.
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
-	message := "invalid or missing authentication token"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, codeInvalidAuthenticationToken, messageParams(nil))
 }
 
 // authenticationRequiredResponse sends a JSON-formatted 401 Unauthorized response to the client.
@@ -165,18 +414,16 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 //   - w: http.ResponseWriter to write the HTTP response.
 //   - r: *http.Request to extract request context for logging.
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
-	message := "you must be authenticated to access this resource"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, codeAuthenticationRequired, messageParams(nil))
 }
 
-// authenticationRequiredResponse sends a JSON-formatted 401 Unauthorized response to the client.
-// It's used when the client attempts to access a protected resource without being authenticated.
+// inactiveAccountResponse sends a JSON-formatted 403 Forbidden response to the client.
+// It's used when the client's user account hasn't been activated yet.
 // Parameters:
 //   - w: http.ResponseWriter to write the HTTP response.
 //   - r: *http.Request to extract request context for logging.
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
-	message := "your user account must be activated to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, codeInactiveAccount, messageParams(nil))
 }
 
 // notPermittedResponse sends a JSON-formatted 403 Forbidden response to the client.
@@ -185,6 +432,5 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 //   - w: http.ResponseWriter to write the HTTP response.
 //   - r: *http.Request to extract request context for logging.
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
-	message := "your user account doesn't have the necessary permissions to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, codeNotPermitted, messageParams(nil))
 }
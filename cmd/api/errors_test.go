@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/patch"
+)
+
+func TestBadRequestResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantLanguage string
+		wantTitle    string
+		wantDetail   string
+		wantReason   string
+	}{
+		{
+			name:         "request error",
+			err:          newRequestError("body_too_large", messageParams{"max": 1_048_576}),
+			wantLanguage: "fr",
+			wantTitle:    "Requête invalide",
+			wantDetail:   "le corps ne doit pas dépasser 1048576 octets",
+			wantReason:   "body_too_large",
+		},
+		{
+			name:         "wrapped request error",
+			err:          errors.Join(errors.New("reading body"), newRequestError("body_empty", nil)),
+			wantLanguage: "fr",
+			wantTitle:    "Requête invalide",
+			wantDetail:   "le corps ne doit pas être vide",
+			wantReason:   "body_empty",
+		},
+		{
+			// Errors without a translation are sent in English, and labelled as English.
+			name:         "untranslated error",
+			err:          errors.New("unexpected EOF"),
+			wantLanguage: "en",
+			wantTitle:    "Bad request",
+			wantDetail:   "unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+			r.Header.Set("Accept-Language", "fr-CA, en;q=0.5")
+			app.badRequestResponse(w, r, tt.err)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("got status %d", w.Code)
+			}
+			if got := w.Header().Get("Content-Language"); got != tt.wantLanguage {
+				t.Errorf("got Content-Language %q; want %q", got, tt.wantLanguage)
+			}
+
+			var p problem
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != codeBadRequest || p.Title != tt.wantTitle || p.Detail != tt.wantDetail || p.Reason != tt.wantReason {
+				t.Errorf("got %+v", p)
+			}
+		})
+	}
+
+	t.Run("legacy", func(t *testing.T) {
+		app := newTestApplication(t)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies?lang=fr", nil)
+		r.Header.Set("Accept", legacyErrorMediaType)
+		app.badRequestResponse(w, r, newRequestError("body_unknown_key", messageParams{"key": "budget"}))
+
+		var body struct{ Error string }
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if want := "le corps contient la clé inconnue « budget »"; body.Error != want {
+			t.Errorf("got error %q; want %q", body.Error, want)
+		}
+	})
+}
+
+// requestErrorReason returns the reason and parameters of a requestError, or fails the test
+// if err isn't one.
+func requestErrorReason(t *testing.T, err error) (string, messageParams) {
+	t.Helper()
+
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("got error %v; want a requestError", err)
+	}
+	return reqErr.reason, reqErr.params
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		body       string
+		wantReason string
+		wantParams messageParams
+	}{
+		{``, "body_empty", nil},
+		{`{"title": "Heat"`, "body_malformed_json", nil},
+		{`{"title": "Heat",}`, "body_malformed_json_at", messageParams{"offset": int64(18)}},
+		{`{"title": 1}`, "body_json_type_field", messageParams{"field": "title"}},
+		{`["Heat"]`, "body_json_type_at", messageParams{"offset": int64(1)}},
+		{`{"budget": 1}`, "body_unknown_key", messageParams{"key": "budget"}},
+		{`{"runtime": "an hour"}`, "body_runtime_format", nil},
+		{`{"title": "Heat"} {}`, "body_multiple_values", nil},
+	}
+
+	app := newTestApplication(t)
+
+	for _, tt := range tests {
+		var input struct {
+			Title   string       `json:"title"`
+			Runtime data.Runtime `json:"runtime"`
+		}
+
+		reason, params := requestErrorReason(t, app.decodeJSON(strings.NewReader(tt.body), &input))
+		if reason != tt.wantReason {
+			t.Errorf("%s: got reason %q; want %q", tt.body, reason, tt.wantReason)
+		}
+		for name, want := range tt.wantParams {
+			if params[name] != want {
+				t.Errorf("%s: got %s %#v; want %#v", tt.body, name, params[name], want)
+			}
+		}
+	}
+}
+
+func TestReadMovieChangesErrors(t *testing.T) {
+	tests := []struct {
+		body       string
+		wantReason string
+	}{
+		{`{"op": "add"}`, "patch_invalid"},
+		{`[{"op": "remove", "path": "/director"}]`, "patch_operation_failed"},
+		{`[{"op": "add", "path": "/budget", "value": 1}]`, "body_unknown_key"},
+	}
+
+	app := newTestApplication(t)
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", patch.MediaTypeJSONPatch)
+
+		err := app.readMovieChanges(w, r, &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime"}})
+		if reason, _ := requestErrorReason(t, err); reason != tt.wantReason {
+			t.Errorf("%s: got reason %q; want %q", tt.body, reason, tt.wantReason)
+		}
+	}
+
+	// A failed test operation isn't a bad request, so it is returned as it is, for a 409.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", strings.NewReader(`[{"op": "test", "path": "/year", "value": 1996}]`))
+	r.Header.Set("Content-Type", patch.MediaTypeJSONPatch)
+
+	err := app.readMovieChanges(w, r, &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime"}})
+	if !errors.Is(err, patch.ErrTestFailed) {
+		t.Errorf("got error %v; want ErrTestFailed", err)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/filter"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// exportFlushInterval is the number of movies written between flushes of an export. After
+// each flush the write deadline is extended by exportWriteTimeout, so that large exports
+// aren't cut off by the server's WriteTimeout while stalled clients still are.
+const (
+	exportFlushInterval = 500
+	exportWriteTimeout  = 30 * time.Second
+)
+
+// Define the trailers sent at the end of every export. The status code is sent before the
+// first movie, so a failure part way through can only be reported after the last one:
+// Export-Status is "complete" if every movie was written and "failed" otherwise, and
+// Export-Count is the number of movies written. A response without the trailers was cut
+// off before the export finished, so clients should treat anything but "complete" as a
+// truncated export.
+const (
+	exportStatusTrailer = "Export-Status"
+	exportCountTrailer  = "Export-Count"
+	exportStatusOK      = "complete"
+	exportStatusFailed  = "failed"
+)
+
+// movieExporter writes movies to an export in a particular format.
+type movieExporter interface {
+	// Begin writes anything which comes before the first movie.
+	Begin() error
+	// Write writes a single movie.
+	Write(movie *data.Movie) error
+	// Flush writes out any output buffered by the exporter itself.
+	Flush() error
+	// End writes anything which comes after the last movie and flushes any buffered output.
+	End() error
+}
+
+// csvMovieExporter writes movies as CSV, with a header row, runtimes in minutes and genres
+// as a single comma-separated field. The output can be imported with POST /v1/movies/import,
+// which ignores the id and version columns.
+type csvMovieExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvMovieExporter) Begin() error {
+	return e.w.Write([]string{"id", "title", "year", "runtime", "genres", "version"})
+}
+
+func (e *csvMovieExporter) Write(movie *data.Movie) error {
+	return e.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.Itoa(int(movie.Year)),
+		strconv.Itoa(int(movie.Runtime)),
+		strings.Join(movie.Genres, ","),
+		strconv.Itoa(int(movie.Version)),
+	})
+}
+
+func (e *csvMovieExporter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvMovieExporter) End() error {
+	return e.Flush()
+}
+
+// ndjsonMovieExporter writes movies as newline-delimited JSON, one movie per line in the
+// same format as the other movie endpoints.
+type ndjsonMovieExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonMovieExporter) Begin() error { return nil }
+
+func (e *ndjsonMovieExporter) Write(movie *data.Movie) error {
+	return e.enc.Encode(movie)
+}
+
+func (e *ndjsonMovieExporter) Flush() error { return nil }
+
+func (e *ndjsonMovieExporter) End() error { return nil }
+
+// jsonMovieExporter writes movies as a single JSON document, {"movies": [...]}, which is
+// streamed one movie at a time rather than encoded in one go.
+type jsonMovieExporter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonMovieExporter) Begin() error {
+	_, err := io.WriteString(e.w, "{\"movies\":[\n")
+	return err
+}
+
+func (e *jsonMovieExporter) Write(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+
+	if e.count > 0 {
+		js = append([]byte(",\n"), js...)
+	}
+	e.count++
+
+	_, err = e.w.Write(js)
+	return err
+}
+
+func (e *jsonMovieExporter) Flush() error { return nil }
+
+func (e *jsonMovieExporter) End() error {
+	_, err := io.WriteString(e.w, "\n]}\n")
+	return err
+}
+
+// exportMoviesHandler handles HTTP GET requests to export the whole movie catalogue, or the
+// movies matching the same filter and sort parameters as listMoviesHandler, in one
+// response. The format parameter chooses between "csv", "ndjson" and "json" (the default).
+// Movies are streamed from a server-side cursor and the response is flushed as it goes,
+// so the export never holds more than a chunk of movies in memory.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Filter filter.Filter
+		Format string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filter = filter.Parse(qs, data.MovieFilterSchema, v)
+	input.Format = app.readString(qs, "format", "json")
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafelist = movieListSortSafelist
+	input.SortKeys = data.MovieSortKeys
+
+	// Exports aren't paginated, so only the sort value is checked rather than calling
+	// ValidateFilters.
+	data.ValidateSort(v, input.Filters)
+	v.Apply("format", validator.Enum(input.Format, "csv", "ndjson", "json").WithMessage("export_format"))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// The export is tied to the request context, so it stops as soon as the client goes away.
+	app.writeExport(w, r, input.Format, func(fn func(*data.Movie) error) error {
+		return app.models.Movies.Export(r.Context(), input.Filter, input.Filters, fn)
+	})
+}
+
+// writeExport streams the movies given by export to the client in the format, which must be
+// "csv", "ndjson" or "json", and ends the response with the export trailers. The export
+// function calls fn for each movie in turn, and stops with fn's error if it returns one.
+func (app *application) writeExport(w http.ResponseWriter, r *http.Request, format string, export func(fn func(*data.Movie) error) error) {
+	var (
+		exporter    movieExporter
+		contentType string
+	)
+
+	switch format {
+	case "csv":
+		exporter = &csvMovieExporter{w: csv.NewWriter(w)}
+		contentType = "text/csv"
+	case "ndjson":
+		exporter = &ndjsonMovieExporter{enc: json.NewEncoder(w)}
+		contentType = "application/x-ndjson"
+	default:
+		exporter = &jsonMovieExporter{w: w}
+		contentType = "application/json"
+	}
+
+	// Use a ResponseController to flush the response as it goes and to keep extending the
+	// write deadline, which would otherwise end the response after the server's WriteTimeout.
+	rc := http.NewResponseController(w)
+
+	// flush sends everything written so far to the client and extends the write deadline.
+	// Errors are ignored because both operations are optional for a ResponseWriter.
+	flush := func() {
+		_ = rc.Flush()
+		_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	}
+
+	written := 0
+
+	// Announce the trailers before the status code is sent, and set them however the export
+	// ends. They are only sent once the handler returns.
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies.%s"`, format))
+	w.Header().Set("Trailer", exportStatusTrailer+", "+exportCountTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	status := exportStatusFailed
+	defer func() {
+		w.Header().Set(exportStatusTrailer, status)
+		w.Header().Set(exportCountTrailer, strconv.Itoa(written))
+	}()
+
+	flush()
+
+	err := exporter.Begin()
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	err = export(func(movie *data.Movie) error {
+		err := exporter.Write(movie)
+		if err != nil {
+			return err
+		}
+
+		written++
+		if written%exportFlushInterval == 0 {
+			err = exporter.Flush()
+			if err != nil {
+				return err
+			}
+			flush()
+		}
+
+		return nil
+	})
+	if err != nil {
+		// The status code has already been sent, so all we can do is log the error, flush
+		// what was written and stop, leaving the failed status in the trailers.
+		if r.Context().Err() != context.Canceled {
+			app.logError(r, err)
+		}
+		_ = exporter.Flush()
+		return
+	}
+
+	err = exporter.End()
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	status = exportStatusOK
+
+	flush()
+}
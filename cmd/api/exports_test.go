@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight.tomcat.net/client"
+	"greenlight.tomcat.net/internal/data"
+)
+
+// exportMovies returns an export function which yields the movies with IDs 1 to n, and
+// then fails with err if it isn't nil.
+func exportMovies(n int, err error) func(fn func(*data.Movie) error) error {
+	return func(fn func(*data.Movie) error) error {
+		for i := 1; i <= n; i++ {
+			movie := &data.Movie{
+				ID:      int64(i),
+				Title:   fmt.Sprintf("Movie, \"%d\"", i),
+				Year:    2000 + int32(i),
+				Runtime: 90,
+				Genres:  []string{"drama", "crime"},
+				Version: 1,
+			}
+			if err := fn(movie); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+// recordExport runs writeExport and returns the response.
+func recordExport(t *testing.T, format string, export func(fn func(*data.Movie) error) error) *http.Response {
+	t.Helper()
+
+	app := newTestApplication(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies/export?format="+format, nil)
+	app.writeExport(w, r, format, export)
+
+	return w.Result()
+}
+
+func TestWriteExportTrailers(t *testing.T) {
+	for _, format := range []string{"csv", "ndjson", "json"} {
+		t.Run(format, func(t *testing.T) {
+			resp := recordExport(t, format, exportMovies(3, nil))
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("got status %d", resp.StatusCode)
+			}
+			if got := resp.Trailer.Get("Export-Status"); got != "complete" {
+				t.Errorf("got Export-Status %q; want complete", got)
+			}
+			if got := resp.Trailer.Get("Export-Count"); got != "3" {
+				t.Errorf("got Export-Count %q; want 3", got)
+			}
+		})
+
+		t.Run(format+" failing part way", func(t *testing.T) {
+			resp := recordExport(t, format, exportMovies(2, errors.New("connection reset by peer")))
+
+			if got := resp.Trailer.Get("Export-Status"); got != "failed" {
+				t.Errorf("got Export-Status %q; want failed", got)
+			}
+			if got := resp.Trailer.Get("Export-Count"); got != "2" {
+				t.Errorf("got Export-Count %q; want 2", got)
+			}
+		})
+	}
+
+	t.Run("json document left unfinished", func(t *testing.T) {
+		// The document is left unfinished rather than closed as if it were complete.
+		resp := recordExport(t, "json", exportMovies(2, errors.New("connection reset by peer")))
+
+		var export struct{ Movies []json.RawMessage }
+		if err := json.NewDecoder(resp.Body).Decode(&export); err == nil {
+			t.Errorf("got a complete document with %d movies", len(export.Movies))
+		}
+	})
+}
+
+// TestCSVExportImport checks that a CSV export can be read by the CSV importer, which
+// ignores the id and version columns.
+func TestCSVExportImport(t *testing.T) {
+	resp := recordExport(t, "csv", exportMovies(3, nil))
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := readImportRows(t, importFormatCSV, string(body))
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows; want 3", len(rows))
+	}
+
+	for i, row := range rows {
+		if !row.Errors.Valid() {
+			t.Errorf("row %d: got errors %v", row.Row, errorCodes(row.Errors.FieldErrors))
+		}
+
+		want := fmt.Sprintf("Movie, \"%d\"", i+1)
+		if row.Movie.Title != want || row.Movie.Year != 2001+int32(i) || row.Movie.Runtime != 90 || strings.Join(row.Movie.Genres, ",") != "drama,crime" {
+			t.Errorf("row %d: got %+v", row.Row, row.Movie)
+		}
+	}
+}
+
+// TestClientExportMovies checks the trailers over HTTP, where the client reads them once
+// it reaches the end of the body.
+func TestClientExportMovies(t *testing.T) {
+	tests := []struct {
+		name    string
+		export  func(fn func(*data.Movie) error) error
+		wantErr bool
+	}{
+		{"Complete", exportMovies(3, nil), false},
+		{"Failed part way", exportMovies(2, errors.New("connection reset by peer")), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				app.writeExport(w, r, "ndjson", tt.export)
+			}))
+			defer ts.Close()
+
+			c, err := client.New(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := c.ExportMovies(context.Background(), client.ExportParams{Format: "ndjson"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			_, err = io.ReadAll(body)
+			if got := errors.Is(err, client.ErrIncompleteExport); got != tt.wantErr || (err != nil && !tt.wantErr) {
+				t.Errorf("got error %v; want ErrIncompleteExport %t", err, tt.wantErr)
+			}
+		})
+	}
+}
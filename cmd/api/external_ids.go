@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// showMovieByExternalIDHandler handles GET requests to look up a movie by its identifier in
+// another catalogue, such as /v1/external-ids/imdb/tt0111161. It responds with the movie in
+// the same format as showMovieHandler, or 404 Not Found if no movie has that identifier.
+func (app *application) showMovieByExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movie, err := app.models.Movies.GetByExternalID(params.ByName("source"), params.ByName("external_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	visible, err := app.canViewMovie(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.presentMovies(w, r, movie)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieRepresentationETag(r, movie.Version, data.MovieProjection{}))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setMovieExternalIDHandler handles PUT requests to set a movie's identifier in another
+// catalogue. The source is taken from the URL and the identifier from a request body such
+// as {"id": "tt0111161"}; any identifier the movie already had in that source is replaced.
+// An identifier can only belong to one movie per source, so using one which another movie
+// already has results in a 422 Unprocessable Entity response. On success the movie is
+// returned with its updated external IDs.
+func (app *application) setMovieExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	source := httprouter.ParamsFromContext(r.Context()).ByName("source")
+
+	var input struct {
+		ID string `json:"id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateExternalID(v, source, input.ID); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Movies.SetExternalID(id, source, input.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddErrorCode("id", "external_id_taken", nil)
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeUpdatedMovie(w, r, id)
+}
+
+// deleteMovieExternalIDHandler handles DELETE requests to remove a movie's identifier in
+// another catalogue. It responds with 404 Not Found if the movie has no identifier in
+// that source.
+func (app *application) deleteMovieExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	source := httprouter.ParamsFromContext(r.Context()).ByName("source")
+
+	err = app.models.Movies.DeleteExternalID(id, source)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "external id successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"greenlight.tomcat.net/internal/data"
 	"greenlight.tomcat.net/internal/validator"
 )
 
@@ -30,12 +33,153 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 
 	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, newRequestError("invalid_id_parameter", nil)
 	}
 
 	return id, nil
 }
 
+// readVersionParam retrieves the "version" URL parameter from the current request context
+// and converts it to a positive 32-bit integer, matching the type of data.Movie.Version.
+// If the operation isn't successful, return 0 and an error.
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, newRequestError("invalid_version_parameter", nil)
+	}
+
+	return int32(version), nil
+}
+
+// errPreconditionFailed is returned by checkIfMatch when the version the client expects
+// doesn't match the current version of the resource.
+var errPreconditionFailed = errors.New("precondition failed")
+
+// movieETag returns the (strong) entity tag of a representation of a given version of a
+// movie. The version is bumped on every change, so it identifies each state of a movie
+// record. The same state can be sent in different representations, with only some fields
+// or in another language, which must not share an entity tag, so the variant of the
+// representation (see movieVariant) follows the version unless it is the default one.
+func movieETag(version int32, variant string) string {
+	if variant == "" {
+		return fmt.Sprintf(`"%d"`, version)
+	}
+	return fmt.Sprintf(`"%d-%s"`, version, variant)
+}
+
+// movieVariant returns a short key identifying the representation of a movie chosen by a
+// projection and the locales its display title was chosen from, or an empty string for
+// the default representation, which has every field and no localized title. The order of
+// the fields and related resources doesn't change the representation, but the order of
+// the locales does.
+func movieVariant(projection data.MovieProjection, locales []string) string {
+	if len(projection.Fields) == 0 && len(projection.Include) == 0 && len(locales) == 0 {
+		return ""
+	}
+
+	key := fmt.Sprintf("fields=%s;include=%s;lang=%s",
+		strings.Join(slices.Sorted(slices.Values(projection.Fields)), ","),
+		strings.Join(slices.Sorted(slices.Values(projection.Include)), ","),
+		strings.Join(locales, ","))
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// movieRepresentationETag returns the entity tag of a movie as presented to the client
+// making the request, with the given projection and the locales the client asked for.
+// Handlers sending the movie through presentMovies without a projection pass the zero
+// MovieProjection.
+func movieRepresentationETag(r *http.Request, version int32, projection data.MovieProjection) string {
+	return movieETag(version, movieVariant(projection, requestLocales(r)))
+}
+
+// etagListContains reports whether a comma-separated If-Match or If-None-Match header value
+// contains the given entity tag, or the "*" wildcard. When weak is true the W/ prefix is
+// ignored (the weak comparison used by If-None-Match); otherwise weak tags never match (the
+// strong comparison used by If-Match).
+func etagListContains(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagListContainsVersion reports whether a comma-separated If-Match header value contains
+// the "*" wildcard or a strong entity tag of any representation of the given version of a
+// movie. Every representation of a version holds the same state, so a client which read
+// the movie with only some fields may still use the entity tag it was sent to update it.
+func etagListContainsVersion(header string, version int32) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		tag, ok := strings.CutPrefix(candidate, `"`)
+		if !ok {
+			continue
+		}
+		tag, ok = strings.CutSuffix(tag, `"`)
+		if !ok {
+			continue
+		}
+
+		tag, _, _ = strings.Cut(tag, "-")
+		if tag == strconv.Itoa(int(version)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIfMatch compares the current version of a resource against the version the client
+// expects it to have, taken from the If-Match header or, for clients which can't set
+// If-Match, the X-Expected-Version header. It returns true if the client supplied either
+// header. The error is errPreconditionFailed if the versions don't match, or a descriptive
+// error if X-Expected-Version isn't a valid version number.
+func (app *application) checkIfMatch(r *http.Request, version int32) (bool, error) {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !etagListContainsVersion(ifMatch, version) {
+			return true, errPreconditionFailed
+		}
+		return true, nil
+	}
+
+	if expected := r.Header.Get("X-Expected-Version"); expected != "" {
+		i, err := strconv.ParseInt(expected, 10, 32)
+		if err != nil || i < 1 {
+			return true, newRequestError("expected_version_invalid", nil)
+		}
+
+		if int32(i) != version {
+			return true, errPreconditionFailed
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
 // writeJSON is a helper method for sending JSON responses. It handles marshaling data,
 // setting headers, and writing the response body. The function will:
 // - Marshal the input data to JSON (returning error on failure)
@@ -87,8 +231,40 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
+	return app.decodeJSON(r.Body, dst)
+}
+
+// readBody reads the whole request body, enforcing the same 1MB limit as readJSON.
+// It is used when the body has to be processed before it can be decoded, such as
+// JSON Patch and JSON Merge Patch documents.
+func (app *application) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			return nil, newRequestError("body_too_large", messageParams{"max": maxBytesError.Limit})
+		default:
+			return nil, err
+		}
+	}
+
+	if len(body) == 0 {
+		return nil, newRequestError("body_empty", nil)
+	}
+
+	return body, nil
+}
+
+// decodeJSON decodes a single JSON value from the reader into the destination struct,
+// translating decoding errors into client-friendly messages as described for readJSON.
+func (app *application) decodeJSON(body io.Reader, dst any) error {
 	// Create JSON decoder and configure to reject unknown fields
-	dec := json.NewDecoder(r.Body)
+	dec := json.NewDecoder(body)
 	dec.DisallowUnknownFields()
 
 	// Attempt to decode JSON into destination struct
@@ -104,31 +280,35 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 		switch {
 		// Syntax error in JSON (e.g., missing comma, incorrect brackets)
 		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+			return newRequestError("body_malformed_json_at", messageParams{"offset": syntaxError.Offset})
 
 		// Unexpected EOF indicates malformed JSON structure
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+			return newRequestError("body_malformed_json", nil)
 
 		// Type mismatch error for a specific field in destination struct
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+				return newRequestError("body_json_type_field", messageParams{"field": unmarshalTypeError.Field})
 			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+			return newRequestError("body_json_type_at", messageParams{"offset": unmarshalTypeError.Offset})
 
 		// Empty request body error
 		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+			return newRequestError("body_empty", nil)
 
 		// Unknown field in JSON body
-		case strings.HasPrefix(err.Error(), "json:unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return newRequestError("body_unknown_key", messageParams{"key": fieldName})
+
+		// A runtime which isn't in the "<minutes> mins" format
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			return newRequestError("body_runtime_format", nil)
 
 		// Request body exceeds size limit
 		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+			return newRequestError("body_too_large", messageParams{"max": maxBytesError.Limit})
 
 		// Invalid unmarshal target (indicates programmer error)
 		case errors.As(err, &invalidUnmarshalError):
@@ -143,7 +323,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	// Ensure request body contains only a single JSON value
 	err = dec.Decode(&struct{}{})
 	if !errors.Is(err, io.EOF) {
-		return errors.New("body must only contain a single JSON value")
+		return newRequestError("body_multiple_values", nil)
 	}
 
 	// Return nil when decoding is successful
@@ -213,7 +393,7 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	i, err := strconv.Atoi(s)
 	if err != nil {
 		// If conversion fails, add a validation error and return the default value
-		v.AddError(key, "must be an integer value")
+		v.AddErrorCode(key, "integer", nil)
 		return defaultValue
 	}
 
@@ -221,6 +401,58 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readBool retrieves a boolean value from URL query parameters.
+// It accepts the same values as strconv.ParseBool (such as "true", "false", "1" and "0").
+// It takes the following parameters:
+//   - qs: The url.Values containing the query parameters
+//   - key: The parameter key to look up
+//   - defaultValue: The value to return if the key is not found, empty, or invalid
+//   - v: A pointer to a validator.Validator used to record validation errors
+//
+// Returns:
+//   - The boolean value if the key exists and is a valid boolean
+//   - The defaultValue if the key doesn't exist, is empty, or is not a valid boolean (and records a validation error)
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	// If the parameter is missing or empty, return the default value
+	if s == "" {
+		return defaultValue
+	}
+
+	// Attempt to convert the string value to a boolean
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		// If conversion fails, add a validation error and return the default value
+		v.AddErrorCode(key, "boolean", nil)
+		return defaultValue
+	}
+
+	return b
+}
+
+// readFloat retrieves a floating-point value from URL query parameters.
+// It takes the same parameters as readInt, and records a validation error if the value
+// is present but isn't a number.
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+
+	// If the parameter is missing or empty, return the default value
+	if s == "" {
+		return defaultValue
+	}
+
+	// Attempt to convert the string value to a float
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		// If conversion fails, add a validation error and return the default value
+		v.AddErrorCode(key, "number", nil)
+		return defaultValue
+	}
+
+	return f
+}
+
 // the helper function to launch a background goroutine
 // with recover to catch up error without terminated the application
 func (app *application) background(fn func()) {
@@ -239,3 +471,16 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// presentMovies prepares movies to be sent in a response: it chooses the title to display
+// for each movie from the client's preferred languages, and signs the download URLs of
+// the movies' images.
+func (app *application) presentMovies(w http.ResponseWriter, r *http.Request, movies ...*data.Movie) {
+	app.localizeMovies(w, r, movies...)
+
+	for _, movie := range movies {
+		for i := range movie.Images {
+			app.signImageURLs(r, &movie.Images[i])
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"greenlight.tomcat.net/internal/data"
+)
+
+func TestMovieRepresentationETag(t *testing.T) {
+	etag := func(target, acceptLanguage string, projection data.MovieProjection) string {
+		r := httptest.NewRequest("GET", target, nil)
+		if acceptLanguage != "" {
+			r.Header.Set("Accept-Language", acceptLanguage)
+		}
+		return movieRepresentationETag(r, 7, projection)
+	}
+
+	full := etag("/v1/movies/1", "", data.MovieProjection{})
+	if full != `"7"` {
+		t.Errorf("default representation: got %s; want \"7\"", full)
+	}
+
+	variants := map[string]string{
+		"fields":          etag("/v1/movies/1?fields=title", "", data.MovieProjection{Fields: []string{"title"}}),
+		"include":         etag("/v1/movies/1?include=images", "", data.MovieProjection{Include: []string{"images"}}),
+		"lang":            etag("/v1/movies/1?lang=fr", "", data.MovieProjection{}),
+		"accept-language": etag("/v1/movies/1", "de", data.MovieProjection{}),
+	}
+
+	seen := map[string]string{full: "default"}
+	for name, tag := range variants {
+		if other, ok := seen[tag]; ok {
+			t.Errorf("%s and %s representations share the entity tag %s", name, other, tag)
+		}
+		seen[tag] = name
+	}
+
+	// The order of the chosen fields doesn't change the representation.
+	a := etag("/v1/movies/1", "", data.MovieProjection{Fields: []string{"title", "year"}})
+	b := etag("/v1/movies/1", "", data.MovieProjection{Fields: []string{"year", "title"}})
+	if a != b {
+		t.Errorf("got %s and %s for the same fields in another order", a, b)
+	}
+}
+
+func TestEtagListContainsVersion(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"7"`, true},
+		{`"7-1a2b3c4d"`, true},
+		{`"6", "7-1a2b3c4d"`, true},
+		{`*`, true},
+		{`"8"`, false},
+		{`"70"`, false},
+		{`W/"7"`, false},
+		{`7`, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagListContainsVersion(tt.header, 7); got != tt.want {
+			t.Errorf("etagListContainsVersion(%q, 7) = %v; want %v", tt.header, got, tt.want)
+		}
+	}
+}
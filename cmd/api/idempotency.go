@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+)
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key header value accepted.
+const maxIdempotencyKeyLength = 255
+
+// idempotencyResponseWriter wraps a http.ResponseWriter to keep a copy of the response as
+// it is written, so that it can be saved against the request's idempotency key.
+type idempotencyResponseWriter struct {
+	wrapped    http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+}
+
+// Header returns the header map of the wrapped http.ResponseWriter.
+func (iw *idempotencyResponseWriter) Header() http.Header {
+	return iw.wrapped.Header()
+}
+
+// WriteHeader writes the status code to the wrapped http.ResponseWriter, and records it
+// along with a copy of the headers the first time it is called.
+func (iw *idempotencyResponseWriter) WriteHeader(statusCode int) {
+	if iw.statusCode == 0 {
+		iw.statusCode = statusCode
+		iw.header = iw.wrapped.Header().Clone()
+	}
+
+	iw.wrapped.WriteHeader(statusCode)
+}
+
+// Write writes the data to the wrapped http.ResponseWriter and keeps a copy of it.
+func (iw *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	if iw.statusCode == 0 {
+		iw.WriteHeader(http.StatusOK)
+	}
+
+	iw.body.Write(b)
+	return iw.wrapped.Write(b)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for use by http.ResponseController.
+func (iw *idempotencyResponseWriter) Unwrap() http.ResponseWriter {
+	return iw.wrapped
+}
+
+// requestFingerprint returns a hash of the method, URL and body of a request, which is used
+// to check that a request repeating an idempotency key is the same as the original.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// anonymousIdempotencyKey returns the key an anonymous request's idempotency key is stored
+// under, which is prefixed with the client's IP address. Anonymous requests can't be told
+// apart by user, so without it any two clients choosing the same key would share it.
+func anonymousIdempotencyKey(r *http.Request, key string) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return ip + " " + key
+}
+
+// idempotent is a middleware for endpoints which change data, which makes requests with an
+// Idempotency-Key header safe to retry. The first request with a key is processed as usual
+// and its response is saved for the configured TTL. Later requests from the same user with
+// the same key are not processed again:
+//   - if the method, URL and body are the same, the saved response is replayed, with an
+//     Idempotent-Replayed header
+//   - if they differ, a 422 Unprocessable Entity response is sent
+//   - if the original request is still being processed, a 409 Conflict response is sent
+//
+// Anonymous requests all share the anonymous user, so their keys are scoped to the client's
+// IP address instead (see anonymousIdempotencyKey): clients at different addresses reusing
+// a key neither get a mismatch nor see each other's responses, while a client reusing its
+// own key for a different request gets the 422 response like any user.
+//
+// Responses with a 5xx status are not saved, so that the request can be retried with the
+// same key. Requests without the header are passed straight on to the next handler.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+
+		if key == "" || app.config.idempotency.ttl <= 0 {
+			next(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			app.badRequestResponse(w, r, newRequestError("idempotency_key_too_long", messageParams{"max": maxIdempotencyKeyLength}))
+			return
+		}
+
+		// Read the body to fingerprint the request, then replace it so that the next handler
+		// can read it again. Bodies are limited to the same 1MB as readJSON, but unlike
+		// readBody an empty body is allowed, for example on DELETE requests.
+		r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+
+			switch {
+			case errors.As(err, &maxBytesError):
+				app.badRequestResponse(w, r, newRequestError("body_too_large", messageParams{"max": maxBytesError.Limit}))
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		user := app.contextGetUser(r)
+		fingerprint := requestFingerprint(r, body)
+
+		if user.IsAnonymous() {
+			key = anonymousIdempotencyKey(r, key)
+		}
+
+		existing, err := app.models.IdempotencyKeys.Reserve(user.ID, key, fingerprint, app.config.idempotency.ttl)
+		if err != nil {
+			switch {
+			// The key was released between our attempt to claim it and reading it back,
+			// so the original request is only just finishing.
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				app.idempotencyKeyMismatchResponse(w, r)
+			case existing.Status == 0:
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				// Replay the saved response.
+				for name, values := range existing.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+			}
+			return
+		}
+
+		iw := &idempotencyResponseWriter{wrapped: w}
+
+		// Release the key if the request doesn't finish with a response worth saving,
+		// including when the handler panics.
+		saved := false
+		defer func() {
+			if !saved {
+				err := app.models.IdempotencyKeys.Release(user.ID, key)
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+		}()
+
+		next(iw, r)
+
+		if iw.statusCode == 0 || iw.statusCode >= http.StatusInternalServerError {
+			return
+		}
+
+		err = app.models.IdempotencyKeys.Complete(&data.IdempotencyKey{
+			UserID: user.ID,
+			Key:    key,
+			Status: iw.statusCode,
+			Header: iw.header,
+			Body:   iw.body.Bytes(),
+		})
+		if err != nil {
+			// The response has already been sent, so just log the error. The key is
+			// released, and a retry will be processed again.
+			app.logError(r, err)
+			return
+		}
+
+		saved = true
+	}
+}
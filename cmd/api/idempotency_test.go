@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.tomcat.net/internal/data"
+)
+
+func TestAnonymousIdempotencyKey(t *testing.T) {
+	key := func(remoteAddr, body string) string {
+		r := httptest.NewRequest("POST", "/v1/users", strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+		return anonymousIdempotencyKey(r, "retry-1")
+	}
+
+	alice := key("192.0.2.1:50000", `{"email":"alice@example.com"}`)
+	aliceAgain := key("192.0.2.1:50001", `{"email":"alice@example.com"}`)
+	aliceChanged := key("192.0.2.1:50002", `{"email":"alice@example.org"}`)
+	bob := key("198.51.100.7:50000", `{"email":"alice@example.com"}`)
+
+	if alice != aliceAgain {
+		t.Error("a retry of an anonymous request doesn't find its idempotency key")
+	}
+	// The body isn't part of the key, so that a changed request is found and rejected.
+	if alice != aliceChanged {
+		t.Error("an anonymous request with a changed body doesn't find its idempotency key")
+	}
+	if alice == bob {
+		t.Error("anonymous requests from different clients share an idempotency key")
+	}
+}
+
+// TestAnonymousIdempotencyKeyMismatch checks that an anonymous client reusing its key for a
+// different request, as when registering with a corrected email address, gets a 422, while
+// another client can use the same key. It needs a database (see newTestDB).
+func TestAnonymousIdempotencyKeyMismatch(t *testing.T) {
+	app := newTestApplication(t)
+	app.models = data.NewModels(newTestDB(t))
+	app.config.idempotency.ttl = time.Minute
+
+	key := "anonymous-mismatch-" + time.Now().Format(time.RFC3339Nano)
+	t.Cleanup(func() {
+		app.models.IdempotencyKeys.DB.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND key LIKE $2", data.AnonymousUser.ID, "% "+key)
+	})
+
+	calls := 0
+	handler := app.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		app.writeJSON(w, http.StatusAccepted, envelope{"calls": calls}, nil)
+	})
+
+	send := func(remoteAddr, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Idempotency-Key", key)
+		r = app.contextSetUser(r, data.AnonymousUser)
+
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := send("192.0.2.1:50000", `{"email":"alice@example.com"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("first request: got status %d", w.Code)
+	}
+
+	w := send("192.0.2.1:50001", `{"email":"alice@example.com"}`)
+	if w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: got status %d and Idempotent-Replayed %q; want a replay", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+
+	w = send("192.0.2.1:50002", `{"email":"alice@example.org"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("changed request: got status %d; want 422", w.Code)
+	}
+	var p problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil || p.Code != codeIdempotencyKeyMismatch {
+		t.Errorf("changed request: got %+v, %v; want %s", p, err, codeIdempotencyKeyMismatch)
+	}
+
+	w = send("198.51.100.7:50000", `{"email":"bob@example.com"}`)
+	if w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("other client: got status %d and Idempotent-Replayed %q; want a new request", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+
+	if calls != 2 {
+		t.Errorf("the handler was called %d times; want 2", calls)
+	}
+}
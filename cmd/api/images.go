@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/imaging"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// imageThumbnailSize names a thumbnail made of every uploaded image of a kind, and gives
+// its width. The height follows from the image's aspect ratio.
+type imageThumbnailSize struct {
+	name  string
+	width int
+}
+
+// imageThumbnailSizes lists the thumbnails made of each kind of image. Images narrower
+// than a thumbnail are not enlarged, so their thumbnail has the image's own size.
+var imageThumbnailSizes = map[string][]imageThumbnailSize{
+	data.ImageKindPoster:   {{name: "small", width: 185}, {name: "medium", width: 500}},
+	data.ImageKindBackdrop: {{name: "small", width: 300}, {name: "medium", width: 780}},
+}
+
+// imageUpload holds the fields of a multipart image upload.
+type imageUpload struct {
+	kind     string
+	image    []byte
+	tooLarge bool
+}
+
+// readImageUpload reads a multipart/form-data request body holding a "kind" field and an
+// "image" file. Other fields are ignored. Reading stops as soon as the image is found to be
+// larger than maxBytes, in which case tooLarge is set rather than an error returned, so
+// that the caller can report it along with any other validation errors.
+func (app *application) readImageUpload(r *http.Request, maxBytes int64) (*imageUpload, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	upload := &imageUpload{}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return upload, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch part.FormName() {
+		case "kind":
+			kind, err := io.ReadAll(io.LimitReader(part, 100))
+			if err != nil {
+				return nil, err
+			}
+			upload.kind = string(kind)
+		case "image":
+			upload.image, err = io.ReadAll(io.LimitReader(part, maxBytes+1))
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(upload.image)) > maxBytes {
+				upload.tooLarge = true
+				return upload, nil
+			}
+		}
+
+		part.Close()
+	}
+}
+
+// uploadMovieImageHandler handles POST requests to add a poster or backdrop image to a
+// movie. The body is multipart/form-data with a "kind" field ("poster" or "backdrop") and
+// an "image" file. The image's format is sniffed from its content, whatever type the client
+// gave it, and must be JPEG, PNG or GIF; its size and dimensions are checked before it is
+// decoded. The image and its resized thumbnails are put in the blob store, and the image
+// is returned with signed URLs to download them in a 201 Created response.
+func (app *application) uploadMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Images can take longer to upload, and to resize and store, than the server's timeouts
+	// allow, so extend the deadlines for this request. This is a no-op if it isn't supported.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(time.Minute))
+	_ = rc.SetWriteDeadline(time.Now().Add(2 * time.Minute))
+
+	// Allow for the kind field and the multipart headers and boundaries on top of the image.
+	maxBytes := app.config.images.maxBytes
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64*1024)
+
+	upload, err := app.readImageUpload(r, maxBytes)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.Is(err, http.ErrNotMultipart):
+			app.unsupportedMediaTypeResponse(w, r)
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, newRequestError("body_too_large", messageParams{"max": maxBytesError.Limit}))
+		default:
+			app.badRequestResponse(w, r, newRequestError("body_malformed_multipart", nil))
+		}
+		return
+	}
+
+	image := &data.MovieImage{MovieID: id, Kind: upload.kind, Size: int64(len(upload.image))}
+
+	v := validator.New()
+
+	v.Apply("image",
+		validator.Assert(upload.image != nil, "required"),
+		validator.Assert(!upload.tooLarge, "image_file_too_large").WithParams(map[string]any{"max": maxBytes}),
+	)
+
+	if upload.image != nil && !upload.tooLarge {
+		// An image in an unsupported format is left without a content type, which
+		// ValidateMovieImage reports.
+		info, err := imaging.Inspect(upload.image)
+		if err == nil {
+			image.ContentType, image.Width, image.Height = info.ContentType, info.Width, info.Height
+		}
+	}
+
+	if data.ValidateMovieImage(v, image); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	blobs, err := app.makeImageBlobs(image, upload.image)
+	if err != nil {
+		if errors.Is(err, errCorruptImage) {
+			v.AddErrorCode("image", "image_invalid", nil)
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var stored []string
+
+	for key, blob := range blobs {
+		err = app.blobs.Put(r.Context(), key, blob.data, blob.contentType)
+		if err != nil {
+			app.deleteBlobs(stored)
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		stored = append(stored, key)
+	}
+
+	err = app.models.Movies.AddImage(image)
+	if err != nil {
+		app.deleteBlobs(stored)
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.signImageURLs(r, image)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"image": image}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// errCorruptImage is returned by makeImageBlobs for an image whose header could be read but
+// whose pixels couldn't be decoded.
+var errCorruptImage = errors.New("corrupt image")
+
+// imageBlob is an encoded image waiting to be put in the blob store.
+type imageBlob struct {
+	data        []byte
+	contentType string
+}
+
+// makeImageBlobs makes the thumbnails of an image, sets the blob keys of the image and its
+// thumbnails, and returns the blobs to store by key. Each image gets its own random
+// prefix, so that its blobs never clash with another image's and their URLs can't be
+// guessed from the movie's ID.
+func (app *application) makeImageBlobs(image *data.MovieImage, original []byte) (map[string]imageBlob, error) {
+	img, err := imaging.Decode(original)
+	if err != nil {
+		return nil, errCorruptImage
+	}
+
+	random := make([]byte, 16)
+	_, err = rand.Read(random)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "images/" + hex.EncodeToString(random) + "/"
+
+	image.Key = prefix + "original" + imaging.Extension(image.ContentType)
+	blobs := map[string]imageBlob{image.Key: {data: original, contentType: image.ContentType}}
+
+	for _, size := range imageThumbnailSizes[image.Kind] {
+		resized, err := imaging.Resize(img, image.ContentType, size.width)
+		if err != nil {
+			return nil, err
+		}
+
+		thumbnail := data.ImageThumbnail{
+			Name:        size.name,
+			ContentType: resized.ContentType,
+			Width:       resized.Width,
+			Height:      resized.Height,
+			Key:         prefix + size.name + imaging.Extension(resized.ContentType),
+		}
+
+		image.Thumbnails = append(image.Thumbnails, thumbnail)
+		blobs[thumbnail.Key] = imageBlob{data: resized.Data, contentType: resized.ContentType}
+	}
+
+	return blobs, nil
+}
+
+// listMovieImagesHandler handles GET requests for the images of a movie, posters first,
+// with signed URLs to download them and their thumbnails. As with showMovieHandler, the
+// movie must be visible to the current user.
+func (app *application) listMovieImagesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie := app.getVisibleMovie(w, r, id, data.MovieProjection{Fields: []string{"id"}, Include: []string{"images"}})
+	if movie == nil {
+		return
+	}
+
+	for i := range movie.Images {
+		app.signImageURLs(r, &movie.Images[i])
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"images": movie.Images}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMovieImageHandler handles DELETE requests to remove an image of a movie, along with
+// its thumbnails. It responds with 404 Not Found if the movie has no such image.
+func (app *application) deleteMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	imageID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("image_id"), 10, 64)
+	if err != nil || imageID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	keys, err := app.models.Movies.DeleteImage(id, imageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The image is already gone from the movie, so a failure to delete its blobs is only
+	// logged rather than reported to the client.
+	app.deleteBlobs(keys)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// signImageURLs fills in the download URLs of an image and its thumbnails, valid for the
+// configured expiry time. A URL which can't be signed is logged and left empty.
+func (app *application) signImageURLs(r *http.Request, image *data.MovieImage) {
+	expiry := app.config.images.urlExpiry
+
+	url, err := app.blobs.SignedURL(image.Key, expiry)
+	if err != nil {
+		app.logError(r, err)
+	}
+	image.URL = url
+
+	for i := range image.Thumbnails {
+		url, err := app.blobs.SignedURL(image.Thumbnails[i].Key, expiry)
+		if err != nil {
+			app.logError(r, err)
+		}
+		image.Thumbnails[i].URL = url
+	}
+}
+
+// deleteBlobs removes blobs from the blob store, logging any which couldn't be removed.
+// It is used to clean up after images have been deleted or failed to be saved, when the
+// client's request may already have been cancelled, so it doesn't use the request's
+// context.
+func (app *application) deleteBlobs(keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, key := range keys {
+		err := app.blobs.Delete(ctx, key)
+		if err != nil {
+			app.logger.Error("failed to delete blob", "key", key, "error", err.Error())
+		}
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// Define constants for the supported import file formats.
+const (
+	importFormatCSV    = "csv"
+	importFormatNDJSON = "ndjson"
+)
+
+// importUploadTimeout is the time allowed to upload an import file which is processed as a
+// background job.
+const importUploadTimeout = 5 * time.Minute
+
+// importReader reads the rows of an import file one at a time, so that large files can be
+// processed without loading them into memory.
+type importReader interface {
+	// Next returns the next row, or io.EOF once there are no more rows. Problems with a
+	// single row are added to the row's Errors rather than returned as an error.
+	Next() (*data.ImportRow, error)
+}
+
+// csvImportReader reads movies from a CSV file. The first record must be a header naming
+// the columns: title, year, runtime and genres are required and external_key is optional.
+// The id and version columns of a CSV export are accepted and ignored, so that an export
+// can be imported as it is.
+// Runtimes are given in minutes (either "102" or "102 mins") and genres as a single
+// comma-separated field, such as "drama,crime".
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	row     int
+}
+
+// newCSVImportReader reads and checks the header of a CSV import file.
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil, newRequestError("body_empty", nil)
+		default:
+			return nil, newRequestError("csv_header_invalid", nil)
+		}
+	}
+
+	columns := make(map[string]int, len(header))
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !validator.PermittedValue(name, "title", "year", "runtime", "genres", "external_key", "id", "version") {
+			return nil, newRequestError("csv_header_unknown_column", messageParams{"column": name})
+		}
+
+		columns[name] = i
+	}
+
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, newRequestError("csv_header_missing_column", messageParams{"column": name})
+		}
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+// Next implements the importReader interface.
+func (c *csvImportReader) Next() (*data.ImportRow, error) {
+	record, err := c.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+
+	c.row++
+
+	row := data.NewImportRow(c.row)
+
+	if err != nil {
+		// Malformed records (such as a wrong number of fields) are reported against the
+		// row, and the rest of the file is still read. Any other error, such as the body
+		// being too large, ends the import.
+		var parseError *csv.ParseError
+		if !errors.As(err, &parseError) {
+			return nil, err
+		}
+
+		switch {
+		case errors.Is(parseError.Err, csv.ErrFieldCount):
+			row.Errors.AddErrorCode("row", "import_field_count", nil)
+		default:
+			row.Errors.AddErrorCode("row", "import_csv_record", nil)
+		}
+		return row, nil
+	}
+
+	// field returns the trimmed value of a column, or "" if the column wasn't given.
+	field := func(name string) string {
+		i, ok := c.columns[name]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	row.Movie.Title = field("title")
+	row.ExternalKey = field("external_key")
+
+	if s := field("year"); s != "" {
+		year, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			row.Errors.AddErrorCode("year", "integer", nil)
+		}
+		row.Movie.Year = int32(year)
+	}
+
+	if s := strings.TrimSuffix(field("runtime"), " mins"); s != "" {
+		runtime, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			row.Errors.AddErrorCode("runtime", "import_runtime", nil)
+		}
+		row.Movie.Runtime = data.Runtime(runtime)
+	}
+
+	if s := field("genres"); s != "" {
+		row.Movie.Genres = strings.Split(s, ",")
+		for i := range row.Movie.Genres {
+			row.Movie.Genres[i] = strings.TrimSpace(row.Movie.Genres[i])
+		}
+	}
+
+	return row, nil
+}
+
+// ndjsonImportReader reads movies from a newline-delimited JSON file, with one JSON
+// object per line in the same format as the body of POST /v1/movies plus an optional
+// "external_key" member. Blank lines are skipped, and rows are numbered by line.
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// newNDJSONImportReader returns an importReader for a newline-delimited JSON file.
+func newNDJSONImportReader(r io.Reader) *ndjsonImportReader {
+	scanner := bufio.NewScanner(r)
+
+	// Allow lines of up to 1MB, the same as the maximum body of a single movie request.
+	scanner.Buffer(make([]byte, 64*1024), 1_048_576)
+
+	return &ndjsonImportReader{scanner: scanner}
+}
+
+// Next implements the importReader interface.
+func (n *ndjsonImportReader) Next() (*data.ImportRow, error) {
+	for n.scanner.Scan() {
+		n.line++
+
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var input struct {
+			Title       string       `json:"title"`
+			Year        int32        `json:"year"`
+			Runtime     data.Runtime `json:"runtime"`
+			Genres      []string     `json:"genres"`
+			ExternalKey string       `json:"external_key"`
+		}
+
+		row := data.NewImportRow(n.line)
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+		if err != nil {
+			var unmarshalTypeError *json.UnmarshalTypeError
+
+			switch {
+			case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+				row.Errors.AddErrorCode(unmarshalTypeError.Field, jsonTypeCode(unmarshalTypeError.Type), nil)
+			case errors.Is(err, data.ErrInvalidRuntimeFormat):
+				row.Errors.AddErrorCode("runtime", "runtime_format", nil)
+			case strings.HasPrefix(err.Error(), "json: unknown field "):
+				field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+				row.Errors.AddErrorCode(field, "unknown_field", nil)
+			default:
+				row.Errors.AddErrorCode("row", "import_json_object", nil)
+			}
+			return row, nil
+		}
+
+		if dec.More() {
+			row.Errors.AddErrorCode("row", "import_json_object", nil)
+			return row, nil
+		}
+
+		row.ExternalKey = input.ExternalKey
+		row.Movie.Title = input.Title
+		row.Movie.Year = input.Year
+		row.Movie.Runtime = input.Runtime
+		row.Movie.Genres = input.Genres
+
+		return row, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d is longer than 1048576 bytes", n.line+1)
+		}
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// jsonTypeCode returns the validation code for a JSON value which can't be decoded into a
+// Go value of the given type, such as "integer" for an int32 field.
+func jsonTypeCode(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// newImportReader returns an importReader for the given format.
+func newImportReader(format string, r io.Reader) (importReader, error) {
+	if format == importFormatCSV {
+		return newCSVImportReader(r)
+	}
+	return newNDJSONImportReader(r), nil
+}
+
+// runImport reads every row from the reader, validates it with ValidateImportRow, and
+// writes the valid rows to the database in batches of the configured size. Invalid rows
+// are recorded in the report, with their error messages in the given locale, and skipped.
+// In a dry run nothing is written. If progress is not nil, it is called with the report
+// after each batch has been written.
+func (app *application) runImport(reader importReader, mode string, dryRun bool, userID int64, locale string, progress func(*data.ImportReport)) (*data.ImportReport, error) {
+	report := &data.ImportReport{DryRun: dryRun, Errors: []data.ImportRowError{}}
+
+	var batch []*data.ImportRow
+
+	// flush writes the current batch and records its outcome in the report.
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		created, updated, failed, err := app.models.Movies.Import(batch, mode, userID)
+		if err != nil {
+			return err
+		}
+
+		report.Created += created
+		report.Updated += updated
+
+		for _, row := range failed {
+			report.AddError(row, locale)
+		}
+
+		batch = nil
+
+		if progress != nil {
+			progress(report)
+		}
+
+		return nil
+	}
+
+	for {
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.TotalRows++
+
+		// Only validate rows which could be parsed, so that a value which couldn't be
+		// read isn't also reported as missing.
+		if row.Errors.Valid() {
+			data.ValidateImportRow(row.Errors, row)
+		}
+
+		if !row.Errors.Valid() {
+			report.AddError(row, locale)
+			continue
+		}
+
+		if dryRun {
+			continue
+		}
+
+		batch = append(batch, row)
+
+		if len(batch) >= app.config.imports.batchSize {
+			err = flush()
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, flush()
+}
+
+// importMoviesHandler handles HTTP POST requests to bulk import movies from a CSV
+// (text/csv) or newline-delimited JSON (application/x-ndjson) file in the request body.
+// Every row is validated with ValidateMovie, and valid rows are inserted in batches, each
+// inside a transaction. The following query string parameters are supported:
+//   - mode: "insert" (the default) always creates new movies, while "upsert" updates the
+//     movie with the same external_key if there is one (external keys are kept as the
+//     movies' external IDs in the data.ImportExternalIDSource source)
+//   - dry_run: if true, the rows are only validated and nothing is written
+//   - async: if true, the import runs as a background job
+//
+// Small files are imported straight away and a 200 OK response holds the report, listing
+// the errors for every rejected row in the request's locale (jobs use the locale of the
+// request which started them). Files larger than the configured limit (or of unknown
+// size) always run as a background job: a 202 Accepted response holds the job, whose
+// status and report can be polled at GET /v1/imports/:id.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	mode := app.readString(qs, "mode", data.ImportModeInsert)
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	async := app.readBool(qs, "async", false, v)
+
+	v.Apply("mode", validator.Enum(mode, data.ImportModeInsert, data.ImportModeUpsert).WithMessage("import_mode"))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// Choose the file format from the Content-Type header.
+	var format string
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		format = importFormatCSV
+	case "application/x-ndjson", "application/jsonl":
+		format = importFormatNDJSON
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	locale := app.errorLocale(w, r)
+
+	// Import small files of known size straight away. The whole body is read before
+	// anything is written, so that a truncated upload doesn't leave a partial import.
+	if !async && r.ContentLength >= 0 && r.ContentLength <= app.config.imports.syncMaxBytes {
+		r.Body = http.MaxBytesReader(w, r.Body, app.config.imports.syncMaxBytes)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		reader, err := newImportReader(format, bytes.NewReader(body))
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		report, err := app.runImport(reader, mode, dryRun, user.ID, locale, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"import": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Larger files may take longer to upload than the server's read timeout allows, so
+	// extend the deadline for this request. The server's write timeout runs from the end of
+	// the request headers too, so the write deadline is extended as well, leaving the usual
+	// time to send the response once the upload is complete. These are no-ops if they
+	// aren't supported.
+	uploadDeadline := time.Now().Add(importUploadTimeout)
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(uploadDeadline)
+	_ = rc.SetWriteDeadline(uploadDeadline.Add(10 * time.Second))
+
+	// Save the file to disk, so that it can be processed after the response is sent.
+	file, err := os.CreateTemp("", "greenlight-import-*")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	_, err = io.Copy(file, http.MaxBytesReader(w, r.Body, app.config.imports.maxBytes))
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = newRequestError("body_too_large", messageParams{"max": maxBytesError.Limit})
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	job := &data.ImportJob{
+		UserID: user.ID,
+		Format: format,
+		Mode:   mode,
+		DryRun: dryRun,
+		Status: data.ImportJobPending,
+		Report: data.ImportReport{DryRun: dryRun, Errors: []data.ImportRowError{}},
+	}
+
+	err = app.models.ImportJobs.Insert(job)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Process the file in a background goroutine, saving the job's progress after each
+	// batch, and remove the file when done.
+	app.background(func() {
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		app.processImportJob(job, file, locale)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/imports/%d", job.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"import_job": job}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// processImportJob runs an import job from the saved file, updating the job's status and
+// report in the database as it goes. Row errors are reported in the given locale.
+func (app *application) processImportJob(job *data.ImportJob, file *os.File, locale string) {
+	// save writes the current state of the job, logging (rather than returning) any
+	// error, since there is no client waiting for the result.
+	save := func() {
+		err := app.models.ImportJobs.Update(job)
+		if err != nil {
+			app.logger.Error(err.Error(), "import_job", job.ID)
+		}
+	}
+
+	job.Status = data.ImportJobRunning
+	save()
+
+	_, err := file.Seek(0, io.SeekStart)
+	if err == nil {
+		var reader importReader
+
+		reader, err = newImportReader(job.Format, file)
+		if err == nil {
+			var report *data.ImportReport
+
+			report, err = app.runImport(reader, job.Mode, job.DryRun, job.UserID, locale, func(report *data.ImportReport) {
+				job.Report = *report
+				save()
+			})
+			job.Report = *report
+		}
+	}
+
+	if err != nil {
+		job.Status = data.ImportJobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = data.ImportJobCompleted
+	}
+
+	save()
+}
+
+// showImportJobHandler handles HTTP GET requests for the status and report of an import
+// job. Users can only see the jobs they started themselves.
+func (app *application) showImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	job, err := app.models.ImportJobs.GetForUser(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"import_job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
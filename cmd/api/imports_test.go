@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// readImportRows reads every row of an import file.
+func readImportRows(t *testing.T, format, file string) []*data.ImportRow {
+	t.Helper()
+
+	reader, err := newImportReader(format, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("newImportReader: %v", err)
+	}
+
+	var rows []*data.ImportRow
+	for {
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// errorCodes returns the sorted fields and codes of a row's errors, as "field:code".
+func errorCodes(errs []validator.FieldError) []string {
+	var codes []string
+	for _, e := range errs {
+		codes = append(codes, e.Field+":"+e.Code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+func TestCSVImportReader(t *testing.T) {
+	file := "Title, Year, Runtime, Genres, External_Key\n" +
+		"Casablanca,1942,102 mins,\"drama, romance\",cb-1\n" +
+		"Alien,1979,117,horror,\n" +
+		"Heat,nineteen,170,crime,\n" +
+		"Up,2009\n"
+
+	rows := readImportRows(t, importFormatCSV, file)
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows; want 4", len(rows))
+	}
+
+	first := rows[0]
+	if first.Row != 1 || first.ExternalKey != "cb-1" || first.Movie.Title != "Casablanca" ||
+		first.Movie.Year != 1942 || first.Movie.Runtime != 102 ||
+		!slices.Equal(first.Movie.Genres, []string{"drama", "romance"}) || !first.Errors.Valid() {
+		t.Errorf("row 1: got %+v %+v", first, first.Movie)
+	}
+
+	if rows[1].Movie.Runtime != 117 || !rows[1].Errors.Valid() {
+		t.Errorf("row 2: got runtime %d and errors %v", rows[1].Movie.Runtime, rows[1].Errors.FieldErrors)
+	}
+
+	if got := errorCodes(rows[2].Errors.FieldErrors); !slices.Equal(got, []string{"year:integer"}) {
+		t.Errorf("row 3: got errors %v; want [year:integer]", got)
+	}
+
+	if got := errorCodes(rows[3].Errors.FieldErrors); !slices.Equal(got, []string{"row:import_field_count"}) {
+		t.Errorf("row 4: got errors %v; want [row:import_field_count]", got)
+	}
+}
+
+func TestCSVImportReaderHeader(t *testing.T) {
+	tests := map[string]string{
+		"empty":          "",
+		"unknown column": "title,year,runtime,genres,rating\n",
+		"missing column": "title,year,runtime\n",
+	}
+
+	for name, file := range tests {
+		_, err := newImportReader(importFormatCSV, strings.NewReader(file))
+		if err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestNDJSONImportReader(t *testing.T) {
+	file := `{"title":"Casablanca","year":1942,"runtime":"102 mins","genres":["drama"],"external_key":"cb-1"}` + "\n" +
+		"\n" +
+		`{"title":"Alien","year":"1979","runtime":"117 mins","genres":["horror"]}` + "\n" +
+		`{"title":"Heat","year":1995,"runtime":"170","genres":["crime"]}` + "\n" +
+		`{"title":"Up","rating":5}` + "\n" +
+		`{"title":"Up"} {"title":"Down"}` + "\n" +
+		`not json` + "\n"
+
+	rows := readImportRows(t, importFormatNDJSON, file)
+	if len(rows) != 6 {
+		t.Fatalf("got %d rows; want 6", len(rows))
+	}
+
+	first := rows[0]
+	if first.Row != 1 || first.ExternalKey != "cb-1" || first.Movie.Title != "Casablanca" ||
+		first.Movie.Runtime != 102 || !first.Errors.Valid() {
+		t.Errorf("line 1: got %+v %+v", first, first.Movie)
+	}
+
+	// Rows are numbered by line, so the blank line is counted but not returned.
+	want := []struct {
+		line  int
+		codes []string
+	}{
+		{3, []string{"year:integer"}},
+		{4, []string{"runtime:runtime_format"}},
+		{5, []string{"rating:unknown_field"}},
+		{6, []string{"row:import_json_object"}},
+		{7, []string{"row:import_json_object"}},
+	}
+
+	for i, w := range want {
+		row := rows[i+1]
+		if row.Row != w.line {
+			t.Errorf("row %d: got line %d; want %d", i+2, row.Row, w.line)
+		}
+		if got := errorCodes(row.Errors.FieldErrors); !slices.Equal(got, w.codes) {
+			t.Errorf("line %d: got errors %v; want %v", w.line, got, w.codes)
+		}
+	}
+}
+
+func TestRunImportDryRun(t *testing.T) {
+	app := newTestApplication(t)
+
+	file := "title,year,runtime,genres\n" +
+		"Casablanca,1942,102,drama\n" +
+		",1942,102,drama\n" +
+		"Metropolis,1800,153,\"sci-fi,sci-fi\"\n" +
+		"Heat,nineteen,170,crime\n"
+
+	reader, err := newImportReader(importFormatCSV, strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run only validates the rows, so it doesn't need a database.
+	report, err := app.runImport(reader, data.ImportModeInsert, true, 1, "fr", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.TotalRows != 4 || report.Failed != 3 || report.Created != 0 || !report.DryRun {
+		t.Errorf("got report %+v", report)
+	}
+
+	want := map[int][]string{
+		2: {"title:required"},
+		3: {"genres:unique", "year:min"},
+		4: {"year:integer"},
+	}
+
+	for _, rowErr := range report.Errors {
+		got := errorCodes(rowErr.Errors)
+		if !slices.Equal(got, want[rowErr.Row]) {
+			t.Errorf("row %d: got errors %v; want %v", rowErr.Row, got, want[rowErr.Row])
+		}
+	}
+
+	// Row errors are reported in the requested locale.
+	if len(report.Errors) > 0 {
+		if got, want := report.Errors[0].Errors[0].Message, "doit être renseigné"; got != want {
+			t.Errorf("got message %q; want %q", got, want)
+		}
+	}
+}
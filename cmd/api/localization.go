@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// readLocales returns the locales the client would like movie titles in, most preferred
+// first and in the canonical form of data.CanonicalLocale. A lang query parameter (a
+// comma-separated list such as "fr-CA,fr") takes precedence over the Accept-Language
+// header. Unrecognised locales, the "*" wildcard and locales with a quality of zero are
+// ignored. It returns nil if the client didn't ask for any locale.
+//
+// Because the response depends on the Accept-Language header, it also adds it to the
+// Vary header of the response.
+func (app *application) readLocales(w http.ResponseWriter, r *http.Request) []string {
+	w.Header().Add("Vary", "Accept-Language")
+
+	return requestLocales(r)
+}
+
+// requestLocales returns the locales the client would like movie titles in, as described
+// by readLocales, without touching the response headers.
+func requestLocales(r *http.Request) []string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		var locales []string
+
+		for _, tag := range strings.Split(lang, ",") {
+			if locale, ok := data.CanonicalLocale(strings.TrimSpace(tag)); ok {
+				locales = append(locales, locale)
+			}
+		}
+
+		return locales
+	}
+
+	header := r.Header.Get("Accept-Language")
+	if header == "" {
+		return nil
+	}
+
+	type weightedLocale struct {
+		locale  string
+		quality float64
+	}
+
+	var weighted []weightedLocale
+
+	for _, item := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = f
+		}
+
+		locale, ok := data.CanonicalLocale(strings.TrimSpace(tag))
+		if !ok || quality <= 0 {
+			continue
+		}
+
+		weighted = append(weighted, weightedLocale{locale: locale, quality: quality})
+	}
+
+	// Sort by quality, keeping the order of the header for locales of equal quality.
+	slices.SortStableFunc(weighted, func(a, b weightedLocale) int {
+		switch {
+		case a.quality > b.quality:
+			return -1
+		case a.quality < b.quality:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	locales := make([]string, len(weighted))
+	for i, wl := range weighted {
+		locales[i] = wl.locale
+	}
+
+	return locales
+}
+
+// localizeMovies sets the display title of each movie from the locales the client asked
+// for, if it asked for any. See readLocales and data.Movie.Localize. Handlers call it
+// through presentMovies.
+func (app *application) localizeMovies(w http.ResponseWriter, r *http.Request, movies ...*data.Movie) {
+	locales := app.readLocales(w, r)
+	if locales == nil {
+		return
+	}
+
+	for _, movie := range movies {
+		movie.Localize(locales)
+	}
+}
+
+// setAlternateTitleHandler handles PUT requests to set a movie's title in a locale, given
+// in the URL (such as "fr", "pt-BR" or "CA"), from a request body such as {"title": "..."}.
+// Any title the movie already had in that locale is replaced. On success the movie is
+// returned with its updated alternate titles.
+func (app *application) setAlternateTitleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	locale, ok := data.CanonicalLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale"))
+	v.Apply("locale", validator.Assert(ok, "locale"))
+
+	if data.ValidateAlternateTitle(v, input.Title); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Movies.SetAlternateTitle(id, locale, input.Title)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeUpdatedMovie(w, r, id)
+}
+
+// deleteAlternateTitleHandler handles DELETE requests to remove a movie's title in a
+// locale. It responds with 404 Not Found if the movie has no title in that locale.
+func (app *application) deleteAlternateTitleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	locale, ok := data.CanonicalLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale"))
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Movies.DeleteAlternateTitle(id, locale)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "alternate title successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setReleaseHandler handles PUT requests to set a movie's release in a country, given in
+// the URL as an ISO 3166-1 alpha-2 code, from a request body such as
+// {"date": "2010-07-16", "certification": "PG-13"}. Any release the movie already had in
+// that country is replaced. On success the movie is returned with its updated releases.
+func (app *application) setReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Date          string `json:"date"`
+		Certification string `json:"certification"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	release := &data.Release{
+		Country:       strings.ToUpper(httprouter.ParamsFromContext(r.Context()).ByName("country")),
+		Date:          input.Date,
+		Certification: input.Certification,
+	}
+
+	v := validator.New()
+
+	if data.ValidateRelease(v, release); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Movies.SetRelease(id, release)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeUpdatedMovie(w, r, id)
+}
+
+// deleteReleaseHandler handles DELETE requests to remove a movie's release in a country.
+// It responds with 404 Not Found if the movie has no release there.
+func (app *application) deleteReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	country := strings.ToUpper(httprouter.ParamsFromContext(r.Context()).ByName("country"))
+
+	err = app.models.Movies.DeleteRelease(id, country)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "release successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeUpdatedMovie sends a 200 OK response holding the current state of the movie, after
+// one of its related records has been changed, with the ETag of its new version.
+func (app *application) writeUpdatedMovie(w http.ResponseWriter, r *http.Request, id int64) {
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.presentMovies(w, r, movie)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieRepresentationETag(r, movie.Version, data.MovieProjection{}))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight.tomcat.net/internal/data"
+)
+
+// TestAlternateTitleChangesETag checks that changing a movie's alternate title gives the
+// movie a new entity tag, so that a client revalidating its cached copy gets the change
+// rather than 304 Not Modified, and an update made against the old version fails.
+func TestAlternateTitleChangesETag(t *testing.T) {
+	app := newTestApplication(t)
+	app.models = data.NewModels(newTestDB(t))
+
+	_, token := newTestUser(t, app, "movies:read", "movies:write")
+
+	movie := &data.Movie{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama"}}
+	if err := app.models.Movies.Insert(movie, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.models.Movies.DB.Exec("DELETE FROM movies WHERE id = $1", movie.ID) })
+
+	routes := app.routes()
+
+	send := func(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+		return w
+	}
+
+	target := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+	w := send(http.MethodGet, target, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: got status %d", w.Code)
+	}
+	oldETag := w.Header().Get("ETag")
+
+	w = send(http.MethodPut, target+"/titles/fr", `{"title": "Casablanca (version française)"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT title: got status %d", w.Code)
+	}
+	newETag := w.Header().Get("ETag")
+	if newETag == "" || newETag == oldETag {
+		t.Fatalf("PUT title: got ETag %s; want one other than %s", newETag, oldETag)
+	}
+
+	w = send(http.MethodGet, target, "", http.Header{"If-None-Match": {oldETag}})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != newETag {
+		t.Errorf("GET with the old ETag: got status %d and ETag %s; want 200 and %s", w.Code, w.Header().Get("ETag"), newETag)
+	}
+
+	w = send(http.MethodGet, target, "", http.Header{"If-None-Match": {newETag}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("GET with the new ETag: got status %d; want 304", w.Code)
+	}
+
+	w = send(http.MethodPatch, target, `{"runtime": "103 mins"}`, http.Header{"If-Match": {oldETag}, "Content-Type": {"application/json"}})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with the old ETag: got status %d; want 412", w.Code)
+	}
+}
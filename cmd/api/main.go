@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"expvar"
 	"flag"
@@ -15,7 +16,10 @@ import (
 
 	_ "github.com/lib/pq"
 	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/i18n"
 	"greenlight.tomcat.net/internal/mailer"
+	"greenlight.tomcat.net/internal/openapi"
+	"greenlight.tomcat.net/internal/storage"
 	"greenlight.tomcat.net/internal/vcs"
 )
 
@@ -46,6 +50,27 @@ var (
 //	  sender: the sender's name
 //	cors: CORS configuration, including:
 //	  trustedOrigins: A slice of trusted origins for CORS requests.
+//	trash: Settings for soft-deleted movies, including:
+//	  retention: How long a deleted movie is kept before it is purged (0 disables purging).
+//	  purgeInterval: How often the background purge runs.
+//	imports: Bulk movie import settings, including:
+//	  maxBytes: The maximum size of an import file.
+//	  syncMaxBytes: Larger files (or files of unknown size) are imported as a background job.
+//	  batchSize: The number of rows written to the database in each transaction.
+//	idempotency: Settings for requests made with an Idempotency-Key header, including:
+//	  ttl: How long the response to such a request is kept for replaying (0 disables idempotency keys).
+//	images: Movie image upload and storage settings, including:
+//	  maxBytes: The maximum size of an uploaded image.
+//	  store: Where images are kept ("local" or "s3").
+//	  localDir: The directory of the local store.
+//	  signingSecret: The secret used to sign the local store's download URLs.
+//	  urlExpiry: How long signed download URLs stay valid.
+//	  s3: The settings of the S3-compatible store.
+//	stats: Catalogue statistics settings, including:
+//	  materialized: Whether unfiltered statistics are read from the materialized views.
+//	  refreshInterval: How often the materialized views are refreshed.
+//	openapi: OpenAPI document settings, including:
+//	  validate: Whether requests are checked against the document before they reach the handlers.
 type config struct {
 	port int
 	env  string
@@ -70,6 +95,33 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	imports struct {
+		maxBytes     int64
+		syncMaxBytes int64
+		batchSize    int
+	}
+	idempotency struct {
+		ttl time.Duration
+	}
+	images struct {
+		maxBytes      int64
+		store         string
+		localDir      string
+		signingSecret string
+		urlExpiry     time.Duration
+		s3            storage.S3Config
+	}
+	stats struct {
+		materialized    bool
+		refreshInterval time.Duration
+	}
+	openapi struct {
+		validate bool
+	}
 }
 
 // application represents the core dependencies used throughout the application.
@@ -80,13 +132,19 @@ type config struct {
 //   - logger: Structured logger for application events and error reporting
 //   - models: Database access layer containing all data operations
 //   - mailer: Email sending client struct
+//   - blobs: Store for uploaded movie images
+//   - recommender: Chooses similar movies and personal picks (from the movies' content, as there are no ratings yet)
+//   - openapi: The OpenAPI document describing the API, which requests can be checked against
 //     = wg: sync.WaitGroup to count the goroutine the the background
 type application struct {
-	config config
-	logger *slog.Logger
-	models data.Models
-	mailer *mailer.Mailer
-	wg     sync.WaitGroup
+	config      config
+	logger      *slog.Logger
+	models      data.Models
+	mailer      *mailer.Mailer
+	blobs       storage.BlobStore
+	recommender data.Recommender
+	openapi     *openapi.Document
+	wg          sync.WaitGroup
 }
 
 // main is the entry point of the application. It initializes the application,
@@ -144,6 +202,53 @@ func main() {
 		return nil
 	})
 
+	// Register command-line flag for how long deleted movies stay in the trash (default: 30 days)
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "Time deleted movies are kept before being purged (0 disables purging)")
+
+	// Register command-line flag for how often the trash is purged (default: 1 hour)
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "Interval between purges of the movie trash")
+
+	// Register command-line flag for the maximum size of a movie import file (default: 100MB)
+	flag.Int64Var(&cfg.imports.maxBytes, "import-max-bytes", 100<<20, "Maximum size of a movie import file in bytes")
+
+	// Register command-line flag for the largest import file which is processed synchronously (default: 1MB)
+	flag.Int64Var(&cfg.imports.syncMaxBytes, "import-sync-max-bytes", 1<<20, "Largest movie import file processed synchronously, in bytes")
+
+	// Register command-line flag for the number of import rows written per transaction (default: 500)
+	flag.IntVar(&cfg.imports.batchSize, "import-batch-size", 500, "Number of movie import rows written per transaction")
+
+	// Register command-line flag for how long idempotency keys are kept (default: 24 hours)
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "Time responses to requests with an Idempotency-Key are kept (0 disables idempotency keys)")
+
+	// Register command-line flag for the maximum size of an uploaded movie image (default: 10MB)
+	flag.Int64Var(&cfg.images.maxBytes, "image-max-bytes", 10<<20, "Maximum size of an uploaded movie image in bytes")
+
+	// Register command-line flags for where movie images are stored (default: the local filesystem)
+	flag.StringVar(&cfg.images.store, "image-store", "local", "Movie image store (local|s3)")
+	flag.StringVar(&cfg.images.localDir, "image-local-dir", "./data/images", "Directory of the local movie image store")
+
+	// Register command-line flags for signed image download URLs. Without a secret, a random one
+	// is generated, and URLs signed by the local store stop working when the server restarts.
+	flag.StringVar(&cfg.images.signingSecret, "image-signing-secret", "", "Secret used to sign local image download URLs")
+	flag.DurationVar(&cfg.images.urlExpiry, "image-url-expiry", 15*time.Minute, "Time signed image download URLs stay valid")
+
+	// Register command-line flags for the S3-compatible image store
+	flag.StringVar(&cfg.images.s3.Endpoint, "s3-endpoint", "https://s3.amazonaws.com", "S3 endpoint URL")
+	flag.StringVar(&cfg.images.s3.Region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&cfg.images.s3.Bucket, "s3-bucket", "", "S3 bucket for movie images")
+	flag.StringVar(&cfg.images.s3.AccessKey, "s3-access-key", "", "S3 access key")
+	flag.StringVar(&cfg.images.s3.SecretKey, "s3-secret-key", "", "S3 secret key")
+	flag.BoolVar(&cfg.images.s3.PathStyle, "s3-path-style", false, "Use path-style S3 URLs (needed by most local S3 stand-ins)")
+
+	// Register command-line flags for reading catalogue statistics from materialized views
+	// (default: disabled, so statistics are always computed live)
+	flag.BoolVar(&cfg.stats.materialized, "stats-materialized", false, "Read unfiltered movie statistics from periodically refreshed materialized views")
+	flag.DurationVar(&cfg.stats.refreshInterval, "stats-refresh-interval", 15*time.Minute, "Interval between refreshes of the movie statistics views")
+
+	// Register a command-line flag to check requests against the OpenAPI document
+	// (default: disabled, so requests are only validated by the handlers)
+	flag.BoolVar(&cfg.openapi.validate, "openapi-validate", false, "Check request query strings and JSON bodies against the OpenAPI document")
+
 	// Register a command-line flag to display the application version and exit.
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
@@ -162,6 +267,20 @@ func main() {
 	// The NewTextHandler is used to format the log output as plain text.
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	// Warn about messages missing from the i18n catalogs. They fall back to English, so the
+	// server still works, but the catalogs should be completed.
+	for locale, keys := range i18n.Missing() {
+		logger.Warn("message catalog is incomplete", "locale", locale, "missing", keys)
+	}
+
+	// Load the OpenAPI document, which is embedded in the binary. It is served as it is, but
+	// is also decoded to check the registered routes and, if enabled, requests against it.
+	spec, err := openapi.Load(openAPIDocument)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// Open a database connection pool. This establishes a connection to the
 	// PostgreSQL database using the provided configuration. The connection pool
 	// allows for efficient reuse of database connections.
@@ -186,6 +305,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Open the store which uploaded movie images are kept in.
+	blobs, err := openBlobStore(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// Publish the application version to the /debug/vars endpoint.
 	// This allows monitoring tools to easily retrieve the current version.
 	expvar.NewString("version").Set(version)
@@ -210,11 +336,16 @@ func main() {
 
 	// Initialize the application struct. This creates an instance of the application
 	// struct, passing in the configuration and logger.
+	models := data.NewModels(db)
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer,
+		config:      cfg,
+		logger:      logger,
+		models:      models,
+		mailer:      mailer,
+		blobs:       blobs,
+		recommender: data.NewContentRecommender(models.Movies, nil),
+		openapi:     spec,
 	}
 
 	// Start the HTTP server and listen for incoming requests.
@@ -271,3 +402,25 @@ func openDB(cfg config) (*sql.DB, error) {
 	// If the ping is successful, the function returns the database connection pool.
 	return db, nil
 }
+
+// openBlobStore returns the BlobStore selected by the image-store flag. The local store's
+// signed URLs point at the /v1/blobs/ endpoint of this API, which it serves itself.
+func openBlobStore(cfg config) (storage.BlobStore, error) {
+	switch cfg.images.store {
+	case "local":
+		secret := []byte(cfg.images.signingSecret)
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			_, err := rand.Read(secret)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return storage.NewLocalStore(cfg.images.localDir, "/v1/blobs/", secret)
+	case "s3":
+		return storage.NewS3Store(cfg.images.s3)
+	default:
+		return nil, fmt.Errorf("unknown image store %q", cfg.images.store)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"expvar"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -119,8 +121,16 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 
 			// Check if the client's rate limiter allows this request.
 			if !clients[ip].limiter.Allow() {
-				// If not allowed (rate limit exceeded), unlock the mutex and send a 429 response.
+				// If not allowed (rate limit exceeded), find out how long until the limiter
+				// allows a request again (without taking it), so that the client knows when
+				// to retry. Retry-After is in whole seconds, so the wait is rounded up.
+				reservation := clients[ip].limiter.Reserve()
+				wait := reservation.Delay()
+				reservation.Cancel()
+
+				// Unlock the mutex and send a 429 response.
 				mu.Unlock() // Unlock before returning
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
@@ -280,6 +290,30 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// requireAnyPermission works like requirePermission, but lets the request through if the
+// user has at least one of the given permission codes. The handler can then check which of
+// them the user has, where they grant different abilities.
+func (app *application) requireAnyPermission(codes []string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !slices.ContainsFunc(codes, permissions.Include) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
 // enableCORS is a middleware that adds Cross-Origin Resource Sharing (CORS) headers
 // to responses based on a list of trusted origins.
 // It handles both simple requests and preflight requests (OPTIONS method).
@@ -305,9 +339,13 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 
+					// Allow browser clients to read the ETag header, so they can make conditional requests,
+					// and the Idempotent-Replayed header, so they can tell when a response was replayed.
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed")
+
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, X-Expected-Version, Idempotency-Key")
 						w.WriteHeader(http.StatusOK)
 						return
 					}
@@ -362,6 +400,23 @@ func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
 	return mw.wrapped.Write(b)
 }
 
+// Unwrap returns the wrapped http.ResponseWriter. This allows http.ResponseController to
+// reach the underlying connection, for example to flush streamed responses or to extend
+// the read and write deadlines of long-running requests.
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.wrapped
+}
+
+// The metrics published by the metrics middleware. They are created once for the process,
+// since expvar doesn't allow a name to be published twice, so that routes can be built more
+// than once (as the tests do).
+var (
+	totalRequestsReceived           = expvar.NewInt("total_requests_received")
+	totalResponsesSent              = expvar.NewInt("total_responses_sent")
+	totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_µs")
+	totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
+)
+
 // metrics is a middleware that collects and publishes application metrics.
 // It tracks the total number of requests received, the total number of responses sent,
 // the total processing time for requests, and the count of responses sent by HTTP status code.
@@ -374,13 +429,6 @@ func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
 // - total_requests_received: Total number of requests processed.
 // - total_responses_sent: Total number of responses sent.
 func (app *application) metrics(next http.Handler) http.Handler {
-	var (
-		totalRequestsReceived           = expvar.NewInt("total_requests_received")
-		totalResponsesSent              = expvar.NewInt("total_responses_sent")
-		totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_µs")
-		totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
-	)
-
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		// Increment the counter for total requests received.
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	tests := []struct {
+		name           string
+		rps            float64
+		wantRetryAfter string
+	}{
+		// The limiter refills a token every 2s, which is a whole number of seconds.
+		{"Whole seconds", 0.5, "2"},
+		// A token is back in 50ms, which is rounded up to the next whole second.
+		{"Rounded up", 20, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.limiter.enabled = true
+			app.config.limiter.rps = tt.rps
+			app.config.limiter.burst = 1
+
+			handler := app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			// Both requests come from the same address, so the second finds the burst used up.
+			first := httptest.NewRecorder()
+			handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil))
+			if first.Code != http.StatusNoContent || first.Header().Get("Retry-After") != "" {
+				t.Fatalf("first request: got status %d and Retry-After %q", first.Code, first.Header().Get("Retry-After"))
+			}
+
+			second := httptest.NewRecorder()
+			handler.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil))
+			if second.Code != http.StatusTooManyRequests {
+				t.Fatalf("second request: got status %d; want %d", second.Code, http.StatusTooManyRequests)
+			}
+			if got := second.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("got Retry-After %q; want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+// TestMetricsRoutesBuiltTwice checks that the metrics are published once for the process,
+// so that building the routes again doesn't panic, and that every handler chain counts
+// into the same metrics.
+func TestMetricsRoutesBuiltTwice(t *testing.T) {
+	app := newOpenAPITestApplication(t, false)
+
+	before := totalRequestsReceived.Value()
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d; want %d", w.Code, http.StatusOK)
+		}
+	}
+
+	if got := totalRequestsReceived.Value() - before; got != 2 {
+		t.Errorf("got %d requests counted; want 2", got)
+	}
+}
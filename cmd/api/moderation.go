@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// newMovieStatus decides the moderation status of a movie being created, from the status
+// the client asked for (which may be empty) and the user's permissions. Users with the
+// movies:write permission publish movies straight away unless they ask otherwise, while
+// users who may only submit movies have them moderated first: their movies start out
+// pending, or as drafts if they ask for that. Any problem is recorded in v.
+func (app *application) newMovieStatus(user *data.User, requested string, v *validator.Validator) (string, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	canPublish := permissions.Include("movies:write")
+
+	switch {
+	case requested == "" && canPublish:
+		return data.MovieStatusPublished, nil
+	case requested == "":
+		return data.MovieStatusPending, nil
+	case requested == data.MovieStatusPublished:
+		v.Apply("status", validator.Assert(canPublish, "movie_status_unpublished"))
+	default:
+		v.Apply("status", validator.Enum(requested, data.MovieStatusDraft, data.MovieStatusPending).WithMessage("movie_status_new"))
+	}
+
+	return requested, nil
+}
+
+// getVisibleMovie fetches a movie, with the fields chosen by the projection, and checks that
+// the current user may see it, sending a 404 Not Found response (so as not to reveal that
+// an unpublished movie exists) or a 500 Internal Server Error response if not. It returns
+// nil if a response has been sent.
+func (app *application) getVisibleMovie(w http.ResponseWriter, r *http.Request, id int64, projection data.MovieProjection) *data.Movie {
+	movie, err := app.models.Movies.GetProjected(id, projection)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	visible, err := app.canViewMovie(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+
+	if !visible {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return movie
+}
+
+// listSubmissionsHandler handles GET requests for the movies going through moderation.
+// The status parameter chooses which ones (pending by default, oldest first, which is the
+// moderators' review queue). Moderators see every user's submissions, and other users only
+// their own. It supports the usual page, page_size and sort parameters.
+func (app *application) listSubmissionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", data.MovieStatusPending)
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafelist = movieSortSafelist
+
+	v.Apply("status", validator.Enum(input.Status, data.MovieStatuses...).WithMessage("movie_status"))
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	submittedBy := user.ID
+	if permissions.Include("movies:moderate") {
+		submittedBy = 0
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllSubmissions(input.Status, submittedBy, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// submitMovieHandler handles POST requests to send a draft or rejected movie to the
+// moderators. Only the user who submitted the movie can do this. It responds with 409
+// Conflict if the movie is already pending or published.
+func (app *application) submitMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie := app.getVisibleMovie(w, r, id, data.MovieProjection{})
+	if movie == nil {
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if movie.SubmittedBy != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	movie, err = app.models.Movies.Submit(id, user.ID)
+	if err != nil {
+		app.moderationErrorResponse(w, r, err, id)
+		return
+	}
+
+	app.writeModeratedMovie(w, r, movie)
+}
+
+// approveMovieHandler handles POST requests from moderators to publish a pending movie.
+// The body is optional, and may hold a reason which is passed on to the submitter, such
+// as {"reason": "Thanks for the poster!"}. The submitter is notified by email.
+func (app *application) approveMovieHandler(w http.ResponseWriter, r *http.Request) {
+	app.moderateMovie(w, r, false)
+}
+
+// rejectMovieHandler handles POST requests from moderators to turn down a pending movie,
+// with a body giving the reason, such as {"reason": "This movie is already listed"}. The
+// submitter is notified by email, and can edit the movie and submit it again.
+func (app *application) rejectMovieHandler(w http.ResponseWriter, r *http.Request) {
+	app.moderateMovie(w, r, true)
+}
+
+// moderateMovie does the work of approveMovieHandler and rejectMovieHandler.
+func (app *application) moderateMovie(w http.ResponseWriter, r *http.Request, reject bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	// The reason is optional when approving a movie, so an empty body is allowed then.
+	if reject || r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+
+	if data.ValidateStatusReason(v, input.Reason, reject); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	var movie *data.Movie
+	if reject {
+		movie, err = app.models.Movies.Reject(id, input.Reason, user.ID)
+	} else {
+		movie, err = app.models.Movies.Approve(id, input.Reason, user.ID)
+	}
+	if err != nil {
+		app.moderationErrorResponse(w, r, err, id)
+		return
+	}
+
+	app.notifySubmitter(movie)
+
+	app.writeModeratedMovie(w, r, movie)
+}
+
+// moderationErrorResponse sends the response for an error returned by one of the moderation
+// steps of the MovieModel.
+func (app *application) moderationErrorResponse(w http.ResponseWriter, r *http.Request, err error, id int64) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrInvalidStatusTransition):
+		// Look the movie up again to tell the client which status it is in.
+		movie, err := app.models.Movies.Get(id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.invalidStatusTransitionResponse(w, r, movie.Status)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeModeratedMovie sends a 200 OK response holding a movie after a moderation step.
+func (app *application) writeModeratedMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie) {
+	app.presentMovies(w, r, movie)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieRepresentationETag(r, movie.Version, data.MovieProjection{}))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifySubmitter emails the user who submitted a movie to tell them that a moderator has
+// approved or rejected it, along with the moderator's reason. The email is sent in the
+// background, and failures are only logged.
+func (app *application) notifySubmitter(movie *data.Movie) {
+	if movie.SubmittedBy == 0 {
+		return
+	}
+
+	app.background(func() {
+		user, err := app.models.Users.Get(movie.SubmittedBy)
+		if err != nil {
+			app.logger.Error(err.Error())
+			return
+		}
+
+		approved := movie.Status == data.MovieStatusPublished
+
+		data := map[string]any{
+			"name":     user.Name,
+			"movieID":  movie.ID,
+			"title":    movie.Title,
+			"approved": approved,
+			"reason":   movie.StatusReason,
+		}
+
+		err = app.mailer.Send(user.Email, "movie_moderated.html", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
 
 	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/filter"
+	"greenlight.tomcat.net/internal/patch"
 	"greenlight.tomcat.net/internal/validator"
 )
 
@@ -19,12 +26,17 @@ import (
 //  5. Returns a 201 Created response with the newly created movie data
 //  6. Handles potential errors during JSON decoding, validation, and database operations
 //  7. Sets the Location header to the newly created resource
+//
+// An optional "status" member chooses the movie's moderation status (see newMovieStatus):
+// users with the movies:write permission publish movies unless they ask for "draft" or
+// "pending", and users with only movies:submit create pending movies or drafts.
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Title   string       `json:"title"`
 		Year    int32        `json:"year"`
 		Runtime data.Runtime `json:"runtime"`
 		Genres  []string     `json:"genres"`
+		Status  string       `json:"status"`
 	}
 
 	// Attempt to read and decode the JSON request body into the input struct.
@@ -45,14 +57,29 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// Create a new validator instance.
 	v := validator.New()
 
+	user := app.contextGetUser(r)
+
+	movie.Status, err = app.newMovieStatus(user, input.Status, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Movies which go through moderation remember who submitted them, so that only that user
+	// can see and submit them, and so that they can be told the moderators' decision.
+	if movie.Status != data.MovieStatusPublished {
+		movie.SubmittedBy = user.ID
+	}
+
 	if data.ValidateMovie(v, movie); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	// Insert the validated movie data into the database using the MovieModel.
+	// Insert the validated movie data into the database using the MovieModel, recording
+	// the current user as the author of the first revision.
 	// If the insertion fails, respond with a 500 Internal Server Error.
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(movie, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -63,6 +90,8 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// Set the Location header to point to the newly created movie resource
 	// The URL follows the pattern /v1/movies/{id} where {id} is the movie's database ID
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	// Set the ETag header so the client can make conditional requests against this version
+	headers.Set("ETag", movieETag(movie.Version, ""))
 
 	// Write the JSON response with:
 	// - HTTP status code 201 (Created)
@@ -83,7 +112,11 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 //   - Non-existent movie (404 Not Found)
 //   - Database errors (500 Internal Server Error)
 //
-// - Returns a JSON response with the movie data on success
+// - Returns a JSON response with the movie data on success, with an ETag header
+// - Returns 304 Not Modified with no body if the If-None-Match header matches the ETag
+//
+// The fields and include parameters choose the fields and related resources sent, as for
+// listMoviesHandler.
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the value of the "id" parameters from the slice.
 	id, err := app.readIDParam(r)
@@ -92,26 +125,55 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Retrieve the movie from the database using the provided ID
-	movie, err := app.models.Movies.Get(id)
-	if err != nil {
-		switch {
-		// If the error is ErrRecordNotFound, return a 404 Not Found response
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		// For all other errors, return a 500 Internal Server Error response
-		default:
-			app.serverErrorResponse(w, r, err)
+	v := validator.New()
+
+	projection := app.readMovieProjection(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// Retrieve the movie from the database using the provided ID. Movies which haven't been
+	// published are reported as not found, unless the user submitted them or moderates them.
+	movie := app.getVisibleMovie(w, r, id, projection)
+	if movie == nil {
+		return
+	}
+
+	// Choose the title to display from the client's preferred languages, and sign the
+	// download URLs of the movie's images.
+	app.presentMovies(w, r, movie)
+
+	// Set the ETag header from the movie's version number and the representation the client
+	// chose with the fields, include and lang parameters or the Accept-Language header (which
+	// presentMovies has added to the Vary header), so that a 304 Not Modified response only
+	// confirms the representation the client holds.
+	etag := movieRepresentationETag(r, movie.Version, projection)
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	// If the client already holds the current version of the movie, tell it so
+	// with a 304 Not Modified response instead of sending the movie again.
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListContains(ifNoneMatch, etag, true) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
 		}
-		// Return early since we encountered an error
+	}
+
+	// Keep only the fields and related resources the client chose.
+	presented, err := projection.Present(movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	// Write the JSON response with:
 	// - HTTP status code 200 (OK)
 	// - The movie data wrapped in an envelope
-	// - No additional headers (nil)
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	// - The ETag header
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": presented}, headers)
 	if err != nil {
 		// If JSON encoding fails, respond with a 500 Internal Server Error
 		app.serverErrorResponse(w, r, err)
@@ -122,15 +184,21 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 // The handler performs the following operations:
 //  1. Extracts and validates the movie ID from the URL path parameters
 //  2. Retrieves the existing movie record from the database
-//  3. Reads and decodes the JSON request body into a partial update struct
-//  4. Conditionally updates movie fields with non-nil values from the input
+//  3. Reads the request body, which may be a partial JSON object, a JSON Merge Patch
+//     (application/merge-patch+json) or a JSON Patch (application/json-patch+json)
+//  4. Applies the changes from the request body to the movie
 //  5. Validates the updated movie data using the validator
 //  6. Persists the changes to the database
-//  7. Returns the updated movie data as JSON with 200 OK status
+//  7. Returns the updated movie data as JSON with 200 OK status and the new ETag
+//
+// Clients can make the update conditional on the version they last read, by sending its
+// ETag in an If-Match header or its version number in an X-Expected-Version header.
 //
 // Error handling includes:
 //   - 404 Not Found for invalid/missing IDs or non-existent movies
-//   - 400 Bad Request for malformed JSON
+//   - 400 Bad Request for malformed JSON, an inapplicable patch or an invalid X-Expected-Version header
+//   - 409 Conflict if a JSON Patch "test" operation fails
+//   - 412 Precondition Failed if the movie no longer has the version the client expects
 //   - 422 Unprocessable Entity for validation failures
 //   - 500 Internal Server Error for database/processing failures
 func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -155,50 +223,56 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Define an input struct to hold the expected data from the request body
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+	// Users with only the movies:write:own permission can update the movies they created, and
+	// submitters can update their own drafts and rejected movies (see canEditMovie).
+	if !app.authorizeMovieEdit(w, r, movie) {
+		return
 	}
 
-	// Read and decode the JSON request body into the input struct
-	err = app.readJSON(w, r, &input)
+	// Check the version the client expects against the version we just loaded.
+	conditional, err := app.checkIfMatch(r, movie.Version)
 	if err != nil {
-		// Return 400 Bad Request if the JSON is malformed
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, errPreconditionFailed):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
-
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
-	}
-
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+	// Apply the changes in the request body to the movie, in the format given by the
+	// Content-Type header (a partial JSON object, a JSON Merge Patch or a JSON Patch)
+	err = app.readMovieChanges(w, r, movie)
+	if err != nil {
+		switch {
+		// Return 409 Conflict if a JSON Patch "test" operation didn't match the movie
+		case errors.Is(err, patch.ErrTestFailed):
+			app.patchTestFailedResponse(w, r)
+		// Return 400 Bad Request if the body is malformed or the patch can't be applied
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
 	}
 
 	// Initialize a new validator and validate the updated movie
 	v := validator.New()
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		// Return 422 Unprocessable Entity if validation fails
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	// Attempt to update the movie record in the database
-	err = app.models.Movies.Update(*movie)
+	// Attempt to update the movie record in the database, recording the current user
+	// as the author of the new revision
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
+		// If the client made the update conditional, a version mismatch means its
+		// precondition no longer holds, so return a 412 Precondition Failed response
+		case errors.Is(err, data.ErrEditConflict) && conditional:
+			app.preconditionFailedResponse(w, r)
 		// If we get an edit conflict error (version mismatch), return a 409 Conflict response
 		// This indicates the record was modified by another process since we fetched it
 		case errors.Is(err, data.ErrEditConflict):
@@ -212,17 +286,150 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	app.presentMovies(w, r, movie)
+
+	// Set the ETag header for the new version of the movie
+	headers := make(http.Header)
+	headers.Set("ETag", movieRepresentationETag(r, movie.Version, data.MovieProjection{}))
+
 	// Write the updated movie as JSON response with 200 OK status
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		// Return 500 Internal Server Error if JSON encoding fails
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// moviePatchDocument is the JSON document which JSON Merge Patch and JSON Patch requests
+// are applied to. It holds the fields of a movie which clients are allowed to change, in
+// the same format as they are sent in responses, so that paths such as "/genres/-" and
+// members such as "runtime": "102 mins" work as clients would expect.
+type moviePatchDocument struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+}
+
+// movieChanges holds the fields of a movie given in a partial JSON object. Fields which are
+// missing from the object are left as nil, and aren't changed when it is applied.
+type movieChanges struct {
+	Title   *string       `json:"title"`
+	Year    *int32        `json:"year"`
+	Runtime *data.Runtime `json:"runtime"`
+	Genres  []string      `json:"genres"`
+}
+
+// apply copies the fields which were given onto the movie.
+func (c movieChanges) apply(movie *data.Movie) {
+	if c.Title != nil {
+		movie.Title = *c.Title
+	}
+
+	if c.Year != nil {
+		movie.Year = *c.Year
+	}
+
+	if c.Runtime != nil {
+		movie.Runtime = *c.Runtime
+	}
+
+	if c.Genres != nil {
+		movie.Genres = c.Genres
+	}
+}
+
+// readMovieChanges reads the request body of a movie update and applies it to the movie.
+// The format of the body is chosen by the Content-Type header:
+//   - application/merge-patch+json: an RFC 7396 JSON Merge Patch, where null removes a field
+//   - application/json-patch+json: an RFC 6902 JSON Patch, including "test" operations
+//   - anything else: a JSON object holding the fields to replace (the original format)
+//
+// The patched movie is not validated here, so that all formats go through ValidateMovie
+// in the same way. A failed "test" operation results in an error wrapping patch.ErrTestFailed.
+func (app *application) readMovieChanges(w http.ResponseWriter, r *http.Request, movie *data.Movie) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != patch.MediaTypeMergePatch && mediaType != patch.MediaTypeJSONPatch {
+		// Read and decode the JSON request body into the fields to replace
+		var input movieChanges
+
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			return err
+		}
+
+		input.apply(movie)
+
+		return nil
+	}
+
+	body, err := app.readBody(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Encode the current movie as the document to be patched.
+	doc, err := json.Marshal(moviePatchDocument{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+	})
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+
+	switch mediaType {
+	case patch.MediaTypeMergePatch:
+		patched, err = patch.MergePatch(doc, body)
+	case patch.MediaTypeJSONPatch:
+		var ops []patch.Operation
+
+		ops, err = patch.DecodeOperations(body)
+		if err == nil {
+			patched, err = patch.Apply(doc, ops)
+		}
+	}
+	if err != nil {
+		var opErr *patch.OperationError
+
+		switch {
+		case errors.Is(err, patch.ErrTestFailed):
+			return err
+		case errors.As(err, &opErr):
+			return newRequestError("patch_operation_failed", messageParams{"index": opErr.Index, "op": opErr.Op, "path": opErr.Path})
+		case errors.Is(err, patch.ErrInvalidPatch):
+			return newRequestError("patch_invalid", nil)
+		default:
+			return err
+		}
+	}
+
+	// Decode the patched document back into the movie fields. Unknown members (such as an
+	// attempt to add "/id") are rejected just like unknown keys in a plain JSON body.
+	var result moviePatchDocument
+
+	err = app.decodeJSON(bytes.NewReader(patched), &result)
+	if err != nil {
+		return err
+	}
+
+	movie.Title = result.Title
+	movie.Year = result.Year
+	movie.Runtime = result.Runtime
+	movie.Genres = result.Genres
+
+	return nil
+}
+
 // deleteMovieHandler handles HTTP DELETE requests to remove a movie by its ID.
-// It expects the movie ID as a URL parameter, deletes the movie from the database,
-// and returns a confirmation message if successful.
+// It expects the movie ID as a URL parameter, moves the movie to the trash (from where
+// it can be restored until it is purged), and returns a confirmation message if successful.
+// Like updates, deletes can be made conditional with an If-Match or X-Expected-Version
+// header, in which case a 412 Precondition Failed response is sent on a version mismatch.
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the movie ID from the URL parameter.
 	id, err := app.readIDParam(r)
@@ -232,8 +439,8 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Attempt to delete the movie from the database.
-	err = app.models.Movies.Delete(id)
+	// Retrieve the movie so that its version can be checked against the client's precondition.
+	movie, err := app.models.Movies.Get(id)
 	if err != nil {
 		switch {
 		// If the movie does not exist, respond with 404 Not Found.
@@ -246,6 +453,47 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Users with only the movies:write:own permission can delete the movies they created.
+	if !app.authorizeMovieEdit(w, r, movie) {
+		return
+	}
+
+	conditional, err := app.checkIfMatch(r, movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPreconditionFailed):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	// For conditional deletes, only delete the movie if it still has the version which
+	// was checked above. A version of 0 deletes the movie whatever its version.
+	var version int32
+	if conditional {
+		version = movie.Version
+	}
+
+	// Attempt to delete the movie from the database, recording the current user
+	// as the author of the delete revision.
+	err = app.models.Movies.Delete(id, version, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		// If the movie does not exist, respond with 404 Not Found.
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		// If the movie was changed after its version was checked, respond with 412 Precondition Failed.
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		// For any other error, respond with 500 Internal Server Error.
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	// If deletion is successful, return a JSON response with a success message.
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
 	if err != nil {
@@ -254,13 +502,39 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// movieSortSafelist is the list of permitted sort keys for endpoints listing movies.
+var movieSortSafelist = []string{"id", "title", "year", "runtime", "updated_at", "-id", "-title", "-year", "-runtime", "-updated_at"}
+
+// movieListSortSafelist is the list of permitted sort keys for the movie list and export
+// endpoints, which also support the computed keys in data.MovieSortKeys.
+var movieListSortSafelist = append(slices.Clone(movieSortSafelist), "relevance", "release_date", "-relevance", "-release_date")
+
+// readMovieProjection reads the "fields" and "include" query string parameters, which
+// choose the fields of each movie and the related resources embedded in it (for example
+// ?fields=id,title,year&include=images), and validates them against their safelists.
+func (app *application) readMovieProjection(qs url.Values, v *validator.Validator) data.MovieProjection {
+	projection := data.MovieProjection{
+		Fields:  app.readCSV(qs, "fields", []string{}),
+		Include: app.readCSV(qs, "include", []string{}),
+	}
+
+	data.ValidateMovieProjection(v, projection)
+
+	return projection
+}
+
 // listMoviesHandler handles HTTP GET requests for listing movies with optional filters and pagination.
+// Movies are filtered with expressions such as filter[year][gte]=1990&filter[genres][in]=drama,crime
+// against data.MovieFilterSchema, and with the older title and genres parameters.
+// The fields and include parameters choose the fields and related resources sent for each movie,
+// and only the columns they need are read from the database.
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	// Define a struct to hold the expected query parameters.
 	var input struct {
-		Title        string   // Title filter (empty string means no title filtering)
-		Genres       []string // Genres to filter by (empty slice means no genre filtering)
-		data.Filters          // Pagination (page, page_size) and sorting (sort) parameters
+		Filter       filter.Filter        // Filter expressions and the title and genres parameters (empty means every movie)
+		Facets       []string             // Facets to aggregate over the matching movies (empty slice means none)
+		Projection   data.MovieProjection // Fields and related resources to send (empty means the full movie)
+		data.Filters                      // Pagination (page, page_size) and sorting (sort) parameters
 	}
 
 	// Create a new validator instance to collect validation errors.
@@ -269,33 +543,43 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	// Parse the query string parameters from the request URL.
 	qs := r.URL.Query()
 
-	// Read the "title" query parameter, defaulting to an empty string if not provided.
-	input.Title = app.readString(qs, "title", "")
+	// Read and validate the filter expressions, and the "title" and "genres" parameters.
+	input.Filter = filter.Parse(qs, data.MovieFilterSchema, v)
+
+	// Read the "facets" query parameter as a CSV, defaulting to an empty slice if not provided.
+	input.Facets = app.readCSV(qs, "facets", []string{})
 
-	// Read the "genres" query parameter as a CSV, defaulting to an empty slice if not provided.
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	// Read and validate the "fields" and "include" query parameters.
+	input.Projection = app.readMovieProjection(qs, v)
 
 	// Read the "page" query parameter as an integer, defaulting to 1 if not provided or invalid.
 	input.Page = app.readInt(qs, "page", 1, v)
 
 	input.PageSize = app.readInt(qs, "page_size", 20, v)
 
-	// Read the "sort" query parameter, defaulting to "id" if not provided.
+	// Read the "sort" query parameter, which may hold several comma-separated keys such as
+	// "-year,title", defaulting to "id" if not provided.
 	input.Sort = app.readString(qs, "sort", "id")
 
-	// Define the list of permitted sort values to prevent unsafe or invalid sort input.
-	input.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	// Use the list of permitted sort keys to prevent unsafe or invalid sort input, and the
+	// model's computed sort keys (such as relevance) to sort by them.
+	input.SortSafelist = movieListSortSafelist
+	input.SortKeys = data.MovieSortKeys
 
-	// Validate the filter parameters (page, page_size, sort) using the ValidateFilters function.
+	// Validate the filter parameters (page, page_size, sort) using the ValidateFilters function,
+	// and the requested facets against data.FacetSafelist using the ValidateFacets function.
 	// If any validation errors are present, send a 422 Unprocessable Entity response with the errors and return early.
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	data.ValidateFilters(v, input.Filters)
+	data.ValidateFacets(v, input.Facets)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
 	// Call the GetAll method on the MovieModel to retrieve a list of movies and pagination metadata
-	// based on the provided title, genres, and filter parameters (pagination and sorting).
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	// based on the provided filter, pagination and sorting parameters.
+	movies, metadata, err := app.models.Movies.GetAll(input.Filter, input.Filters, input.Projection)
 	if err != nil {
 		// If an error occurs while fetching movies from the database,
 		// respond with a 500 Internal Server Error and return early.
@@ -303,10 +587,103 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Choose the title to display for each movie from the client's preferred languages, and
+	// sign the download URLs of their images.
+	app.presentMovies(w, r, movies...)
+
+	// Keep only the fields and related resources the client chose.
+	presented := make([]any, len(movies))
+	for i, movie := range movies {
+		presented[i], err = input.Projection.Present(movie)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{"movies": presented, "metadata": metadata}
+
+	// If any facets were requested, compute their counts over the same filter and return
+	// them next to the pagination metadata.
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Movies.GetFacets(input.Filter, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env["facets"] = facets
+	}
+
 	// Write the list of movies as a JSON response with HTTP 200 OK status.
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		// If an error occurs while writing the JSON response, send a 500 Internal Server Error response.
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// listTrashedMoviesHandler handles HTTP GET requests for the movies which have been deleted
+// but not yet purged. It supports the usual page and page_size parameters, and sorting by
+// id, title or deleted_at (most recently deleted first by default).
+func (app *application) listTrashedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovieHandler handles HTTP POST requests to take a deleted movie back out of the
+// trash. It returns the restored movie, or 404 Not Found if the movie isn't in the trash.
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.presentMovies(w, r, movie)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieRepresentationETag(r, movie.Version, data.MovieProjection{}))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.tomcat.net/internal/openapi"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// openAPIDocument is the OpenAPI 3.1 document describing every route of the API. It is
+// maintained by hand alongside routes.go: when a route is added or changed, its operation
+// must be added or changed in openapi.json too. Routes missing from the document are
+// reported when the server starts (see checkOpenAPIRoutes).
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// openAPIHandler handles HTTP GET requests for the OpenAPI document, which is public so that
+// client generators and API explorers can read it without an authentication token.
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIDocument)
+}
+
+// routeRecorder is a httprouter.Router which keeps a list of the routes registered on it,
+// in the path syntax of the OpenAPI document, so that they can be checked against it.
+type routeRecorder struct {
+	*httprouter.Router
+	routes []openapi.Route
+}
+
+// Handler registers the handler with the router and records the route.
+func (rr *routeRecorder) Handler(method, path string, handler http.Handler) {
+	rr.routes = append(rr.routes, openapi.Route{Method: method, Path: openAPIPath(path)})
+	rr.Router.Handler(method, path, handler)
+}
+
+// HandlerFunc registers the handler function with the router and records the route.
+func (rr *routeRecorder) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	rr.Handler(method, path, handler)
+}
+
+// openAPIPath converts a httprouter path to the path syntax of OpenAPI, in which both
+// named parameters (:id) and catch-all parameters (*key) are written as {id} and {key}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// checkOpenAPIRoutes logs a warning for each registered route which is missing from the
+// OpenAPI document, so that the document can't silently fall behind routes.go. The routes
+// registered on a parameter and dispatched by staticParam, such as /v1/movies/trash, are
+// only checked as the parameter's route.
+func (app *application) checkOpenAPIRoutes(routes []openapi.Route) {
+	if app.openapi == nil {
+		return
+	}
+
+	for _, route := range app.openapi.Missing(routes) {
+		app.logger.Warn("route is missing from the OpenAPI document", "route", route.String())
+	}
+}
+
+// maxValidatedBodyBytes is the largest request body checked by validateRequest, which is
+// the same as the limit of readJSON. Larger bodies are passed on unchecked, for the handler
+// to reject.
+const maxValidatedBodyBytes = 1_048_576
+
+// validateRequest is a middleware which checks the query string parameters and JSON body of
+// each request against the operation of the OpenAPI document it is sent to, and sends a
+// 422 Unprocessable Entity response with the errors if they don't match, before the
+// request reaches the handler. It is enabled with the -openapi-validate flag.
+//
+// The checks are structural (types, required properties, unknown properties, enums and
+// ranges); handlers still validate everything themselves. Requests to paths which aren't
+// in the document, and bodies in media types which the document doesn't give a schema for,
+// such as CSV imports and image uploads, are passed on unchecked. Without the flag, next is
+// returned as it is.
+func (app *application) validateRequest(next http.Handler) http.Handler {
+	if !app.config.openapi.validate || app.openapi == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := app.openapi.Find(r.Method, r.URL.Path)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+
+		op.ValidateQuery(r.URL.Query(), v)
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "" {
+			mediaType = "application/json"
+		}
+
+		if r.Body != nil && op.HasBody(mediaType) {
+			// Read one byte more than the limit, to tell whether the body is too large.
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxValidatedBodyBytes+1))
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+
+			// Put back what was read, in front of anything which wasn't, for the handler.
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+			if len(body) <= maxValidatedBodyBytes {
+				op.ValidateBody(mediaType, body, v)
+			}
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
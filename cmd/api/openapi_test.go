@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/openapi"
+	"greenlight.tomcat.net/internal/storage"
+)
+
+// newOpenAPITestApplication returns a test application with the OpenAPI document loaded.
+func newOpenAPITestApplication(t *testing.T, validate bool) *application {
+	t.Helper()
+
+	spec, err := openapi.Load(openAPIDocument)
+	if err != nil {
+		t.Fatalf("openapi.Load: %v", err)
+	}
+
+	app := newTestApplication(t)
+	app.openapi = spec
+	app.config.openapi.validate = validate
+
+	return app
+}
+
+// TestOpenAPIDocumentCoversRoutes fails if any route registered by routes.go is missing
+// from openapi.json. The local blob store is used, so that its route is registered too.
+func TestOpenAPIDocumentCoversRoutes(t *testing.T) {
+	app := newOpenAPITestApplication(t, false)
+
+	blobs, err := storage.NewLocalStore(t.TempDir(), "/v1/blobs", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobs = blobs
+
+	router := app.router()
+	if len(router.routes) == 0 {
+		t.Fatal("no routes were recorded")
+	}
+
+	for _, route := range app.openapi.Missing(router.routes) {
+		t.Errorf("route %s is missing from the OpenAPI document", route)
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := map[string]string{
+		"/v1/movies":                            "/v1/movies",
+		"/v1/movies/:id":                        "/v1/movies/{id}",
+		"/v1/movies/:id/revisions/:version":     "/v1/movies/{id}/revisions/{version}",
+		"/v1/blobs/*key":                        "/v1/blobs/{key}",
+		"/v1/external-ids/:source/:external_id": "/v1/external-ids/{source}/{external_id}",
+	}
+
+	for path, want := range tests {
+		if got := openAPIPath(path); got != want {
+			t.Errorf("openAPIPath(%q) = %q; want %q", path, got, want)
+		}
+	}
+}
+
+// serveValidated sends a request through validateRequest, reporting whether it reached the
+// next handler.
+func serveValidated(app *application, method, target, body string) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r = app.contextSetUser(r, data.AnonymousUser)
+
+	w := httptest.NewRecorder()
+	app.validateRequest(next).ServeHTTP(w, r)
+
+	return w, reached
+}
+
+func TestValidateRequest(t *testing.T) {
+	app := newOpenAPITestApplication(t, true)
+
+	t.Run("Rejected body", func(t *testing.T) {
+		w, reached := serveValidated(app, http.MethodPost, "/v1/movies", `{"title": 42, "year": 1942, "runtime": "102 mins", "genres": ["drama"], "rating": 5}`)
+
+		if reached {
+			t.Error("the request reached the handler")
+		}
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("got status %d; want %d", w.Code, http.StatusUnprocessableEntity)
+		}
+
+		var problem struct {
+			Code   string `json:"code"`
+			Errors []struct {
+				Field string `json:"field"`
+				Code  string `json:"code"`
+			} `json:"errors"`
+		}
+
+		err := json.NewDecoder(w.Body).Decode(&problem)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make(map[string]string)
+		for _, e := range problem.Errors {
+			got[e.Field] = e.Code
+		}
+
+		if problem.Code != codeValidationFailed || got["title"] != "type" || got["rating"] != "unknown_field" {
+			t.Errorf("got problem %+v", problem)
+		}
+	})
+
+	t.Run("Rejected query", func(t *testing.T) {
+		w, reached := serveValidated(app, http.MethodGet, "/v1/movies?page=first", "")
+
+		if reached || w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d, reached %t; want %d", w.Code, reached, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("Valid body", func(t *testing.T) {
+		w, reached := serveValidated(app, http.MethodPost, "/v1/movies", `{"title": "Casablanca", "year": 1942, "runtime": "102 mins", "genres": ["drama"]}`)
+
+		if !reached || w.Code != http.StatusNoContent {
+			t.Errorf("got status %d, reached %t; want the handler's response", w.Code, reached)
+		}
+	})
+
+	t.Run("Undocumented path", func(t *testing.T) {
+		_, reached := serveValidated(app, http.MethodPost, "/v1/nowhere", `{"title": 42}`)
+
+		if !reached {
+			t.Error("the request didn't reach the handler")
+		}
+	})
+}
+
+func TestValidateRequestDisabled(t *testing.T) {
+	app := newOpenAPITestApplication(t, false)
+
+	w, reached := serveValidated(app, http.MethodPost, "/v1/movies", `{"title": 42, "rating": 5}`)
+
+	if !reached || w.Code != http.StatusNoContent {
+		t.Errorf("got status %d, reached %t; want the request passed on unchecked", w.Code, reached)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+)
+
+// The functions in this file make up the authorization policy for individual movies. The
+// requirePermission and requireAnyPermission middleware only check that the user holds a
+// permission which may allow a request; these functions then decide whether it covers the
+// particular movie, such as a permission which only applies to the user's own movies.
+
+// canViewMovie reports whether the current user may see a movie. Published movies can be
+// seen by everyone, while movies going through moderation can only be seen by the user
+// who submitted them and by moderators.
+func (app *application) canViewMovie(r *http.Request, movie *data.Movie) (bool, error) {
+	if movie.Status == data.MovieStatusPublished {
+		return true, nil
+	}
+
+	user := app.contextGetUser(r)
+	if movie.SubmittedBy != 0 && movie.SubmittedBy == user.ID {
+		return true, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include("movies:moderate"), nil
+}
+
+// canEditMovie reports whether the current user may update or delete a movie. The
+// movies:write permission allows changes to any movie, while movies:write:own only allows
+// changes to the movies which the user created. Movies whose creator isn't known (because
+// they were created before it was recorded, or the user has since been deleted) can only
+// be changed with movies:write. Users with movies:submit may also change the movies they
+// submitted while those are drafts or have been rejected, so that they can fix them and
+// submit them again; once a movie is pending or published, only the write permissions apply.
+func (app *application) canEditMovie(r *http.Request, movie *data.Movie) (bool, error) {
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if permissions.Include("movies:write") {
+		return true, nil
+	}
+
+	if permissions.Include("movies:write:own") && movie.CreatedBy != 0 && movie.CreatedBy == user.ID {
+		return true, nil
+	}
+
+	unpublished := movie.Status == data.MovieStatusDraft || movie.Status == data.MovieStatusRejected
+
+	return permissions.Include("movies:submit") && unpublished && movie.SubmittedBy != 0 && movie.SubmittedBy == user.ID, nil
+}
+
+// authorizeMovieEdit checks canEditMovie for a movie which is about to be changed, sending
+// a 403 Forbidden response if the user may not change it, or a 500 Internal Server Error
+// response if the check fails. It returns false if a response has been sent.
+func (app *application) authorizeMovieEdit(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
+	allowed, err := app.canEditMovie(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !allowed {
+		app.notPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// readRecommendationLimit reads the limit parameter of the recommendation endpoints, which
+// defaults to 10 and can be at most 50.
+func (app *application) readRecommendationLimit(r *http.Request, v *validator.Validator) int {
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+
+	v.Apply("limit",
+		validator.Min(limit, 1).WithMessage("greater_than_zero"),
+		validator.Max(limit, 50).WithMessage("maximum"),
+	)
+
+	return limit
+}
+
+// similarMoviesHandler handles GET requests for the movies most like a movie, for "more
+// like this" lists on movie pages. Each recommendation holds the movie, its score between
+// 0 and 1, and the reasons it was chosen, such as "same genres". Movies which the user
+// can't see are reported as not found, as by showMovieHandler.
+func (app *application) similarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	limit := app.readRecommendationLimit(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie := app.getVisibleMovie(w, r, id, data.MovieProjection{})
+	if movie == nil {
+		return
+	}
+
+	recommendations, err := app.recommender.Similar(movie, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeRecommendations(w, r, recommendations)
+}
+
+// listRecommendationsHandler handles GET requests for the current user's personal picks,
+// based on the movies they rated highly and their watchlist. Users the recommender knows
+// nothing about yet are recommended the newest movies in the catalogue.
+func (app *application) listRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	limit := app.readRecommendationLimit(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	recommendations, err := app.recommender.Recommend(app.contextGetUser(r).ID, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeRecommendations(w, r, recommendations)
+}
+
+// writeRecommendations sends a 200 OK response holding recommendations, presenting their
+// movies in the same way as other movie responses.
+func (app *application) writeRecommendations(w http.ResponseWriter, r *http.Request, recommendations []data.Recommendation) {
+	movies := make([]*data.Movie, len(recommendations))
+	for i := range recommendations {
+		movies[i] = recommendations[i].Movie
+	}
+
+	app.presentMovies(w, r, movies...)
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"recommendations": recommendations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// authorizeRevisionsView checks that the current user may see the revision history of a
+// movie, sending a 404 Not Found or 500 Internal Server Error response if not, in the same
+// way as getVisibleMovie. The history outlives the movie, so movies in the trash are
+// checked too, and the history of a movie which has been purged (whose status is no longer
+// known) can only be seen by moderators. It returns false if a response has been sent.
+func (app *application) authorizeRevisionsView(w http.ResponseWriter, r *http.Request, id int64) bool {
+	movie, err := app.models.Movies.GetModerationState(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			movie = &data.Movie{ID: id}
+		default:
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+	}
+
+	visible, err := app.canViewMovie(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !visible {
+		app.notFoundResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// listMovieRevisionsHandler handles GET requests for the revision history of a movie.
+// The history is kept after a movie has been deleted, so this handler doesn't require the
+// movie itself to still exist, but unpublished movies' history is only shown to the users
+// who may see the movie (see authorizeRevisionsView). It supports the usual page and
+// page_size parameters and a sort parameter of "version" or "-version" (newest first, the
+// default).
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-version")
+	input.SortSafelist = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	if !app.authorizeRevisionsView(w, r, id) {
+		return
+	}
+
+	revisions, metadata, err := app.models.MovieRevisions.GetAllForMovie(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// A movie which has never existed has no revisions at all.
+	if metadata.TotalRecords == 0 && input.Page == 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showMovieRevisionHandler handles GET requests for a single version of a movie,
+// returning the snapshot of the movie at that version along with who changed it, when,
+// and which fields were changed. As for listMovieRevisionsHandler, it is only shown to the
+// users who may see the movie.
+func (app *application) showMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.authorizeRevisionsView(w, r, id) {
+		return
+	}
+
+	revision, err := app.models.MovieRevisions.Get(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovieRevisionHandler handles POST requests which roll a movie back to the values
+// it held at a previous version. The restore is applied as a normal update: the restored
+// values are validated with ValidateMovie and saved through the optimistic-locking path,
+// so it creates a new version (and revision) rather than rewriting history. As with
+// updates, the If-Match and X-Expected-Version headers are honoured.
+func (app *application) restoreMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Retrieve the current movie record. Deleted movies can't be restored this way.
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	conditional, err := app.checkIfMatch(r, movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPreconditionFailed):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	// Retrieve the revision holding the values to restore.
+	revision, err := app.models.MovieRevisions.Get(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Copy the restored values onto the current record, keeping its current version so
+	// that the update fails with an edit conflict if the movie changes in the meantime.
+	movie.Title = revision.Movie.Title
+	movie.Year = revision.Movie.Year
+	movie.Runtime = revision.Movie.Runtime
+	movie.Genres = revision.Movie.Genres
+
+	// The old values may no longer pass validation (for example if the rules have
+	// become stricter since), so they are checked like any other update.
+	v := validator.New()
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && conditional:
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.presentMovies(w, r, movie)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieRepresentationETag(r, movie.Version, data.MovieProjection{}))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -5,13 +5,36 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"greenlight.tomcat.net/internal/storage"
 )
 
 // routes returns a http.Handler that serves the application's routes with middleware applied.
-// It configures the router with custom error handlers and registers all application routes.
 func (app *application) routes() http.Handler {
-	// Initialize a new httprouter instance which implements the http.Handler interface
-	router := httprouter.New()
+	router := app.router()
+
+	// Warn about any of the routes which the OpenAPI document doesn't describe.
+	app.checkOpenAPIRoutes(router.routes)
+
+	// When enabled, check requests against the OpenAPI document before they reach the router.
+	// This runs after authenticate, so that requests with an invalid token are still rejected
+	// first, but before the permission checks of the routes themselves.
+	handler := app.validateRequest(router)
+
+	// Wrap the router with the following middleware:
+	// 1. recoverPanic: Gracefully handles panics to prevent server crashes and return controlled responses.
+	// 2. enableCORS: Adds CORS headers to responses.
+	// 3. rateLimit: Implements rate limiting to prevent abuse and ensure fair usage.
+	// 4. authenticate: Handles user authentication based on the "Authorization" header.
+	// 5. metrics: Collects and publishes application metrics.
+	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(handler)))))
+}
+
+// router configures a router with custom error handlers and registers all application
+// routes on it, without any of the middleware which routes applies to every request.
+func (app *application) router() *routeRecorder {
+	// Initialize a new httprouter instance which implements the http.Handler interface.
+	// The routes registered on it are recorded, to be checked against the OpenAPI document.
+	router := &routeRecorder{Router: httprouter.New()}
 
 	// Custom error handlers for the router:
 	// NotFound - handles requests to undefined routes (404 errors)
@@ -26,28 +49,131 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
+	// GET /v1/openapi.json - Returns the OpenAPI 3.1 document describing every route below.
+	// Any route added here must also be added to openapi.json, or a warning is logged at startup.
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler)
+
 	// GET /v1/movies - Retrieves a list of movies, applying the requireActivatedUser middleware
 	// to ensure only activated users can access this resource.
+	// The movie-reading routes choose each movie's display_title from a lang parameter or the Accept-Language header.
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
 
 	// POST /v1/movies - Creates a new movie, applying the requireActivatedUser middleware
 	// to ensure only activated users can access this resource.
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
+	// The movie-changing routes below are wrapped with the idempotent middleware, so that clients can
+	// safely retry them by sending an Idempotency-Key header.
+	// Users with the movies:submit permission can also create movies, which are moderated before they are published.
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requireAnyPermission([]string{"movies:write", "movies:submit"}, app.idempotent(app.createMovieHandler)))
 
 	// GET /v1/movies/:id - Retrieves a specific movie by ID, applying the requireActivatedUser middleware.
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
+	// GET /v1/movies/trash - Lists the deleted movies which haven't been purged yet (requires movies:write).
+	// GET /v1/movies/export - Streams the whole catalogue (or the movies matching the list filters) as CSV, NDJSON or JSON.
+	// GET /v1/movies/duplicates - Checks whether a movie with the given title, year and runtime would be a duplicate.
+	// GET /v1/movies/submissions - Lists the movies going through moderation: every user's for moderators, otherwise the user's own.
+	// GET /v1/movies/changes - Returns the movies changed and deleted since a sync token, for clients keeping an offline copy.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticParam("id", map[string]http.HandlerFunc{
+		"trash":       app.requirePermission("movies:write", app.listTrashedMoviesHandler),
+		"export":      app.requirePermission("movies:read", app.exportMoviesHandler),
+		"duplicates":  app.requirePermission("movies:read", app.checkDuplicatesHandler),
+		"submissions": app.requireAnyPermission([]string{"movies:submit", "movies:moderate"}, app.listSubmissionsHandler),
+		"changes":     app.requirePermission("movies:read", app.listMovieChangesHandler),
+	}, app.requirePermission("movies:read", app.showMovieHandler)))
 
 	// PATCH /v1/movies/:id - Updates a specific movie by ID, applying the requireActivatedUser middleware.
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
+	// Users with movies:write:own rather than movies:write can only update the movies they created, and
+	// users with only movies:submit can only update their own submissions while they are drafts or rejected.
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requireAnyPermission([]string{"movies:write", "movies:write:own", "movies:submit"}, app.idempotent(app.updateMovieHandler)))
 
 	// DELETE /v1/movies/:id - Deletes a specific movie by ID, applying the requireActivatedUser middleware.
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	// Users with movies:write:own rather than movies:write can only delete the movies they created.
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requireAnyPermission([]string{"movies:write", "movies:write:own"}, app.idempotent(app.deleteMovieHandler)))
+
+	// POST /v1/movies/import - Bulk imports movies from a CSV or NDJSON file in the request body.
+	// POST /v1/movies/batch - Applies a list of create, update and delete operations, atomically or one by one.
+	// They are registered on the :id parameter because httprouter doesn't allow a static segment next to it;
+	// other POST requests to /v1/movies/:id are not allowed.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticParam("id", map[string]http.HandlerFunc{
+		"import": app.requirePermission("movies:write", app.importMoviesHandler),
+		"batch":  app.requirePermission("movies:write", app.idempotent(app.batchMoviesHandler)),
+	}, app.methodNotAllowedResponse))
+
+	// GET /v1/imports/:id - Retrieves the status and report of a background movie import job.
+	router.HandlerFunc(http.MethodGet, "/v1/imports/:id", app.requirePermission("movies:write", app.showImportJobHandler))
+
+	// POST /v1/movies/:id/restore - Takes a deleted movie back out of the trash.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.idempotent(app.restoreMovieHandler)))
+
+	// GET /v1/movies/:id/revisions - Lists the revision history of a movie, newest first.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission("movies:read", app.listMovieRevisionsHandler))
+
+	// GET /v1/movies/:id/revisions/:version - Retrieves a single version of a movie.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version", app.requirePermission("movies:read", app.showMovieRevisionHandler))
+
+	// POST /v1/movies/:id/revisions/:version/restore - Rolls a movie back to the values of a previous version.
+	// The restore is saved as a new version using the same optimistic locking as PATCH /v1/movies/:id.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/restore", app.requirePermission("movies:write", app.idempotent(app.restoreMovieRevisionHandler)))
+
+	// POST /v1/movies/:id/submit - Sends a draft or rejected movie to the moderators (only by the user who submitted it).
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/submit", app.requirePermission("movies:submit", app.idempotent(app.submitMovieHandler)))
+
+	// POST /v1/movies/:id/approve - Publishes a pending movie and notifies its submitter (requires movies:moderate).
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/approve", app.requirePermission("movies:moderate", app.idempotent(app.approveMovieHandler)))
+
+	// POST /v1/movies/:id/reject - Rejects a pending movie with a reason and notifies its submitter (requires movies:moderate).
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reject", app.requirePermission("movies:moderate", app.idempotent(app.rejectMovieHandler)))
+
+	// GET /v1/movies/:id/duplicates - Lists the movies which look like duplicates of a movie, scored by similarity.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/duplicates", app.requirePermission("movies:read", app.listMovieDuplicatesHandler))
+
+	// GET /v1/movies/:id/similar - Lists the movies most like a movie, for "more like this" lists.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.requirePermission("movies:read", app.similarMoviesHandler))
+
+	// POST /v1/movies/:id/merge - Merges a duplicate movie into this one (requires the movies:merge permission).
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/merge", app.requirePermission("movies:merge", app.idempotent(app.mergeMovieHandler)))
+
+	// PUT /v1/movies/:id/external-ids/:source - Sets the movie's identifier in another catalogue, such as IMDb or TMDB.
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/external-ids/:source", app.requirePermission("movies:write", app.idempotent(app.setMovieExternalIDHandler)))
+
+	// DELETE /v1/movies/:id/external-ids/:source - Removes the movie's identifier in another catalogue.
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/external-ids/:source", app.requirePermission("movies:write", app.idempotent(app.deleteMovieExternalIDHandler)))
+
+	// PUT /v1/movies/:id/titles/:locale - Sets the movie's alternate title in a language or region, such as fr, pt-BR or CA.
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/titles/:locale", app.requirePermission("movies:write", app.idempotent(app.setAlternateTitleHandler)))
+
+	// DELETE /v1/movies/:id/titles/:locale - Removes the movie's alternate title in a language or region.
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/titles/:locale", app.requirePermission("movies:write", app.idempotent(app.deleteAlternateTitleHandler)))
+
+	// PUT /v1/movies/:id/releases/:country - Sets the movie's release date and certification in a country.
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/releases/:country", app.requirePermission("movies:write", app.idempotent(app.setReleaseHandler)))
+
+	// DELETE /v1/movies/:id/releases/:country - Removes the movie's release in a country.
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/releases/:country", app.requirePermission("movies:write", app.idempotent(app.deleteReleaseHandler)))
+
+	// POST /v1/movies/:id/images - Uploads a poster or backdrop image as multipart/form-data, and makes its thumbnails.
+	// Uploads are too large for the idempotent middleware, which keeps request bodies of up to 1MB.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/images", app.requirePermission("movies:write", app.uploadMovieImageHandler))
+
+	// GET /v1/movies/:id/images - Lists the movie's images, with signed URLs to download them and their thumbnails.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/images", app.requirePermission("movies:read", app.listMovieImagesHandler))
+
+	// DELETE /v1/movies/:id/images/:image_id - Removes an image of the movie along with its thumbnails.
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/images/:image_id", app.requirePermission("movies:write", app.idempotent(app.deleteMovieImageHandler)))
+
+	// GET /v1/blobs/*key - Serves images kept in the local blob store. Requests must carry the signature
+	// of a signed URL instead of an authentication token. Images kept in S3 are downloaded from S3 itself.
+	if local, ok := app.blobs.(*storage.LocalStore); ok {
+		router.Handler(http.MethodGet, "/v1/blobs/*key", local)
+	}
+
+	// GET /v1/external-ids/:source/:external_id - Looks up a movie by its identifier in another catalogue.
+	router.HandlerFunc(http.MethodGet, "/v1/external-ids/:source/:external_id", app.requirePermission("movies:read", app.showMovieByExternalIDHandler))
 
 	// POST /v1/users - Registers a new user account
 	// Requires name, email and password in request body
 	// Validates input and returns 201 Created on success
 	// Returns 400 Bad Request for invalid data or 409 Conflict for duplicate email
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	// Accepts an Idempotency-Key header, so that a retried registration doesn't send a second activation email
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.idempotent(app.registerUserHandler))
 
 	// PUT /v1/users/activated - Activates a registered user account
 	// Requires a valid activation token in the request body, typically sent via email
@@ -56,18 +182,37 @@ func (app *application) routes() http.Handler {
 	// If the token is not found, which could indicate it was already used or never existed, it returns 404 Not Found
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 
+	// GET /v1/users/me/recommendations - Lists personal movie picks for the current user.
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/recommendations", app.requirePermission("movies:read", app.listRecommendationsHandler))
+
 	// POST /v1/tokens/authentication - Creates a new authentication token for a user
 	// Requires valid user credentials (email and password) in the request body
 	// On success, it returns a new authentication token that can be used to access protected resources
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
+	// GET /v1/stats/movies - Returns statistics about the catalogue, optionally grouped by genre, year, decade or month
+	// Requires the stats:read permission
+	router.HandlerFunc(http.MethodGet, "/v1/stats/movies", app.requirePermission("stats:read", app.movieStatsHandler))
+
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	// Wrap the router with the following middleware:
-	// 1. recoverPanic: Gracefully handles panics to prevent server crashes and return controlled responses.
-	// 2. enableCORS: Adds CORS headers to responses.
-	// 3. rateLimit: Implements rate limiting to prevent abuse and ensure fair usage.
-	// 4. authenticate: Handles user authentication based on the "Authorization" header.
-	// 5. metrics: Collects and publishes application metrics.
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	return router
+}
+
+// staticParam returns a handler for a route whose named parameter may also hold a fixed
+// value. httprouter doesn't allow a static path segment (such as /v1/movies/trash) to sit
+// next to a named parameter (such as /v1/movies/:id), so these routes are registered once
+// on the parameter and dispatched here: if the parameter matches one of the keys of static
+// the corresponding handler is called, otherwise the request is passed on to next.
+func (app *application) staticParam(name string, static map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := static[params.ByName(name)]; ok {
+			handler(w, r)
+			return
+		}
+
+		next(w, r)
+	}
 }
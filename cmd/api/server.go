@@ -27,6 +27,11 @@ func (app *application) serve() error {
 	// Create a channel to receive errors from the shutdown goroutine.
 	shutdownError := make(chan error)
 
+	// Create a context for the periodic background tasks, which is cancelled when the server
+	// starts shutting down so that they stop before the database is closed.
+	tasksCtx, stopTasks := context.WithCancel(context.Background())
+	defer stopTasks()
+
 	go func() {
 		// Create a channel to receive OS signals (buffered to 1 to avoid missing signals).
 		quit := make(chan os.Signal, 1)
@@ -40,6 +45,10 @@ func (app *application) serve() error {
 		// Log that the server is shutting down, including the received signal.
 		app.logger.Info("shutting down server", "signal", s.String())
 
+		// Stop the periodic background tasks from starting any more runs. A run which is in
+		// progress completes, and is waited for below along with the other background tasks.
+		stopTasks()
+
 		// Create a context with a 30-second timeout for the shutdown process.
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel() // Ensure resources are cleaned up.
@@ -61,6 +70,14 @@ func (app *application) serve() error {
 		shutdownError <- nil
 	}()
 
+	// Start the background goroutines which permanently remove expired movies from the trash
+	// and expired idempotency keys.
+	app.background(func() { app.purgeTrash(tasksCtx) })
+	app.background(func() { app.purgeIdempotencyKeys(tasksCtx) })
+
+	// Start the background goroutine which refreshes the movie statistics views.
+	app.background(func() { app.refreshStatsViews(tasksCtx) })
+
 	// Log that the server is starting, including the address and environment.
 	app.logger.Info("starting server", "addr", srv.Addr, "env", app.config.env)
 
@@ -83,3 +100,100 @@ func (app *application) serve() error {
 
 	return nil
 }
+
+// purgeTrash runs until the context is cancelled, permanently removing movies which have been in the trash for
+// longer than the configured retention period, along with their images. It does nothing
+// if the retention period is zero.
+func (app *application) purgeTrash(ctx context.Context) {
+	if app.config.trash.retention <= 0 || app.config.trash.purgeInterval <= 0 {
+		return
+	}
+
+	app.runPeriodically(ctx, app.config.trash.purgeInterval, func() error {
+		before := time.Now().Add(-app.config.trash.retention)
+
+		// Remove the movies' images first, as the images' rows (which hold the keys of their
+		// blobs) are deleted along with the movies.
+		keys, err := app.models.Movies.PurgeDeletedImages(before)
+		if err != nil {
+			return err
+		}
+		app.deleteBlobs(keys)
+
+		purged, err := app.models.Movies.PurgeDeleted(before)
+		if err != nil {
+			return err
+		}
+
+		if purged > 0 {
+			app.logger.Info("purged movies from trash", "count", purged)
+		}
+
+		return nil
+	})
+}
+
+// purgeIdempotencyKeys runs until the context is cancelled, removing idempotency keys once they have expired.
+// It does nothing if idempotency keys are disabled.
+func (app *application) purgeIdempotencyKeys(ctx context.Context) {
+	if app.config.idempotency.ttl <= 0 {
+		return
+	}
+
+	app.runPeriodically(ctx, time.Hour, func() error {
+		purged, err := app.models.IdempotencyKeys.DeleteExpired(time.Now())
+		if err != nil {
+			return err
+		}
+
+		if purged > 0 {
+			app.logger.Info("purged expired idempotency keys", "count", purged)
+		}
+
+		return nil
+	})
+}
+
+// refreshStatsViews runs until the context is cancelled, refreshing the materialized views which unfiltered
+// movie statistics are read from. It does nothing if the views aren't used.
+func (app *application) refreshStatsViews(ctx context.Context) {
+	if !app.config.stats.materialized || app.config.stats.refreshInterval <= 0 {
+		return
+	}
+
+	app.runPeriodically(ctx, app.config.stats.refreshInterval, app.models.Stats.RefreshViews)
+}
+
+// runPeriodically calls fn until the context is cancelled, waiting for the given interval
+// between calls. Errors returned by fn are logged, and panics are recovered, so that a
+// single failed run doesn't stop the later ones or crash the server. A run which has
+// started when the context is cancelled isn't interrupted, but no further run starts.
+func (app *application) runPeriodically(ctx context.Context, interval time.Duration, fn func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					app.logger.Error(fmt.Sprintf("%v", err))
+				}
+			}()
+
+			err := fn()
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		}()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
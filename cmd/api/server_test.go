@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunPeriodicallyStopsOnCancel(t *testing.T) {
+	app := newTestApplication(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs atomic.Int32
+
+	app.background(func() {
+		app.runPeriodically(ctx, time.Millisecond, func() error {
+			if runs.Add(1) == 3 {
+				cancel()
+			}
+			return errors.New("failed run")
+		})
+	})
+
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPeriodically didn't stop after its context was cancelled")
+	}
+
+	if got := runs.Load(); got != 3 {
+		t.Errorf("got %d runs; want 3", got)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+
+	"greenlight.tomcat.net/internal/data"
+	"greenlight.tomcat.net/internal/filter"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// movieStatsHandler handles GET requests for statistics about the published catalogue:
+// the number of movies and their average runtime, overall and, with the group_by
+// parameter, per genre, year, decade or month added (which also gives the catalogue's
+// growth over time as a running total). Filter expressions and the title and genres
+// parameters filter the movies in the same way as listMoviesHandler.
+//
+// When the server runs with -stats-materialized, unfiltered statistics are read from
+// materialized views refreshed in the background, and the response's as_of member gives
+// the time of the last refresh. Filtered statistics are always computed live.
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GroupBy string
+		Filter  filter.Filter
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.GroupBy = app.readString(qs, "group_by", "")
+	input.Filter = filter.Parse(qs, data.MovieFilterSchema, v)
+
+	if input.GroupBy != "" {
+		v.Apply("group_by", validator.Enum(input.GroupBy, data.StatsGroupSafelist...).WithMessage("stats_group_by"))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	fromViews := app.config.stats.materialized && input.Filter.Empty()
+
+	stats, err := app.models.Stats.GetMovieStats(input.GroupBy, input.Filter, fromViews)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
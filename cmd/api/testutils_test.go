@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"greenlight.tomcat.net/internal/data"
+)
+
+// newTestApplication returns an application without a database, mailer or blob store, for
+// testing the parts of the API which don't need them.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	return &application{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// newTestDB opens the migrated PostgreSQL database given by the GREENLIGHT_TEST_DB_DSN
+// environment variable, for tests of the handlers which need one. The test is skipped if
+// the variable isn't set.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// newTestUser creates an activated user with the given permissions and the password
+// "pa55word", and returns the user with an authentication token for them. The user is
+// deleted when the test ends.
+func newTestUser(t *testing.T, app *application, permissions ...string) (*data.User, string) {
+	t.Helper()
+
+	user := &data.User{
+		Name:      "Test User",
+		Email:     fmt.Sprintf("test-%d@example.com", time.Now().UnixNano()),
+		Activated: true,
+	}
+
+	if err := user.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.Users.Insert(user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.models.Users.DB.Exec("DELETE FROM users WHERE id = $1", user.ID) })
+
+	if err := app.models.Permissions.AddForUser(user.ID, permissions...); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user, token.Plaintext
+}
@@ -30,7 +30,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	data.ValidatePasswordPlaintext(v, input.Password)
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MovieTx groups several movie operations into a single database transaction, so that
+// either all of them take effect or none do. It has the same Get, Insert, Update and
+// Delete methods as MovieModel, each of which records its revision in the transaction.
+// Nothing is written until Commit is called; Rollback discards the transaction and is a
+// no-op after Commit, so it can safely be deferred.
+type MovieTx struct {
+	tx     *sql.Tx
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// BeginTx starts a transaction for a batch of movie operations. Batches may contain many
+// operations, so the whole transaction is given a longer timeout than a single query.
+func (m MovieModel) BeginTx() (*MovieTx, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &MovieTx{tx: tx, ctx: ctx, cancel: cancel}, nil
+}
+
+// Get retrieves a movie outside the trash by its ID, locking it until the end of the
+// transaction. It returns ErrRecordNotFound if there is no such movie.
+func (t *MovieTx) Get(id int64) (*Movie, error) {
+	return getMovie(t.ctx, t.tx, id, true)
+}
+
+// Insert adds a new movie as part of the transaction. See MovieModel.Insert.
+func (t *MovieTx) Insert(movie *Movie, userID int64) error {
+	return insertMovie(t.ctx, t.tx, movie, userID)
+}
+
+// Update modifies a movie as part of the transaction. See MovieModel.Update.
+func (t *MovieTx) Update(movie *Movie, userID int64) error {
+	return updateMovie(t.ctx, t.tx, movie, userID)
+}
+
+// Delete moves a movie to the trash as part of the transaction. See MovieModel.Delete.
+func (t *MovieTx) Delete(id int64, version int32, userID int64) error {
+	return deleteMovie(t.ctx, t.tx, id, version, userID)
+}
+
+// Commit writes all of the operations made in the transaction.
+func (t *MovieTx) Commit() error {
+	defer t.cancel()
+	return t.tx.Commit()
+}
+
+// Rollback discards all of the operations made in the transaction.
+func (t *MovieTx) Rollback() error {
+	defer t.cancel()
+	return t.tx.Rollback()
+}
@@ -0,0 +1,259 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ChangesSettleDelay is how old a change must be before GetChangesSince returns it. Movies
+// are stamped with the time their transaction started, and transactions which write movies
+// can run for up to 30 seconds, so a change may become visible some time after its
+// updated_at time. Leaving recent changes for the next sync means that a client never
+// moves its token past a change which hasn't been committed yet.
+const ChangesSettleDelay = 35 * time.Second
+
+// ErrInvalidSyncToken is returned by ParseSyncToken for a token which wasn't made by
+// SyncToken.String.
+var ErrInvalidSyncToken = errors.New("invalid sync token")
+
+// SyncToken marks a client's position in the stream of changes to the catalogue: the time
+// and movie ID of the last change it has seen. Changes are ordered by time and then ID, so
+// that paging through changes made in the same second is stable. The zero SyncToken is
+// the start of the stream.
+type SyncToken struct {
+	ChangedAt time.Time
+	ID        int64
+}
+
+// String encodes the token as an opaque string for clients to send back.
+func (t SyncToken) String() string {
+	s := strconv.FormatInt(t.ChangedAt.Unix(), 10) + "." + strconv.FormatInt(t.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// ParseSyncToken decodes a token made by SyncToken.String. An empty string is the zero
+// SyncToken, which asks for every movie.
+func ParseSyncToken(s string) (SyncToken, error) {
+	if s == "" {
+		return SyncToken{}, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+
+	seconds, id, found := strings.Cut(string(decoded), ".")
+	if !found {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || unix < 0 {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+
+	token := SyncToken{ChangedAt: time.Unix(unix, 0).UTC()}
+
+	token.ID, err = strconv.ParseInt(id, 10, 64)
+	if err != nil || token.ID < 0 {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+
+	return token, nil
+}
+
+// Tombstone records that a movie was removed from the catalogue, either by being moved to
+// the trash or by being merged into another movie, so that clients can delete their copy.
+type Tombstone struct {
+	ID        int64     `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// MovieChanges is a page of changes to the catalogue returned by GetChangesSince. Next is
+// the token to ask for the following changes with, and HasMore reports whether there are
+// already more changes waiting.
+type MovieChanges struct {
+	Movies     []*Movie
+	Tombstones []Tombstone
+	Next       SyncToken
+	HasMore    bool
+}
+
+// GetChangesSince returns up to limit changes to the published catalogue after the given
+// token, oldest first: the current version of each movie created or updated since then
+// (including changes to its external IDs, alternate titles, releases and images), and a
+// tombstone for each movie deleted since then. Movies which are purged from the trash keep
+// their tombstone in the movie_tombstones table. Only changes older than ChangesSettleDelay
+// are returned.
+func (m MovieModel) GetChangesSince(since SyncToken, limit int) (*MovieChanges, error) {
+	// The first query lists the changes in order and the second reads the changed movies, so
+	// both are made in a read-only snapshot to see the catalogue at the same moment.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if since.ChangedAt.IsZero() {
+		since.ChangedAt = time.Unix(0, 0)
+	}
+
+	query := `
+		SELECT id, changed_at, deleted
+		FROM (
+			SELECT id, updated_at AS changed_at, deleted_at IS NOT NULL AS deleted
+			FROM movies
+			WHERE status = 'published'
+			UNION ALL
+			SELECT movie_id, deleted_at, true
+			FROM movie_tombstones
+		) AS changes
+		WHERE (changed_at, id) > ($1, $2) AND changed_at <= NOW() - $3 * interval '1 second'
+		ORDER BY changed_at, id
+		LIMIT $4
+		`
+
+	// Fetch one more change than asked for, to find out whether there are more to come.
+	args := []any{since.ChangedAt, since.ID, int(ChangesSettleDelay.Seconds()), limit + 1}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type change struct {
+		id        int64
+		changedAt time.Time
+		deleted   bool
+	}
+
+	var changes []change
+	var changedIDs []int64
+
+	for rows.Next() {
+		var c change
+
+		err := rows.Scan(&c.id, &c.changedAt, &c.deleted)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, c)
+		if !c.deleted {
+			changedIDs = append(changedIDs, c.id)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &MovieChanges{Movies: []*Movie{}, Tombstones: []Tombstone{}, Next: since}
+
+	if len(changes) > limit {
+		changes = changes[:limit]
+		result.HasMore = true
+	}
+
+	movies, err := getMoviesByID(ctx, tx, changedIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range changes {
+		if c.deleted {
+			result.Tombstones = append(result.Tombstones, Tombstone{ID: c.id, DeletedAt: c.changedAt})
+		} else {
+			result.Movies = append(result.Movies, movies[c.id])
+		}
+
+		result.Next = SyncToken{ChangedAt: c.changedAt, ID: c.id}
+	}
+
+	return result, nil
+}
+
+// getMoviesByID reads the movies with the given IDs, along with their related data, using
+// the given transaction, and returns them by ID.
+func getMoviesByID(ctx context.Context, tx *sql.Tx, ids []int64) (map[int64]*Movie, error) {
+	movies := make(map[int64]*Movie, len(ids))
+
+	if len(ids) == 0 {
+		return movies, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, year, runtime, genres, version, status,
+			COALESCE(created_by, 0), COALESCE(updated_by, 0), updated_at, %s, %s, %s, %s
+		FROM movies
+		WHERE id = ANY($1)
+		`, movieExternalIDsColumn, movieAlternateTitlesColumn, movieReleasesColumn, movieImagesColumn)
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Status,
+			&movie.CreatedBy,
+			&movie.UpdatedBy,
+			&movie.UpdatedAt,
+			&movie.ExternalIDs,
+			&movie.AlternateTitles,
+			&movie.Releases,
+			&movie.Images,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies[movie.ID] = &movie
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// touchingMovie wraps a statement which inserts, updates or deletes rows related to a
+// movie, such as its alternate titles, so that it also sets the movie's updated_at time
+// and bumps its version. Clients syncing the catalogue then fetch the movie again, and
+// the movie's entity tag changes, so that cached copies aren't revalidated and requests
+// made with the old version in If-Match fail. The statement must not have a RETURNING
+// clause. The wrapped statement affects as many rows as the original one did, as long as
+// the original only changes the rows of a single movie.
+func touchingMovie(query string) string {
+	return `
+		WITH changed AS (` + query + `	RETURNING movie_id
+		)
+		UPDATE movies SET updated_at = NOW(), version = version + 1
+		WHERE id IN (SELECT movie_id FROM changed)
+		`
+}
@@ -0,0 +1,317 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// Define the weights given to each field when scoring how likely two movies are to be
+// duplicates. When either movie has no runtime, the runtime weight is left out and the
+// score is taken over the title and year alone.
+const (
+	duplicateTitleWeight   = 0.6
+	duplicateYearWeight    = 0.25
+	duplicateRuntimeWeight = 0.15
+)
+
+// maxDuplicateCandidates is the maximum number of movies scored by FindDuplicates.
+const maxDuplicateCandidates = 1000
+
+// duplicateTitleSlack is taken off the lowest title similarity a duplicate can have (see
+// minTitleSimilarity), since scores are rounded, and pg_trgm may split some titles into
+// slightly different trigrams than titleSimilarity does.
+const duplicateTitleSlack = 0.01
+
+// DuplicateScores holds the similarity of each field of a possible duplicate, from 0 (no
+// similarity) to 1 (identical). Runtime is omitted if either movie has no runtime.
+type DuplicateScores struct {
+	Title   float64  `json:"title"`
+	Year    float64  `json:"year"`
+	Runtime *float64 `json:"runtime,omitempty"`
+}
+
+// DuplicateCandidate is a movie which may be a duplicate of another, with its overall
+// similarity score from 0 to 1 and the scores of the individual fields.
+type DuplicateCandidate struct {
+	Movie  *Movie          `json:"movie"`
+	Score  float64         `json:"score"`
+	Scores DuplicateScores `json:"scores"`
+}
+
+// FindDuplicates returns the published movies outside the trash which look like duplicates
+// of the given movie, with a score of at least minScore, most similar first and at most limit of
+// them. Only movies released within a year of the given movie are considered. If the
+// movie has an ID, that movie is excluded from the results.
+//
+// Movies whose titles are too far from the movie's to reach minScore are left out by the
+// query, using pg_trgm's similarity function, and the rest are ordered by title similarity
+// and then by how many years apart they are, so that the best matches are the ones scored
+// when there are more than maxDuplicateCandidates of them.
+func (m MovieModel) FindDuplicates(movie *Movie, minScore float64, limit int) ([]*DuplicateCandidate, error) {
+	query := `
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movies
+		WHERE deleted_at IS NULL AND status = 'published' AND id <> $1 AND year BETWEEN $2 - 1 AND $2 + 1
+		AND similarity(title, $3) >= $4
+		ORDER BY title <-> $3, abs(year - $2), id
+		LIMIT $5
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{movie.ID, movie.Year, movie.Title, minTitleSimilarity(movie, minScore), maxDuplicateCandidates}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []*DuplicateCandidate{}
+
+	for rows.Next() {
+		var other Movie
+
+		err := rows.Scan(
+			&other.ID,
+			&other.CreatedAt,
+			&other.Title,
+			&other.Year,
+			&other.Runtime,
+			pq.Array(&other.Genres),
+			&other.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		candidate := scoreDuplicate(movie, &other)
+		if candidate.Score >= minScore {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Sort the most similar movies first, breaking ties by ID so the order is stable.
+	slices.SortFunc(candidates, func(a, b *DuplicateCandidate) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Movie.ID, b.Movie.ID)
+	})
+
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	return candidates, nil
+}
+
+// minTitleSimilarity returns the lowest title similarity another movie can have and still
+// score minScore as a duplicate of the given movie, which it would only do if its year
+// and runtime matched exactly (see scoreDuplicate), less duplicateTitleSlack.
+func minTitleSimilarity(movie *Movie, minScore float64) float64 {
+	rest := duplicateYearWeight
+	total := duplicateTitleWeight + duplicateYearWeight
+
+	if movie.Runtime > 0 {
+		rest += duplicateRuntimeWeight
+		total += duplicateRuntimeWeight
+	}
+
+	return max(0, (minScore*total-rest)/duplicateTitleWeight-duplicateTitleSlack)
+}
+
+// scoreDuplicate scores how similar the other movie is to the given movie.
+func scoreDuplicate(movie, other *Movie) *DuplicateCandidate {
+	scores := DuplicateScores{
+		Title: titleSimilarity(movie.Title, other.Title),
+	}
+
+	// Movies released in the same year score 1, a year apart 0.5 and otherwise 0.
+	scores.Year = math.Max(0, 1-math.Abs(float64(movie.Year-other.Year))/2)
+
+	score := duplicateTitleWeight*scores.Title + duplicateYearWeight*scores.Year
+	total := duplicateTitleWeight + duplicateYearWeight
+
+	// Runtimes score 1 when equal, falling to 0 when they are 10 minutes or more apart.
+	if movie.Runtime > 0 && other.Runtime > 0 {
+		runtime := math.Max(0, 1-math.Abs(float64(movie.Runtime-other.Runtime))/10)
+		scores.Runtime = &runtime
+
+		score += duplicateRuntimeWeight * runtime
+		total += duplicateRuntimeWeight
+	}
+
+	return &DuplicateCandidate{
+		Movie:  other,
+		Score:  math.Round(score/total*1000) / 1000,
+		Scores: scores,
+	}
+}
+
+// titleSimilarity returns the trigram similarity of two titles, in the same way as the
+// similarity function of PostgreSQL's pg_trgm extension: the titles are split into words
+// of letters and digits, each word is padded and split into three-character trigrams, and
+// the result is the number of trigrams the titles share divided by the number of distinct
+// trigrams in either of them. Case and punctuation are ignored.
+func titleSimilarity(a, b string) float64 {
+	x, y := trigrams(a), trigrams(b)
+
+	if len(x) == 0 && len(y) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range x {
+		if _, ok := y[t]; ok {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(x)+len(y)-shared)
+}
+
+// trigrams returns the set of trigrams in a title, as described for titleSimilarity.
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+// MergeDropped holds the external IDs, alternate titles and releases of a duplicate which
+// weren't moved to the kept movie when the movies were merged, because the kept movie
+// already had its own for the same source, locale or country. They stay with the
+// duplicate in the trash, and come back with it if it is restored.
+type MergeDropped struct {
+	ExternalIDs     ExternalIDs     `json:"external_ids,omitempty"`
+	AlternateTitles AlternateTitles `json:"alternate_titles,omitempty"`
+	Releases        Releases        `json:"releases,omitempty"`
+}
+
+// mergeRelatedRowsQueries move the rows which belong to one movie over to another when
+// the movies are merged. They expect the ID of the movie being kept as $1 and the ID of
+// the duplicate as $2. External IDs, alternate titles and releases are only moved for the
+// sources, locales and countries the kept movie doesn't already have; the others stay
+// with the duplicate. All images are moved.
+var mergeRelatedRowsQueries = []string{
+	`UPDATE movie_external_ids
+	SET movie_id = $1
+	WHERE movie_id = $2 AND source NOT IN (SELECT source FROM movie_external_ids WHERE movie_id = $1)`,
+	`UPDATE movie_titles
+	SET movie_id = $1
+	WHERE movie_id = $2 AND locale NOT IN (SELECT locale FROM movie_titles WHERE movie_id = $1)`,
+	`UPDATE movie_releases
+	SET movie_id = $1
+	WHERE movie_id = $2 AND country NOT IN (SELECT country FROM movie_releases WHERE movie_id = $1)`,
+	`UPDATE movie_images
+	SET movie_id = $1
+	WHERE movie_id = $2`,
+}
+
+// Merge combines a duplicate movie into the movie being kept, in a single transaction.
+// The rows related to the duplicate (such as its external IDs and alternate titles) are moved to the kept movie
+// and the duplicate is moved to the trash, recording a "delete" revision. The kept movie
+// keeps its own title, year, runtime and genres, but its version is bumped and a "merge"
+// revision is recorded, both attributed to the given user. It returns the kept movie along
+// with the rows which stayed with the duplicate, or ErrRecordNotFound if either movie
+// doesn't exist outside the trash.
+func (m MovieModel) Merge(keepID, duplicateID int64, userID int64) (*Movie, *MergeDropped, error) {
+	if keepID == duplicateID {
+		return nil, nil, errors.New("cannot merge a movie into itself")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock both movies, always in order of ID so that two merges of the same pair of
+	// movies can't deadlock.
+	for _, id := range []int64{min(keepID, duplicateID), max(keepID, duplicateID)} {
+		_, err = getMovie(ctx, tx, id, true)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, query := range mergeRelatedRowsQueries {
+		_, err = tx.ExecContext(ctx, query, keepID, duplicateID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Whatever the duplicate still has once the rows have been moved was dropped.
+	duplicate, err := getMovie(ctx, tx, duplicateID, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dropped := &MergeDropped{
+		ExternalIDs:     duplicate.ExternalIDs,
+		AlternateTitles: duplicate.AlternateTitles,
+		Releases:        duplicate.Releases,
+	}
+
+	err = deleteMovie(ctx, tx, duplicateID, 0, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	movie, err := getMovie(ctx, tx, keepID, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE movies
+		SET updated_by = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $1
+		RETURNING version, updated_at`, keepID, nullUserID(userID)).Scan(&movie.Version, &movie.UpdatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	movie.UpdatedBy = userID
+
+	err = insertRevision(ctx, tx, RevisionMerge, userID, movie, movie, movie, movie.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return movie, dropped, nil
+}
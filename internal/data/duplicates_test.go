@@ -0,0 +1,64 @@
+package data
+
+import "testing"
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Heat", "heat", 1},
+		{"Heat", "Heat!", 1},
+		{"cat", "cart", 2.0 / 7},
+		{"Heat", "Alien", 0},
+		{"", "", 0},
+	}
+
+	for _, tt := range tests {
+		if got := titleSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("titleSimilarity(%q, %q) = %v; want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestMinTitleSimilarity checks that FindDuplicates's pre-filter never leaves out a movie
+// which would score at least minScore, whatever its year and runtime.
+func TestMinTitleSimilarity(t *testing.T) {
+	titles := []string{
+		"The Godfather", "The Godfather Part II", "Godfather", "The Godfather: Part III",
+		"Casablanca", "Casa Blanca", "The Matrix", "Matrix", "The Matrix Reloaded",
+		"Heat", "Alien", "Aliens", "Alien³", "Blade Runner", "Blade Runner 2049",
+	}
+
+	for _, runtime := range []Runtime{0, 102} {
+		for _, minScore := range []float64{0, 0.3, 0.5, 0.6, 0.75, 0.9, 1} {
+			for _, title := range titles {
+				movie := &Movie{Title: title, Year: 1990, Runtime: runtime}
+				bound := minTitleSimilarity(movie, minScore)
+
+				for _, otherTitle := range titles {
+					for _, other := range []*Movie{
+						{Title: otherTitle, Year: 1990, Runtime: runtime},
+						{Title: otherTitle, Year: 1991, Runtime: runtime + 4},
+						{Title: otherTitle, Year: 1989},
+					} {
+						candidate := scoreDuplicate(movie, other)
+						if candidate.Score >= minScore && candidate.Scores.Title < bound {
+							t.Errorf("%+v scores %v against %+v, at least %v, but its title similarity %v is below %v",
+								other, candidate.Score, movie, minScore, candidate.Scores.Title, bound)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// The bound rises with minScore, so that higher scores leave out more movies.
+	movie := &Movie{Title: "Heat", Year: 1995, Runtime: 170}
+	if low, high := minTitleSimilarity(movie, 0.5), minTitleSimilarity(movie, 0.9); low >= high || low <= 0 {
+		t.Errorf("got bounds %v for 0.5 and %v for 0.9", low, high)
+	}
+	if got := minTitleSimilarity(movie, 0.2); got != 0 {
+		t.Errorf("got bound %v for 0.2; want 0", got)
+	}
+}
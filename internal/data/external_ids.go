@@ -0,0 +1,152 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// ErrDuplicateExternalID is returned when an external identifier is already used by
+// another movie. Each identifier may only belong to one movie per source.
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// ExternalIDSourceRX matches the names of external identifier sources, such as "imdb"
+// or "tmdb".
+var ExternalIDSourceRX = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// ExternalIDs maps the name of an external source (such as "imdb" or "tmdb") to the
+// movie's identifier in that source. It can be scanned from the JSON object selected by
+// movieExternalIDsColumn.
+type ExternalIDs map[string]string
+
+// Scan implements the sql.Scanner interface, decoding a JSON object of external IDs.
+func (e *ExternalIDs) Scan(src any) error {
+	return scanJSON(src, e)
+}
+
+// scanJSON decodes a JSON value read from the database into dst, for the Scan methods of
+// types which are selected as JSON. A NULL value leaves dst unchanged.
+func scanJSON(src any, dst any) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, dst)
+	case string:
+		return json.Unmarshal([]byte(src), dst)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", src, dst)
+	}
+}
+
+// checkRowsAffected returns ErrRecordNotFound if a statement didn't affect any rows.
+func checkRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// movieExternalIDsColumn selects the external IDs of each row of the movies table as a JSON
+// object, so that they can be read in the same query as the movie itself.
+const movieExternalIDsColumn = `(
+		SELECT COALESCE(jsonb_object_agg(source, external_id), '{}')
+		FROM movie_external_ids
+		WHERE movie_id = movies.id)`
+
+// ValidateExternalID checks the source name and the identifier of an external ID.
+func ValidateExternalID(v *validator.Validator, source, externalID string) {
+	v.Apply("source", validator.Pattern(source, ExternalIDSourceRX).WithMessage("external_id_source"))
+
+	v.Apply("id", validator.Required(externalID), validator.MaxLength(externalID, 200))
+}
+
+// SetExternalID sets the movie's identifier in the given source, replacing any identifier
+// it already had there. It returns ErrRecordNotFound if there is no such movie outside the
+// trash, and ErrDuplicateExternalID if the identifier belongs to another movie.
+func (m MovieModel) SetExternalID(movieID int64, source, externalID string) error {
+	query := touchingMovie(`
+		INSERT INTO movie_external_ids (movie_id, source, external_id)
+		SELECT id, $2, $3
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		ON CONFLICT (movie_id, source) DO UPDATE
+		SET external_id = EXCLUDED.external_id
+		`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, source, externalID)
+	if err != nil {
+		var pqErr *pq.Error
+
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23505":
+			return ErrDuplicateExternalID
+		default:
+			return err
+		}
+	}
+
+	return checkRowsAffected(result)
+}
+
+// DeleteExternalID removes the movie's identifier in the given source. It returns
+// ErrRecordNotFound if the movie has no identifier in that source.
+func (m MovieModel) DeleteExternalID(movieID int64, source string) error {
+	query := touchingMovie(`
+		DELETE FROM movie_external_ids
+		WHERE movie_id = $1 AND source = $2
+		`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, source)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+// GetByExternalID retrieves the movie with the given identifier in the given source. It
+// returns ErrRecordNotFound if there is no such movie outside the trash.
+func (m MovieModel) GetByExternalID(source, externalID string) (*Movie, error) {
+	query := `
+		SELECT movie_id
+		FROM movie_external_ids
+		WHERE source = $1 AND external_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+
+	err := m.DB.QueryRowContext(ctx, query, source, externalID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return getMovie(ctx, m.DB, id, false)
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"greenlight.tomcat.net/internal/filter"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// FacetSafelist holds the facet names that clients are allowed to request through the
+// "facets" query string parameter on the movie list endpoint.
+var FacetSafelist = []string{"genres", "decade", "runtime"}
+
+// FacetBucket holds a single facet value together with the number of movies that fall
+// into it, for example {"value": "drama", "count": 12}.
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets maps each requested facet name to its buckets. It is returned next to the
+// pagination metadata so that clients can render filter counts without extra requests.
+type Facets map[string][]FacetBucket
+
+// facetQueries maps every facet in FacetSafelist to the SQL used to aggregate it.
+// Each query contains a single %s verb where the shared movieFilterClause is inserted,
+// so the counts are always computed over exactly the same rows as GetAll returns.
+var facetQueries = map[string]string{
+	// genres counts every genre of every matching movie, most common first.
+	"genres": `
+		SELECT genre, count(*)
+		FROM movies CROSS JOIN LATERAL unnest(genres) AS genre
+		%s
+		GROUP BY genre
+		ORDER BY count(*) DESC, genre ASC
+		`,
+	// decade groups the matching movies by the decade of their release year (e.g. "1990s").
+	"decade": `
+		SELECT ((year / 10) * 10)::text || 's', count(*)
+		FROM movies
+		%s
+		GROUP BY (year / 10)
+		ORDER BY (year / 10) ASC
+		`,
+	// runtime groups the matching movies into fixed runtime ranges (in minutes).
+	"runtime": `
+		SELECT CASE
+			WHEN runtime < 90 THEN '0-89'
+			WHEN runtime < 120 THEN '90-119'
+			WHEN runtime < 150 THEN '120-149'
+			ELSE '150+'
+		END AS bucket, count(*)
+		FROM movies
+		%s
+		GROUP BY bucket
+		ORDER BY min(runtime) ASC
+		`,
+}
+
+// ValidateFacets checks that every requested facet is present in FacetSafelist and that
+// no facet has been requested more than once.
+func ValidateFacets(v *validator.Validator, facets []string) {
+	for _, facet := range facets {
+		v.Apply("facets", validator.Enum(facet, FacetSafelist...).WithMessage("facet_invalid"))
+	}
+	v.Apply("facets", validator.NoDuplicates(facets))
+}
+
+// GetFacets computes the counts for each of the requested facets over the movies matching
+// the filter, as GetAll does. The facets must have been validated with ValidateFacets;
+// an unknown facet name indicates a programming error and results in a panic.
+func (m MovieModel) GetFacets(f filter.Filter, facets []string) (Facets, error) {
+	// Create a context with a 3-second timeout which is shared by all of the facet
+	// queries, so that the whole operation can't take longer than a single list query.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := f.Where(1)
+
+	result := make(Facets, len(facets))
+
+	for _, facet := range facets {
+		tmpl, ok := facetQueries[facet]
+		if !ok {
+			panic("unsafe facet parameter: " + facet)
+		}
+
+		rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(tmpl, movieFilterClause(where)), where.Args...)
+		if err != nil {
+			return nil, err
+		}
+
+		// Always return an empty slice rather than nil, so that a facet with no matches
+		// is encoded as [] instead of null.
+		buckets := []FacetBucket{}
+
+		for rows.Next() {
+			var bucket FacetBucket
+
+			err := rows.Scan(&bucket.Value, &bucket.Count)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			buckets = append(buckets, bucket)
+		}
+
+		// Close the rows explicitly rather than with defer, because we are in a loop.
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		result[facet] = buckets
+	}
+
+	return result, nil
+}
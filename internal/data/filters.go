@@ -1,8 +1,11 @@
 package data
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 
+	"greenlight.tomcat.net/internal/filter"
 	"greenlight.tomcat.net/internal/validator"
 )
 
@@ -19,51 +22,164 @@ type Metadata struct {
 
 // Filters defines the parameters for paginating and sorting query results.
 // It is used to control which page of results to return, how many results per page,
-// and the field by which to sort the results.
+// and the keys by which to sort the results.
 type Filters struct {
 	Page         int      // The page number to retrieve (starts at 1).
 	PageSize     int      // The maximum number of items to return per page.
-	Sort         string   // The column or field to sort by (e.g., "id", "title", "-year").
-	SortSafelist []string // List of permitted sort values to prevent unsafe input.
+	Sort         string   // Comma-separated sort keys (e.g., "id", "-year,title", "-release_date:nulls_last").
+	SortSafelist []string // List of permitted sort keys to prevent unsafe input.
+	SortKeys     SortKeys // Computed and nullable sort keys registered by the model (may be nil).
 }
 
-// sortColumn returns the column name to use for sorting, after validating that the requested sort value
-// is present in the SortSafelist. If the sort value is not permitted, it panics to prevent unsafe SQL injection.
-func (f Filters) sortColumn() string {
-	// Iterate through the safelist of permitted sort values.
-	for _, safeValue := range f.SortSafelist {
-		// If the requested sort value matches a permitted value,
-		// return the column name with any leading '-' (for descending order) removed.
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+// SortKey describes a sort key which isn't simply a column of the table being queried, such
+// as a computed relevance score, or a column which can be NULL.
+type SortKey struct {
+	Expr     string // The SQL expression to sort by.
+	Nullable bool   // Whether the expression can be NULL, so that NULLS FIRST or LAST may be chosen.
+	// Search names a filter field whose full-text search the key ranks rows by, such as
+	// "title" for a relevance score. Expr then holds %[1]s verbs where the placeholder of
+	// the search term is inserted. Without a search of that field, every row ranks equally.
+	Search string
+}
+
+// SortKeys maps sort key names to their SortKey. Models export the SortKeys of their queries
+// for handlers to set in Filters, so that the SQL behind a sort key stays in the model.
+// Names which aren't in the map sort by the column of the same name, which can't be NULL.
+type SortKeys map[string]SortKey
+
+// maxSortKeys is the largest number of keys that can be given in a sort value.
+const maxSortKeys = 5
+
+// The suffixes which choose where NULL values are sorted for a nullable sort key. Without
+// one, NULLs sort as if larger than every other value: last in ascending order and first
+// in descending order.
+const (
+	sortNullsFirst = ":nulls_first"
+	sortNullsLast  = ":nulls_last"
+)
+
+// sortTerm is one key of a sort value, such as "-year" or "release_date:nulls_first".
+type sortTerm struct {
+	key   string // The key as checked against the safelist, including any leading '-'.
+	name  string // The key's name, without the leading '-'.
+	desc  bool   // Whether to sort in descending order.
+	nulls string // The NULLS FIRST/LAST suffix, if any.
+}
+
+// sortTerms splits the sort value into its keys.
+func (f Filters) sortTerms() []sortTerm {
+	var terms []sortTerm
+
+	for _, value := range strings.Split(f.Sort, ",") {
+		term := sortTerm{key: strings.TrimSpace(value)}
+
+		for _, suffix := range []string{sortNullsFirst, sortNullsLast} {
+			if key, found := strings.CutSuffix(term.key, suffix); found {
+				term.key, term.nulls = key, suffix
+			}
 		}
+
+		term.name, term.desc = strings.CutPrefix(term.key, "-")
+		terms = append(terms, term)
 	}
-	// Panic if the sort value is not in the safelist, indicating an unsafe or invalid sort parameter.
-	panic("unsafe sort parameter: " + f.Sort)
+
+	return terms
 }
 
-// sortDirection returns the SQL sort direction ("ASC" or "DESC") based on the Filters.Sort value.
-// If the sort value starts with a '-', it indicates descending order ("DESC").
-// Otherwise, it defaults to ascending order ("ASC").
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+// orderBy returns the ORDER BY list for the sort value, after checking that each of its keys
+// is present in the SortSafelist. The id column is added as a final ascending tiebreaker,
+// unless the sort value already includes it, so that pagination is stable. If a sort key
+// is not permitted, it panics to prevent unsafe SQL injection; ValidateSort should have
+// rejected it first. The where clause gives the search terms of SortKeys with a Search
+// field, and may be nil for queries which aren't filtered.
+func (f Filters) orderBy(where *filter.Clause) string {
+	var clauses []string
+	sortsByID := false
+
+	for _, term := range f.sortTerms() {
+		if !slices.Contains(f.SortSafelist, term.key) {
+			panic("unsafe sort parameter: " + f.Sort)
+		}
+
+		expr := term.name
+		if key, ok := f.SortKeys[term.name]; ok {
+			expr = key.Expr
+
+			// A bare 0 would be read as a position in the select list, so the
+			// constant is cast to make it an expression.
+			if key.Search != "" {
+				expr = "0::real"
+				if where != nil {
+					if placeholder, ok := where.Placeholder(key.Search, filter.Match); ok {
+						expr = fmt.Sprintf(key.Expr, placeholder)
+					}
+				}
+			}
+		}
+
+		clause := expr + " ASC"
+		if term.desc {
+			clause = expr + " DESC"
+		}
+
+		switch term.nulls {
+		case sortNullsFirst:
+			clause += " NULLS FIRST"
+		case sortNullsLast:
+			clause += " NULLS LAST"
+		}
+
+		clauses = append(clauses, clause)
+		sortsByID = sortsByID || term.name == "id"
+	}
+
+	if !sortsByID {
+		clauses = append(clauses, "id ASC")
 	}
-	return "ASC"
+
+	return strings.Join(clauses, ", ")
 }
 
 // ValidateFilters checks the Filters struct fields for valid values and records any validation errors.
 func ValidateFilters(v *validator.Validator, f Filters) {
-	// Check that the page number is greater than zero.
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	// Check that the page number does not exceed 10 million.
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
-	// Check that the page size is greater than zero.
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	// Check that the page size does not exceed 100.
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	// Check that the sort value is in the permitted safelist.
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	v.Apply("page",
+		// Check that the page number is greater than zero.
+		validator.Min(f.Page, 1).WithMessage("greater_than_zero"),
+		// Check that the page number does not exceed 10 million.
+		validator.Max(f.Page, 10_000_000).WithMessage("page_max"),
+	)
+	v.Apply("page_size",
+		// Check that the page size is greater than zero.
+		validator.Min(f.PageSize, 1).WithMessage("greater_than_zero"),
+		// Check that the page size does not exceed 100.
+		validator.Max(f.PageSize, 100).WithMessage("maximum"),
+	)
+	// Check the sort value.
+	ValidateSort(v, f)
+}
+
+// ValidateSort checks the sort value of the Filters: that every key is in the permitted
+// safelist, that no key is given twice, and that NULLS FIRST/LAST is only chosen for
+// nullable keys. It is called by ValidateFilters, and can be called on its own for
+// endpoints which aren't paginated.
+func ValidateSort(v *validator.Validator, f Filters) {
+	terms := f.sortTerms()
+
+	v.Apply("sort", validator.MaxItems(terms, maxSortKeys).WithMessage("sort_max_keys"))
+
+	names := make([]string, len(terms))
+
+	for i, term := range terms {
+		names[i] = term.name
+
+		// Check that the sort key is in the permitted safelist.
+		v.Apply("sort",
+			validator.Enum(term.key, f.SortSafelist...).WithMessage("sort_invalid"),
+			validator.Assert(term.nulls == "" || f.SortKeys[term.name].Nullable, "sort_nulls"),
+		)
+	}
+
+	v.Apply("sort", validator.NoDuplicates(names).WithMessage("sort_duplicate_keys"))
 }
 
 // limit returns the maximum number of items to retrieve per page for pagination.
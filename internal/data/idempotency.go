@@ -0,0 +1,167 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyKey records a request made with an Idempotency-Key header, so that a retry of
+// the same request can be answered with the original response instead of being processed
+// again. Keys are scoped to the user who made the request. Anonymous requests share user
+// ID 0, so their keys are stored prefixed with their fingerprint, and only an identical
+// request can find them. Fingerprint identifies the method, path and body of the original
+// request. Status is 0 while the original request is still being processed; once it has
+// finished, Status, Header and Body hold the response that was sent.
+type IdempotencyKey struct {
+	UserID      int64
+	Key         string
+	Fingerprint string
+	Status      int
+	Header      map[string][]string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// IdempotencyKeyModel wraps a sql.DB connection pool and provides methods for interacting
+// with the idempotency_keys table.
+type IdempotencyKeyModel struct {
+	DB *sql.DB
+}
+
+// Reserve claims an idempotency key for a new request, which expires after the given ttl.
+// It returns nil if the key was claimed, in which case the caller must process the request
+// and then either Complete or Release the key. If the key is already held by an earlier
+// request which hasn't expired, that request's record is returned instead. Claiming is a
+// single INSERT, so when duplicate requests arrive at the same time only one of them can
+// claim the key.
+func (m IdempotencyKeyModel) Reserve(userID int64, key, fingerprint string, ttl time.Duration) (*IdempotencyKey, error) {
+	// An expired record is taken over by the new request, as if it had been deleted.
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = 0, header = '{}', body = '',
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= $5
+		`
+
+	now := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, key, fingerprint, now.Add(ttl), now)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 1 {
+		return nil, nil
+	}
+
+	return m.get(ctx, userID, key)
+}
+
+// get retrieves the record of an idempotency key.
+func (m IdempotencyKeyModel) get(ctx context.Context, userID int64, key string) (*IdempotencyKey, error) {
+	query := `
+		SELECT user_id, key, fingerprint, status, header, body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+		`
+
+	var (
+		record IdempotencyKey
+		header []byte
+	)
+
+	err := m.DB.QueryRowContext(ctx, query, userID, key).Scan(
+		&record.UserID,
+		&record.Key,
+		&record.Fingerprint,
+		&record.Status,
+		&header,
+		&record.Body,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(header, &record.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Complete saves the response to the request which claimed an idempotency key, so that it
+// can be replayed to any retries until the key expires.
+func (m IdempotencyKeyModel) Complete(record *IdempotencyKey) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status = $1, header = $2, body = $3
+		WHERE user_id = $4 AND key = $5
+		`
+
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, record.Status, header, record.Body, record.UserID, record.Key)
+	return err
+}
+
+// Release deletes an idempotency key which is still being processed, so that the request
+// can be retried. It is used when the request failed without a response worth replaying.
+func (m IdempotencyKeyModel) Release(userID int64, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND status = 0
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, key)
+	return err
+}
+
+// DeleteExpired permanently removes the idempotency keys which expired before the given
+// time, and returns the number of keys removed.
+func (m IdempotencyKeyModel) DeleteExpired(before time.Time) (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at < $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
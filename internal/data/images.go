@@ -0,0 +1,301 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// The kinds of image a movie can have.
+const (
+	ImageKindPoster   = "poster"
+	ImageKindBackdrop = "backdrop"
+)
+
+// Limits on the dimensions of uploaded images. MaxImagePixels bounds the memory needed to
+// decode an image when making its thumbnails, whatever its shape.
+const (
+	MinImageDimension = 100
+	MaxImageDimension = 10000
+	MaxImagePixels    = 25_000_000
+)
+
+// MovieImage is a poster or backdrop image of a movie. The image itself is kept in a blob
+// store under Key, along with its resized thumbnails; clients download them from the
+// signed URLs which are filled in when a movie is sent in a response. Keys are never
+// included in JSON output.
+type MovieImage struct {
+	ID          int64            `json:"id"`
+	MovieID     int64            `json:"-"`
+	Kind        string           `json:"kind"`
+	ContentType string           `json:"content_type"`
+	Width       int              `json:"width"`
+	Height      int              `json:"height"`
+	Size        int64            `json:"size"`
+	Key         string           `json:"-"`
+	URL         string           `json:"url,omitempty"`
+	Thumbnails  []ImageThumbnail `json:"thumbnails"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// ImageThumbnail is a resized copy of a MovieImage, such as the "small" or "medium"
+// version of a poster.
+type ImageThumbnail struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Key         string `json:"-"`
+	URL         string `json:"url,omitempty"`
+}
+
+// Keys returns the blob keys of the image and all of its thumbnails.
+func (image *MovieImage) Keys() []string {
+	keys := []string{image.Key}
+	for _, thumbnail := range image.Thumbnails {
+		keys = append(keys, thumbnail.Key)
+	}
+
+	return keys
+}
+
+// storedThumbnail is the form in which thumbnails are kept in the thumbnails column of the
+// movie_images table. Unlike ImageThumbnail it includes the blob key in its JSON.
+type storedThumbnail struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Key         string `json:"key"`
+}
+
+// storedImage is the form in which images are selected by movieImagesColumn.
+type storedImage struct {
+	ID          int64             `json:"id"`
+	Kind        string            `json:"kind"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Size        int64             `json:"size"`
+	Key         string            `json:"key"`
+	Thumbnails  []storedThumbnail `json:"thumbnails"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// MovieImages holds the images of a movie, posters first and then in the order they were
+// uploaded. It can be scanned from the JSON array selected by movieImagesColumn.
+type MovieImages []MovieImage
+
+// Scan implements the sql.Scanner interface, decoding a JSON array of images.
+func (m *MovieImages) Scan(src any) error {
+	var stored []storedImage
+
+	err := scanJSON(src, &stored)
+	if err != nil {
+		return err
+	}
+
+	images := make(MovieImages, len(stored))
+
+	for i, s := range stored {
+		images[i] = MovieImage{
+			ID:          s.ID,
+			Kind:        s.Kind,
+			ContentType: s.ContentType,
+			Width:       s.Width,
+			Height:      s.Height,
+			Size:        s.Size,
+			Key:         s.Key,
+			Thumbnails:  make([]ImageThumbnail, len(s.Thumbnails)),
+			CreatedAt:   s.CreatedAt,
+		}
+
+		for j, t := range s.Thumbnails {
+			images[i].Thumbnails[j] = ImageThumbnail{Name: t.Name, ContentType: t.ContentType, Width: t.Width, Height: t.Height, Key: t.Key}
+		}
+	}
+
+	*m = images
+
+	return nil
+}
+
+// movieImagesColumn selects the images of each row of the movies table as JSON, so that
+// they can be read in the same query as the movie itself.
+const movieImagesColumn = `(
+		SELECT COALESCE(jsonb_agg(jsonb_build_object(
+			'id', id,
+			'kind', kind,
+			'content_type', content_type,
+			'width', width,
+			'height', height,
+			'size', size,
+			'key', key,
+			'thumbnails', thumbnails,
+			'created_at', created_at) ORDER BY kind = 'poster' DESC, id), '[]')
+		FROM movie_images
+		WHERE movie_id = movies.id)`
+
+// ValidateMovieImage checks the kind, format and dimensions of an uploaded image.
+func ValidateMovieImage(v *validator.Validator, image *MovieImage) {
+	v.Apply("kind", validator.Enum(image.Kind, ImageKindPoster, ImageKindBackdrop).WithMessage("image_kind"))
+
+	// Only the first failed check is reported, so an image in an unsupported format isn't
+	// also reported as being too small.
+	v.Apply("image",
+		validator.Assert(image.ContentType != "", "image_type"),
+		validator.Assert(image.Width >= MinImageDimension && image.Height >= MinImageDimension, "image_too_small").WithParams(map[string]any{"min": MinImageDimension}),
+		validator.Assert(image.Width <= MaxImageDimension && image.Height <= MaxImageDimension, "image_too_large").WithParams(map[string]any{"max": MaxImageDimension}),
+		validator.Assert(image.Width*image.Height <= MaxImagePixels, "image_too_many_pixels"),
+	)
+}
+
+// AddImage records an image of a movie whose blobs have already been stored, setting the
+// image's ID and creation time. It returns ErrRecordNotFound if there is no such movie
+// outside the trash.
+func (m MovieModel) AddImage(image *MovieImage) error {
+	thumbnails := make([]storedThumbnail, len(image.Thumbnails))
+	for i, t := range image.Thumbnails {
+		thumbnails[i] = storedThumbnail{Name: t.Name, ContentType: t.ContentType, Width: t.Width, Height: t.Height, Key: t.Key}
+	}
+
+	thumbnailsJSON, err := json.Marshal(thumbnails)
+	if err != nil {
+		return err
+	}
+
+	// The movie's updated_at time is set and its version bumped as well, so that clients
+	// syncing the catalogue fetch it again with its new image, and its entity tag changes.
+	query := `
+		WITH image AS (
+			INSERT INTO movie_images (movie_id, kind, content_type, width, height, size, key, thumbnails)
+			SELECT id, $2, $3, $4, $5, $6, $7, $8
+			FROM movies
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, created_at, movie_id
+		), touched AS (
+			UPDATE movies SET updated_at = NOW(), version = version + 1
+			WHERE id IN (SELECT movie_id FROM image)
+		)
+		SELECT id, created_at FROM image
+		`
+
+	args := []any{image.MovieID, image.Kind, image.ContentType, image.Width, image.Height, image.Size, image.Key, thumbnailsJSON}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteImage removes an image of a movie, and returns the blob keys of the image and its
+// thumbnails so that the caller can delete them from the blob store. It returns
+// ErrRecordNotFound if the movie has no such image.
+func (m MovieModel) DeleteImage(movieID, imageID int64) ([]string, error) {
+	query := `
+		WITH image AS (
+			DELETE FROM movie_images
+			WHERE id = $1 AND movie_id = $2
+			RETURNING key, thumbnails, movie_id
+		), touched AS (
+			UPDATE movies SET updated_at = NOW(), version = version + 1
+			WHERE id IN (SELECT movie_id FROM image)
+		)
+		SELECT key, thumbnails FROM image
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, imageID, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := scanImageKeys(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return keys, nil
+}
+
+// PurgeDeletedImages removes the images of every movie which was moved to the trash before
+// the given time, and returns their blob keys. It is called before PurgeDeleted, which
+// would otherwise remove the images along with the movies and leave their blobs behind.
+func (m MovieModel) PurgeDeletedImages(before time.Time) ([]string, error) {
+	query := `
+		DELETE FROM movie_images
+		WHERE movie_id IN (
+			SELECT id FROM movies
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1)
+		RETURNING key, thumbnails
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanImageKeys(rows)
+}
+
+// scanImageKeys reads the blob keys of images and their thumbnails from rows holding the
+// key and thumbnails columns of the movie_images table, and closes the rows.
+func scanImageKeys(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var key string
+		var thumbnails []storedThumbnail
+
+		err := rows.Scan(&key, jsonScanner{&thumbnails})
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+		for _, t := range thumbnails {
+			keys = append(keys, t.Key)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// jsonScanner implements the sql.Scanner interface for any value which is selected as JSON.
+type jsonScanner struct {
+	dst any
+}
+
+// Scan implements the sql.Scanner interface.
+func (j jsonScanner) Scan(src any) error {
+	return scanJSON(src, j.dst)
+}
@@ -0,0 +1,352 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// Define constants for the import modes. In insert mode every row creates a new movie. In
+// upsert mode a row whose external key matches an existing movie updates that movie.
+const (
+	ImportModeInsert = "insert"
+	ImportModeUpsert = "upsert"
+)
+
+// ImportExternalIDSource is the external ID source which the external keys of imported
+// movies are kept under, alongside the movie's other external IDs. A movie imported with
+// the external key "abc" can therefore be found at /v1/external-ids/import/abc, and its
+// key can be changed like any other external ID.
+const ImportExternalIDSource = "import"
+
+// Define constants for the states of an import job.
+const (
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+)
+
+// MaxImportRowErrors is the maximum number of row errors kept in an ImportReport. Further
+// errors are still counted, but the report is marked as truncated.
+const MaxImportRowErrors = 1000
+
+// ImportRow holds a single parsed row of an import file. Errors collects any problems found
+// while parsing, validating or writing the row, with the same codes as the validation errors
+// of the JSON endpoints; rows with errors are reported and skipped.
+type ImportRow struct {
+	Row         int
+	ExternalKey string
+	Movie       *Movie
+	Errors      *validator.Validator
+}
+
+// NewImportRow returns an empty import row with the given number.
+func NewImportRow(row int) *ImportRow {
+	return &ImportRow{Row: row, Movie: &Movie{}, Errors: validator.New()}
+}
+
+// ImportRowError describes why a row of an import file was rejected. Rows are numbered
+// from 1, not counting the CSV header. Errors lists every problem with the row, in the same
+// shape as the errors of a validation failure response.
+type ImportRowError struct {
+	Row         int                    `json:"row"`
+	ExternalKey string                 `json:"external_key,omitempty"`
+	Errors      []validator.FieldError `json:"errors"`
+}
+
+// ImportReport summarises the outcome of an import.
+type ImportReport struct {
+	DryRun          bool             `json:"dry_run"`
+	TotalRows       int              `json:"total_rows"`
+	Created         int              `json:"created"`
+	Updated         int              `json:"updated"`
+	Failed          int              `json:"failed"`
+	Errors          []ImportRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
+
+// AddError records a rejected row in the report, with its error messages in the given
+// locale, keeping at most MaxImportRowErrors.
+func (r *ImportReport) AddError(row *ImportRow, locale string) {
+	r.Failed++
+
+	if len(r.Errors) >= MaxImportRowErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+
+	r.Errors = append(r.Errors, ImportRowError{Row: row.Row, ExternalKey: row.ExternalKey, Errors: row.Errors.Localized(locale)})
+}
+
+// ImportJob represents an import which runs in the background. Its report is updated as
+// the import progresses, so clients can poll it for status.
+type ImportJob struct {
+	ID        int64        `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	UserID    int64        `json:"-"`
+	Format    string       `json:"format"`
+	Mode      string       `json:"mode"`
+	DryRun    bool         `json:"dry_run"`
+	Status    string       `json:"status"`
+	Report    ImportReport `json:"report"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// ImportJobModel wraps a sql.DB connection pool and provides methods for interacting
+// with the import_jobs table.
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+// ValidateImportRow checks the movie of an import row with ValidateMovie, along with its
+// optional external key.
+func ValidateImportRow(v *validator.Validator, row *ImportRow) {
+	ValidateMovie(v, row.Movie)
+	v.Apply("external_key", validator.MaxLength(row.ExternalKey, 200))
+}
+
+// Import writes a batch of valid import rows to the database in a single transaction and
+// records a revision for each movie created or updated, attributed to the given user.
+// Rows which can't be written (for example because their external key is already used)
+// are rolled back individually using a savepoint, and have an error added; they are
+// returned in the failed slice. Any other database error aborts the whole batch.
+func (m MovieModel) Import(rows []*ImportRow, mode string, userID int64) (created, updated int, failed []*ImportRow, err error) {
+	// Imports write many rows at once, so the batch is given a longer timeout than the
+	// queries made for a single movie.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		_, err = tx.ExecContext(ctx, "SAVEPOINT import_row")
+		if err != nil {
+			return 0, 0, nil, err
+		}
+
+		inserted, rowErr := importRow(ctx, tx, row, mode, userID)
+		if rowErr != nil {
+			var pqErr *pq.Error
+
+			switch {
+			case errors.As(rowErr, &pqErr) && pqErr.Code == "23505":
+				row.Errors.AddErrorCode("external_key", "import_external_key_taken", nil)
+			case errors.Is(rowErr, ErrEditConflict):
+				row.Errors.AddErrorCode("external_key", "import_external_key_trashed", nil)
+			default:
+				return 0, 0, nil, rowErr
+			}
+
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_row")
+			if err != nil {
+				return 0, 0, nil, err
+			}
+
+			failed = append(failed, row)
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT import_row")
+		if err != nil {
+			return 0, 0, nil, err
+		}
+
+		if inserted {
+			created++
+		} else {
+			updated++
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	return created, updated, failed, nil
+}
+
+// importRow writes a single import row as part of the given transaction, returning true if
+// a new movie was inserted or false if an existing one was updated. It returns
+// ErrEditConflict if, in upsert mode, the external key belongs to a movie in the trash.
+func importRow(ctx context.Context, tx *sql.Tx, row *ImportRow, mode string, userID int64) (bool, error) {
+	movie := row.Movie
+
+	// Rows without an external key never conflict with another row.
+	key := sql.NullString{String: row.ExternalKey, Valid: row.ExternalKey != ""}
+
+	if mode == ImportModeUpsert && key.Valid {
+		// Lock the existing movie with this external key, if there is one.
+		before := Movie{}
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT movies.id, title, year, runtime, genres, version, deleted_at
+			FROM movies
+			INNER JOIN movie_external_ids ON movie_external_ids.movie_id = movies.id
+			WHERE movie_external_ids.source = $1 AND movie_external_ids.external_id = $2
+			FOR UPDATE OF movies`, ImportExternalIDSource, key).Scan(
+			&before.ID,
+			&before.Title,
+			&before.Year,
+			&before.Runtime,
+			pq.Array(&before.Genres),
+			&before.Version,
+			&before.DeletedAt,
+		)
+
+		switch {
+		case err == nil && before.DeletedAt != nil:
+			return false, ErrEditConflict
+
+		case err == nil:
+			movie.ID = before.ID
+
+			err = tx.QueryRowContext(ctx, `
+				UPDATE movies
+				SET title = $1, year = $2, runtime = $3, genres = $4, updated_by = $6, updated_at = NOW(), version = version + 1
+				WHERE id = $5
+				RETURNING created_at, updated_at, version`,
+				movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, nullUserID(userID),
+			).Scan(&movie.CreatedAt, &movie.UpdatedAt, &movie.Version)
+			if err != nil {
+				return false, err
+			}
+
+			return false, insertRevision(ctx, tx, RevisionUpdate, userID, movie, &before, movie, movie.Version)
+
+		case !errors.Is(err, sql.ErrNoRows):
+			return false, err
+		}
+	}
+
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO movies (title, year, runtime, genres, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING id, created_at, updated_at, version`,
+		movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), nullUserID(userID),
+	).Scan(&movie.ID, &movie.CreatedAt, &movie.UpdatedAt, &movie.Version)
+	if err != nil {
+		return false, err
+	}
+
+	// Keep the external key with the movie's other external IDs. A key which already
+	// belongs to another movie violates the table's unique constraint.
+	if key.Valid {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO movie_external_ids (movie_id, source, external_id)
+			VALUES ($1, $2, $3)`,
+			movie.ID, ImportExternalIDSource, key.String)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, insertRevision(ctx, tx, RevisionInsert, userID, movie, nil, movie, movie.Version)
+}
+
+// Insert adds a new import job to the database, setting its ID and timestamps.
+func (m ImportJobModel) Insert(job *ImportJob) error {
+	query := `
+		INSERT INTO import_jobs (user_id, format, mode, dry_run, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+		`
+
+	args := []any{job.UserID, job.Format, job.Mode, job.DryRun, job.Status}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// Update saves the status, report and error of an import job.
+func (m ImportJobModel) Update(job *ImportJob) error {
+	query := `
+		UPDATE import_jobs
+		SET status = $1, report = $2, error = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING updated_at
+		`
+
+	report, err := json.Marshal(job.Report)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, job.Status, report, job.Error, job.ID).Scan(&job.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetForUser retrieves an import job by its ID, but only if it was started by the given
+// user. Otherwise ErrRecordNotFound is returned.
+func (m ImportJobModel) GetForUser(id, userID int64) (*ImportJob, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, updated_at, user_id, format, mode, dry_run, status, report, error
+		FROM import_jobs
+		WHERE id = $1 AND user_id = $2
+		`
+
+	var (
+		job    ImportJob
+		report []byte
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.UserID,
+		&job.Format,
+		&job.Mode,
+		&job.DryRun,
+		&job.Status,
+		&report,
+		&job.Error,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(report, &job.Report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
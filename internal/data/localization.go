@@ -0,0 +1,233 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// AlternateTitles maps a locale to the title a movie is known by there. Locales are a
+// language ("fr"), a language and region ("pt-BR") or a region on its own ("CA"), in the
+// canonical form returned by CanonicalLocale. It can be scanned from the JSON object
+// selected by movieAlternateTitlesColumn.
+type AlternateTitles map[string]string
+
+// Scan implements the sql.Scanner interface, decoding a JSON object of alternate titles.
+func (t *AlternateTitles) Scan(src any) error {
+	return scanJSON(src, t)
+}
+
+// Release describes when a movie was released in a country, and the certification (age
+// rating) it was given there. Country is an ISO 3166-1 alpha-2 code and Date has the form
+// YYYY-MM-DD.
+type Release struct {
+	Country       string `json:"country"`
+	Date          string `json:"date"`
+	Certification string `json:"certification,omitempty"`
+}
+
+// Releases holds the per-country releases of a movie, ordered by country. It can be scanned
+// from the JSON array selected by movieReleasesColumn.
+type Releases []Release
+
+// Scan implements the sql.Scanner interface, decoding a JSON array of releases.
+func (r *Releases) Scan(src any) error {
+	return scanJSON(src, r)
+}
+
+// movieAlternateTitlesColumn and movieReleasesColumn select the alternate titles and the
+// releases of each row of the movies table as JSON, so that they can be read in the same
+// query as the movie itself.
+const (
+	movieAlternateTitlesColumn = `(
+		SELECT COALESCE(jsonb_object_agg(locale, title), '{}')
+		FROM movie_titles
+		WHERE movie_id = movies.id)`
+	movieReleasesColumn = `(
+		SELECT COALESCE(jsonb_agg(jsonb_build_object(
+			'country', country,
+			'date', to_char(release_date, 'YYYY-MM-DD'),
+			'certification', certification) ORDER BY country), '[]')
+		FROM movie_releases
+		WHERE movie_id = movies.id)`
+)
+
+// CanonicalLocale returns the canonical form of a locale: a lowercase language of two or
+// three letters, optionally followed by an uppercase two-letter region ("en", "en-US"), or
+// an uppercase region on its own ("US"). Underscores are accepted in place of hyphens, and
+// script subtags (as in "zh-Hant-TW") are dropped. It reports false if s isn't a locale.
+func CanonicalLocale(s string) (string, bool) {
+	parts := strings.Split(strings.ReplaceAll(s, "_", "-"), "-")
+
+	isLetters := func(s string, min, max int) bool {
+		if len(s) < min || len(s) > max {
+			return false
+		}
+		for _, r := range s {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+				return false
+			}
+		}
+		return true
+	}
+
+	// A region on its own is written in uppercase, to tell "CA" (Canada) from "ca" (Catalan).
+	if len(parts) == 1 && isLetters(parts[0], 2, 2) && parts[0] == strings.ToUpper(parts[0]) {
+		return parts[0], true
+	}
+
+	if !isLetters(parts[0], 2, 3) {
+		return "", false
+	}
+
+	language := strings.ToLower(parts[0])
+
+	switch len(parts) {
+	case 1:
+		return language, true
+	case 2, 3:
+		// Skip over a four-letter script subtag, if there is one.
+		if len(parts) == 3 {
+			if !isLetters(parts[1], 4, 4) {
+				return "", false
+			}
+			parts = parts[1:]
+		}
+		if !isLetters(parts[1], 2, 2) {
+			return "", false
+		}
+		return language + "-" + strings.ToUpper(parts[1]), true
+	default:
+		return "", false
+	}
+}
+
+// ValidateAlternateTitle checks the title given for a locale, which must already be in its
+// canonical form.
+func ValidateAlternateTitle(v *validator.Validator, title string) {
+	v.Apply("title", validator.Required(title), validator.MaxLength(title, 500))
+}
+
+// ValidateRelease checks the country, date and certification of a release.
+func ValidateRelease(v *validator.Validator, release *Release) {
+	v.Apply("country", validator.Assert(len(release.Country) == 2 && release.Country == strings.ToUpper(release.Country), "country_code"))
+
+	date, err := time.Parse(time.DateOnly, release.Date)
+	v.Apply("date",
+		validator.Required(release.Date),
+		validator.Assert(err == nil, "date_format"),
+		validator.Assert(err != nil || date.Year() >= 1888, "date_min").WithParams(map[string]any{"min": 1888}),
+	)
+
+	v.Apply("certification", validator.MaxLength(release.Certification, 20))
+}
+
+// SetAlternateTitle sets the movie's title in the given locale, replacing any title it
+// already had there. It returns ErrRecordNotFound if there is no such movie outside the
+// trash.
+func (m MovieModel) SetAlternateTitle(movieID int64, locale, title string) error {
+	query := touchingMovie(`
+		INSERT INTO movie_titles (movie_id, locale, title)
+		SELECT id, $2, $3
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		ON CONFLICT (movie_id, locale) DO UPDATE
+		SET title = EXCLUDED.title
+		`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, locale, title)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+// DeleteAlternateTitle removes the movie's title in the given locale. It returns
+// ErrRecordNotFound if the movie has no title in that locale.
+func (m MovieModel) DeleteAlternateTitle(movieID int64, locale string) error {
+	query := touchingMovie(`
+		DELETE FROM movie_titles
+		WHERE movie_id = $1 AND locale = $2
+		`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, locale)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+// SetRelease sets the movie's release in a country, replacing any release it already had
+// there. It returns ErrRecordNotFound if there is no such movie outside the trash.
+func (m MovieModel) SetRelease(movieID int64, release *Release) error {
+	query := touchingMovie(`
+		INSERT INTO movie_releases (movie_id, country, release_date, certification)
+		SELECT id, $2, $3, $4
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		ON CONFLICT (movie_id, country) DO UPDATE
+		SET release_date = EXCLUDED.release_date, certification = EXCLUDED.certification
+		`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, release.Country, release.Date, release.Certification)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+// DeleteRelease removes the movie's release in a country. It returns ErrRecordNotFound if
+// the movie has no release there.
+func (m MovieModel) DeleteRelease(movieID int64, country string) error {
+	query := touchingMovie(`
+		DELETE FROM movie_releases
+		WHERE movie_id = $1 AND country = $2
+		`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, country)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Localize sets the movie's DisplayTitle to its title in the first of the given locales it
+// has one for, falling back to its original Title. The locales are in order of preference,
+// and in canonical form. For each locale an exact match is tried first, then its language
+// on its own, then its region on its own, so "fr-CA" matches "fr-CA", "fr" or "CA".
+func (movie *Movie) Localize(locales []string) {
+	movie.DisplayTitle = movie.Title
+
+	for _, locale := range locales {
+		candidates := []string{locale}
+
+		if language, region, ok := strings.Cut(locale, "-"); ok {
+			candidates = append(candidates, language, region)
+		}
+
+		for _, candidate := range candidates {
+			if title, ok := movie.AlternateTitles[candidate]; ok {
+				movie.DisplayTitle = title
+				return
+			}
+		}
+	}
+}
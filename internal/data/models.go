@@ -20,12 +20,20 @@ var (
 type Models struct {
 	// Movies provides methods for interacting with the 'movies' table.
 	Movies MovieModel
+	// MovieRevisions provides methods for reading the 'movie_revisions' table.
+	MovieRevisions MovieRevisionModel
 	// Users provides methods for interacting with the 'users' table.
 	Users UserModel
 	// Tokens provides methods for interacting with the 'tokens' table.
 	Tokens TokenModel
 	// Permissions provides methods for interacting with the 'permissions' and 'users_permissions' tables.
 	Permissions PermissionModel
+	// ImportJobs provides methods for interacting with the 'import_jobs' table.
+	ImportJobs ImportJobModel
+	// IdempotencyKeys provides methods for interacting with the 'idempotency_keys' table.
+	IdempotencyKeys IdempotencyKeyModel
+	// Stats provides methods for computing statistics about the catalogue.
+	Stats StatsModel
 }
 
 // NewModels initializes and returns a Models struct containing all database models.
@@ -35,9 +43,13 @@ type Models struct {
 //   - Models: A struct containing initialized MovieModel and UserModel instances
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},      // Initialize movie model with database connection
-		Users:       UserModel{DB: db},       // Initialize user model with database connection
-		Tokens:      TokenModel{DB: db},      // Initialize tokens model with database connection
-		Permissions: PermissionModel{DB: db}, // Initialize permissions model with database connection
+		Movies:          MovieModel{DB: db},          // Initialize movie model with database connection
+		MovieRevisions:  MovieRevisionModel{DB: db},  // Initialize movie revisions model with database connection
+		Users:           UserModel{DB: db},           // Initialize user model with database connection
+		Tokens:          TokenModel{DB: db},          // Initialize tokens model with database connection
+		Permissions:     PermissionModel{DB: db},     // Initialize permissions model with database connection
+		ImportJobs:      ImportJobModel{DB: db},      // Initialize import jobs model with database connection
+		IdempotencyKeys: IdempotencyKeyModel{DB: db}, // Initialize idempotency keys model with database connection
+		Stats:           StatsModel{DB: db},          // Initialize stats model with database connection
 	}
 }
@@ -0,0 +1,195 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// Define constants for the moderation statuses of a movie. Only published movies are part
+// of the public catalogue. Community submissions start out as drafts or go straight to
+// pending, and a moderator then publishes or rejects them. A rejected movie can be edited
+// and submitted again.
+const (
+	MovieStatusDraft     = "draft"
+	MovieStatusPending   = "pending"
+	MovieStatusPublished = "published"
+	MovieStatusRejected  = "rejected"
+)
+
+// MovieStatuses lists every moderation status, in the order a movie moves through them.
+var MovieStatuses = []string{MovieStatusDraft, MovieStatusPending, MovieStatusPublished, MovieStatusRejected}
+
+// ErrInvalidStatusTransition is returned when a movie can't be moved to a moderation status
+// from the status it is in, such as approving a movie which isn't pending.
+var ErrInvalidStatusTransition = errors.New("invalid movie status transition")
+
+// ValidateStatusReason checks the reason given by a moderator for approving or rejecting a
+// movie. A reason is required for rejections, so that the submitter knows what to fix.
+func ValidateStatusReason(v *validator.Validator, reason string, required bool) {
+	v.Apply("reason", validator.Assert(!required || reason != "", "required"), validator.MaxLength(reason, 1000))
+}
+
+// Submit sends a draft or rejected movie to the moderators, moving it to pending.
+func (m MovieModel) Submit(id int64, userID int64) (*Movie, error) {
+	return m.changeStatus(id, []string{MovieStatusDraft, MovieStatusRejected}, MovieStatusPending, "", RevisionSubmit, userID)
+}
+
+// Approve publishes a pending movie, recording the moderator's (optional) reason.
+func (m MovieModel) Approve(id int64, reason string, userID int64) (*Movie, error) {
+	return m.changeStatus(id, []string{MovieStatusPending}, MovieStatusPublished, reason, RevisionApprove, userID)
+}
+
+// Reject turns down a pending movie, recording the moderator's reason.
+func (m MovieModel) Reject(id int64, reason string, userID int64) (*Movie, error) {
+	return m.changeStatus(id, []string{MovieStatusPending}, MovieStatusRejected, reason, RevisionReject, userID)
+}
+
+// changeStatus moves a movie from one of the given statuses to another, in a transaction
+// which locks the movie, bumps its version number and records a revision for the operation
+// attributed to the given user. It returns ErrRecordNotFound if there is no such movie
+// outside the trash, and ErrInvalidStatusTransition if the movie is in any other status.
+func (m MovieModel) changeStatus(id int64, from []string, to, reason, operation string, userID int64) (*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	movie, err := getMovie(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(from, movie.Status) {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	query := `
+		UPDATE movies
+		SET status = $1, status_reason = $2, updated_by = $4, updated_at = NOW(), version = version + 1
+		WHERE id = $3
+		RETURNING version, updated_at
+		`
+
+	err = tx.QueryRowContext(ctx, query, to, reason, id, nullUserID(userID)).Scan(&movie.Version, &movie.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	movie.Status = to
+	movie.StatusReason = reason
+	movie.UpdatedBy = userID
+
+	err = insertRevision(ctx, tx, operation, userID, movie, movie, movie, movie.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+// GetModerationState retrieves the ID, moderation status and submitter of a movie, which
+// are all that is needed to decide who may see it. Unlike Get, movies in the trash are
+// included, for the endpoints (such as the revision history) which outlive the movie
+// itself. It returns ErrRecordNotFound if the movie has been purged or never existed.
+func (m MovieModel) GetModerationState(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, status, COALESCE(submitted_by, 0)
+		FROM movies
+		WHERE id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movie Movie
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movie.ID, &movie.Status, &movie.SubmittedBy)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// GetAllSubmissions returns a page of the movies outside the trash which are in the given
+// moderation status. If submittedBy is non-zero, only the movies submitted by that user
+// are returned.
+func (m MovieModel) GetAllSubmissions(status string, submittedBy int64, filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version,
+			status, status_reason, COALESCE(submitted_by, 0), updated_at
+		FROM movies
+		WHERE deleted_at IS NULL AND status = $1 AND (submitted_by = $2 OR $2 = 0)
+		ORDER BY %s
+		LIMIT $3 OFFSET $4
+		`, filters.orderBy(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, submittedBy, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Status,
+			&movie.StatusReason,
+			&movie.SubmittedBy,
+			&movie.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
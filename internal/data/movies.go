@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"greenlight.tomcat.net/internal/filter"
 	"greenlight.tomcat.net/internal/validator"
 )
 
@@ -16,15 +17,43 @@ import (
 // The struct tags control how the data appears when serialized to JSON:
 // - CreatedAt is excluded from JSON output
 // - Year, Runtime, and Genres are omitted from JSON if empty
+// - DeletedAt is only set (and included in JSON) for movies which are in the trash
+// - ExternalIDs holds the movie's identifiers in other catalogues, such as IMDb, and is omitted if empty
+// - AlternateTitles and Releases hold the movie's localized titles and per-country releases, and are omitted if empty
+// - Images holds the movie's posters and backdrops, and is omitted if empty
+// - Status is the movie's place in the moderation workflow; StatusReason and SubmittedBy are only set for moderated movies
+// - CreatedBy and UpdatedBy are the IDs of the users who created and last changed the movie, and are omitted if unknown
+// - UpdatedAt is the time of the last change to the movie, and is omitted where it wasn't read
+// - Creator is the user who created the movie, and is only set when a MovieProjection includes it
+// - DisplayTitle is only set (by Localize) when the client asked for a particular language
 // - All other fields are included in JSON output by default
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID              int64           `json:"id"`
+	CreatedAt       time.Time       `json:"-"`
+	Title           string          `json:"title"`
+	Year            int32           `json:"year,omitempty"`
+	Runtime         Runtime         `json:"runtime,omitempty"`
+	Genres          []string        `json:"genres,omitempty"`
+	Version         int32           `json:"version"`
+	DeletedAt       *time.Time      `json:"deleted_at,omitempty"`
+	ExternalIDs     ExternalIDs     `json:"external_ids,omitempty"`
+	DisplayTitle    string          `json:"display_title,omitempty"`
+	AlternateTitles AlternateTitles `json:"alternate_titles,omitempty"`
+	Releases        Releases        `json:"releases,omitempty"`
+	Images          MovieImages     `json:"images,omitempty"`
+	Status          string          `json:"status,omitempty"`
+	StatusReason    string          `json:"status_reason,omitempty"`
+	SubmittedBy     int64           `json:"submitted_by,omitempty"`
+	CreatedBy       int64           `json:"created_by,omitempty"`
+	UpdatedBy       int64           `json:"updated_by,omitempty"`
+	UpdatedAt       time.Time       `json:"updated_at,omitzero"`
+	Creator         *MovieCreator   `json:"creator,omitempty"`
+}
+
+// nullUserID converts a user ID to a value for a nullable user column, where an ID of 0
+// (an unknown user) is stored as NULL.
+func nullUserID(userID int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: userID, Valid: userID > 0}
 }
 
 // MovieModel wraps a sql.DB connection pool and provides methods for interacting
@@ -38,52 +67,107 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
+// ValidateMovie checks the fields of a movie, reporting every rule each field fails. Errors
+// about a single genre are reported under its index, such as "genres[2]".
 func ValidateMovie(v *validator.Validator, movie *Movie) {
-	v.Check(movie.Title != "", "title", "must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Apply("title", validator.Required(movie.Title), validator.MaxLength(movie.Title, 500))
 
-	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	v.Apply("year",
+		validator.Required(movie.Year),
+		validator.Min(movie.Year, 1888).WithMessage("movie_year_min"),
+		validator.Max(movie.Year, int32(time.Now().Year())).WithMessage("movie_year_future"),
+	)
 
-	v.Check(movie.Runtime != 0, "runtime", "must be provided")
-	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
+	v.Apply("runtime",
+		validator.Required(movie.Runtime),
+		validator.Min(int32(movie.Runtime), 1).WithMessage("positive"),
+	)
 
-	v.Check(movie.Genres != nil, "genres", "must be provided")
-	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
-	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+	v.Apply("genres",
+		validator.RequiredSlice(movie.Genres),
+		validator.MinItems(movie.Genres, 1).WithMessage("movie_genres_min"),
+		validator.MaxItems(movie.Genres, 5).WithMessage("movie_genres_max"),
+		validator.NoDuplicates(movie.Genres),
+	)
+
+	for i, genre := range movie.Genres {
+		v.Apply(validator.Path("genres", i), validator.Required(genre), validator.MaxLength(genre, 100))
+	}
 }
 
 // Insert adds a new movie record to the database and updates the movie struct with
-// the generated ID, creation timestamp, and version number.
+// the generated ID, creation timestamp, and version number. An "insert" revision
+// attributed to the given user is recorded in the same transaction.
 // Parameters:
 //   - movie: A pointer to a Movie struct containing the movie data to insert
+//   - userID: The ID of the user performing the insert (0 if unknown)
 //
 // Returns:
 //   - error: Any database error that occurs during the operation
-func (m MovieModel) Insert(movie *Movie) error {
+func (m MovieModel) Insert(movie *Movie, userID int64) error {
+	// Create a context with a 3-second timeout to ensure the database operation does not hang indefinitely.
+	// The cancel function should be called to release resources once the operation completes.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel() // Ensure the context is cancelled to avoid resource leaks.
+
+	// Begin a transaction so that the movie and its first revision are written together.
+	// Rollback is a no-op once the transaction has been committed.
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertMovie(ctx, tx, movie, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertMovie does the work of Insert as part of the given transaction.
+func insertMovie(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
 	// Define the SQL query for inserting a new movie record.
-	// The query includes parameters for title, year, runtime, and genres,
-	// and returns the auto-generated ID, creation timestamp, and version.
+	// The query includes parameters for title, year, runtime, genres, the moderation
+	// status and the user creating the movie, and returns the auto-generated ID, creation
+	// and update timestamps, and version.
 	query := `
-			INSERT INTO MOVIES (title, year, runtime, genres)
-			VALUES ($1, $2, $3, $4)
-			RETURNING id, created_at, version
+			INSERT INTO MOVIES (title, year, runtime, genres, status, submitted_by, created_by, updated_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+			RETURNING id, created_at, updated_at, version
 		`
 
-	// Prepare the arguments for the query, converting the genres slice to a PostgreSQL array
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	// Movies are published straight away unless they are being submitted for moderation.
+	if movie.Status == "" {
+		movie.Status = MovieStatusPublished
+	}
 
-	// Create a context with a 3-second timeout to ensure the database operation does not hang indefinitely.
-	// The cancel function should be called to release resources once the operation completes.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel() // Ensure the context is cancelled to avoid resource leaks.
+	// Prepare the arguments for the query, converting the genres slice to a PostgreSQL array
+	// and recording an unknown submitter or creator as NULL
+	args := []any{
+		movie.Title,
+		movie.Year,
+		movie.Runtime,
+		pq.Array(movie.Genres),
+		movie.Status,
+		nullUserID(movie.SubmittedBy),
+		nullUserID(userID),
+	}
 
-	// Execute the SQL insert statement and scan the generated ID, creation timestamp,
-	// and version number into the corresponding fields of the provided movie struct.
+	// Execute the SQL insert statement and scan the generated ID, timestamps, and version
+	// number into the corresponding fields of the provided movie struct.
 	// This ensures the movie struct is updated with the database-generated values.
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.UpdatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	movie.CreatedBy = userID
+	movie.UpdatedBy = userID
+
+	// Record the insert in the movie's revision history.
+	return insertRevision(ctx, tx, RevisionInsert, userID, movie, nil, movie, movie.Version)
 }
 
 // Get retrieves a movie record from the database by its ID.
@@ -96,30 +180,54 @@ func (m MovieModel) Insert(movie *Movie) error {
 //   - ErrRecordNotFound if the ID doesn't exist or is invalid
 //   - Database errors for other failures
 func (m MovieModel) Get(id int64) (*Movie, error) {
+	// Create a context with a 3-second timeout to ensure the database query does not hang indefinitely.
+	// The cancel function should be called to release resources once the operation completes.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel() // Ensure the context is cancelled to avoid resource leaks.
+
+	return getMovie(ctx, m.DB, id, false)
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx, so that a read can be made either
+// directly or as part of a transaction.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getMovie does the work of Get using the given querier. If lock is true the row is locked
+// with FOR UPDATE until the end of the surrounding transaction.
+func getMovie(ctx context.Context, q querier, id int64, lock bool) (*Movie, error) {
 	// Validate that the ID is positive
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	// Define the SQL query to select a movie by ID
-	// The query retrieves all movie fields from the database
+	// The query retrieves all movie fields from the database, along with its external IDs,
+	// alternate titles, releases and images. Movies are returned whatever their moderation
+	// status; handlers decide who may see unpublished movies.
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, created_at, title, year, runtime, genres, version,
+			status, status_reason, COALESCE(submitted_by, 0),
+			COALESCE(created_by, 0), COALESCE(updated_by, 0), updated_at,
+			` + movieExternalIDsColumn + `,
+			` + movieAlternateTitlesColumn + `,
+			` + movieReleasesColumn + `,
+			` + movieImagesColumn + `
 		FROM movies
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 		`
 
+	if lock {
+		query += "FOR UPDATE"
+	}
+
 	// Initialize an empty Movie struct to hold the retrieved data
 	var movie Movie
 
-	// Create a context with a 3-second timeout to ensure the database query does not hang indefinitely.
-	// The cancel function should be called to release resources once the operation completes.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel() // Ensure the context is cancelled to avoid resource leaks.
-
 	// Execute the SQL query with a context timeout and scan the result into the movie struct fields.
 	// pq.Array is used to convert the PostgreSQL genres array into a Go slice.
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := q.QueryRowContext(ctx, query, id).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
@@ -127,6 +235,16 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.Status,
+		&movie.StatusReason,
+		&movie.SubmittedBy,
+		&movie.CreatedBy,
+		&movie.UpdatedBy,
+		&movie.UpdatedAt,
+		&movie.ExternalIDs,
+		&movie.AlternateTitles,
+		&movie.Releases,
+		&movie.Images,
 	)
 	// Handle any errors that occurred during the query execution
 	if err != nil {
@@ -147,25 +265,58 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 // Update modifies an existing movie record in the database using optimistic concurrency control.
 // It performs an atomic update of all movie fields and increments the version number to prevent race conditions.
 // The update will only succeed if the movie's current version matches the expected version.
+// On success the movie's Version field is set to the new version, and an "update" revision
+// attributed to the given user is recorded in the same transaction.
 // Returns:
 //   - error: Any error that occurs during the operation, including:
 //   - ErrEditConflict if the version check fails (indicating concurrent modification)
 //   - Database errors for connection/query failures
 //   - sql.ErrNoRows if no record was found (though this is converted to ErrEditConflict)
-func (m MovieModel) Update(movie Movie) error {
+func (m MovieModel) Update(movie *Movie, userID int64) error {
+	// Create a context with a 3-second timeout to ensure the update operation does not hang indefinitely.
+	// The cancel function should be called to release resources once the operation completes.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel() // Ensure the context is cancelled to avoid resource leaks.
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateMovie(ctx, tx, movie, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateMovie does the work of Update as part of the given transaction.
+func updateMovie(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
+	// Define the SQL query which locks the current row, so that we can compute the diff
+	// against the values being replaced. It only matches if the version is unchanged.
+	lockQuery := `
+		SELECT title, year, runtime, genres
+		FROM movies
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		FOR UPDATE
+		`
+
 	// Define the SQL query for updating a movie record with optimistic concurrency control.
 	// The query performs an atomic update that:
 	// - Sets all movie fields (title, year, runtime, genres)
+	// - Records the user making the change and the time of the change
 	// - Increments the version number to prevent race conditions
 	// - Uses both ID and current version in WHERE clause to ensure:
 	//   * The correct record is targeted (by ID)
 	//   * The record hasn't been modified since it was fetched (by version)
-	// - Returns the new version number via RETURNING clause for verification
+	// - Returns the new version number and update time via RETURNING clause for verification
 	query := `
 		UPDATE movies
-		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+		SET title = $1, year = $2, runtime = $3, genres = $4, updated_by = $7, updated_at = NOW(), version = version + 1
 		WHERE id = $5 AND version = $6
-		RETURNING version
+		RETURNING version, updated_at
 		`
 
 	// Prepare the arguments for the query in the correct order
@@ -177,18 +328,33 @@ func (m MovieModel) Update(movie Movie) error {
 		pq.Array(movie.Genres),
 		movie.ID,
 		movie.Version,
+		nullUserID(userID),
 	}
 
-	// Create a context with a 3-second timeout to ensure the update operation does not hang indefinitely.
-	// The cancel function should be called to release resources once the operation completes.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel() // Ensure the context is cancelled to avoid resource leaks.
+	// Lock and read the current values of the record. If no row matches, the record was
+	// changed by another process or does not exist, which we report as an edit conflict.
+	before := Movie{ID: movie.ID}
+
+	err := tx.QueryRowContext(ctx, lockQuery, movie.ID, movie.Version).Scan(
+		&before.Title,
+		&before.Year,
+		&before.Runtime,
+		pq.Array(&before.Genres),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
 
 	// Execute the update query and attempt to scan the new version number into the movie struct.
 	// If the update fails due to a version mismatch (i.e., another process has modified the record),
 	// the query will return sql.ErrNoRows, which we translate to ErrEditConflict to signal a concurrency conflict.
 	// Any other error is returned as-is.
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version, &movie.UpdatedAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -200,91 +366,175 @@ func (m MovieModel) Update(movie Movie) error {
 		}
 	}
 
-	return nil
+	movie.UpdatedBy = userID
+
+	// Record the update, and the fields it changed, in the movie's revision history.
+	return insertRevision(ctx, tx, RevisionUpdate, userID, movie, &before, movie, movie.Version)
 }
 
-// Delete removes a movie record from the database by its ID.
+// Delete moves a movie record to the trash by setting its deleted_at timestamp. Trashed
+// movies are excluded from Get and GetAll, can be brought back with Restore, and are
+// permanently removed by PurgeDeleted once the retention period has passed. The delete
+// bumps the version number and records a "delete" revision attributed to the given user
+// in the same transaction. If version is non-zero, the movie is only deleted if it still
+// has that version.
 // Returns:
-//   - ErrRecordNotFound if the ID is invalid (<1) or no rows were deleted
+//   - ErrRecordNotFound if the ID is invalid (<1) or no movie (outside the trash) was found
+//   - ErrEditConflict if a version was given and the movie no longer has it
 //   - Any database error encountered during execution
-func (m MovieModel) Delete(id int64) error {
+func (m MovieModel) Delete(id int64, version int32, userID int64) error {
+	// Create a context with a 3-second timeout to ensure the delete operation does not hang indefinitely.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Ensure the context is cancelled to free up resources once the operation completes.
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteMovie(ctx, tx, id, version, userID)
+	if err != nil {
+		return err
+	}
+
+	// Successful deletion
+	return tx.Commit()
+}
+
+// deleteMovie does the work of Delete as part of the given transaction.
+func deleteMovie(ctx context.Context, tx *sql.Tx, id int64, version int32, userID int64) error {
 	// Validate the ID; must be a positive integer
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	// SQL query to delete the movie with the specified ID
+	// SQL query to soft delete the movie with the specified ID, returning its values
+	// so that they can be kept in the revision history.
 	query := `
-		DELETE FROM movies
-		WHERE id = $1
+		UPDATE movies
+		SET deleted_at = NOW(), updated_by = $3, updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND (version = $2 OR $2 = 0)
+		RETURNING title, year, runtime, genres, version
+		`
+
+	// Execute the SQL UPDATE statement to trash the movie with the specified ID.
+	// If no row was returned, the movie was not found (or is already in the trash), or it
+	// no longer has the expected version.
+	movie := Movie{ID: id}
+
+	err := tx.QueryRowContext(ctx, query, id, version, nullUserID(userID)).Scan(
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			return ErrEditConflict
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	// Record the deletion in the movie's revision history.
+	return insertRevision(ctx, tx, RevisionDelete, userID, &movie, &movie, nil, movie.Version)
+}
+
+// Restore takes a movie back out of the trash, bumping its version number and recording
+// a "restore" revision attributed to the given user in the same transaction.
+// Returns the restored movie, or ErrRecordNotFound if there is no such movie in the trash.
+func (m MovieModel) Restore(id int64, userID int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, updated_by = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, created_at, title, year, runtime, genres, version,
+			status, COALESCE(created_by, 0), COALESCE(updated_by, 0), updated_at
 		`
 
-	// Create a context with a 3-second timeout to ensure the delete operation does not hang indefinitely.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	// Ensure the context is cancelled to free up resources once the operation completes.
 	defer cancel()
 
-	// Execute the SQL DELETE statement to remove the movie with the specified ID.
-	result, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		// If an error occurs during the execution of the DELETE statement, return it.
-		return err
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var movie Movie
+
+	err = tx.QueryRowContext(ctx, query, id, nullUserID(userID)).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.Status,
+		&movie.CreatedBy,
+		&movie.UpdatedBy,
+		&movie.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
 
-	// Check how many rows were affected (should be 1 if deleted)
-	rowsAffected, err := result.RowsAffected()
+	// Record the restore in the movie's revision history.
+	err = insertRevision(ctx, tx, RevisionRestore, userID, &movie, nil, &movie, movie.Version)
 	if err != nil {
-		// Return any error encountered while checking affected rows
-		return err
+		return nil, err
 	}
 
-	// If no rows were affected, the movie was not found
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
 	}
 
-	// Successful deletion
-	return nil
+	return &movie, nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// GetAllDeleted returns a page of the movies currently in the trash, together with the
+// time at which each of them was deleted.
+func (m MovieModel) GetAllDeleted(filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at
 		FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4
-		`, filters.sortColumn(), filters.sortDirection())
-	// Create a context with a 3-second timeout to avoid hanging queries.
+		WHERE deleted_at IS NOT NULL
+		ORDER BY %s
+		LIMIT $1 OFFSET $2
+		`, filters.orderBy(nil))
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Prepare the arguments for the SQL query:
-	// - $1: title filter for full-text search (empty string means no filtering)
-	// - $2: genres filter as a Postgres array (empty array means no filtering)
-	// - $3: limit for pagination (maximum number of results per page)
-	// - $4: offset for pagination (number of results to skip)
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
-
-	// Execute the SQL query using the constructed query string and arguments for filtering, sorting, and pagination.
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
-	// Ensure the rows are closed after processing to free up database resources.
 	defer rows.Close()
 
-	// Initialize a variable to store the total number of records returned by the query.
 	totalRecords := 0
-	// Initialize a slice to hold pointers to Movie structs for the result set.
 	movies := []*Movie{}
 
-	// Iterate over the rows in the result set.
 	for rows.Next() {
 		var movie Movie
 
-		// Scan the current row into the movie struct.
 		err := rows.Scan(
 			&totalRecords,
 			&movie.ID,
@@ -294,7 +544,151 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// PurgeDeleted permanently removes every movie which was moved to the trash before the
+// given time, and returns the number of movies removed. Their revision history is kept.
+// A tombstone is left for each published movie, so that clients syncing their copy of the
+// catalogue with GetChangesSince still learn that it was deleted.
+func (m MovieModel) PurgeDeleted(before time.Time) (int64, error) {
+	query := `
+		WITH purged AS (
+			DELETE FROM movies
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			RETURNING id, status, updated_at
+		), tombstones AS (
+			INSERT INTO movie_tombstones (movie_id, deleted_at)
+			SELECT id, updated_at FROM purged WHERE status = 'published'
+			ON CONFLICT (movie_id) DO NOTHING
 		)
+		SELECT count(*) FROM purged
+		`
+
+	// Purging runs in the background and may remove many rows at once, so it is given
+	// a longer timeout than the queries made while handling requests.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var purged int64
+
+	err := m.DB.QueryRowContext(ctx, query, before).Scan(&purged)
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// MovieFilterSchema holds the fields of a movie which clients may filter the movie list on
+// with filter expressions such as filter[year][gte]=1990. A title search matches alternate
+// titles as well as the original title. The plain "title" and "genres" parameters, which
+// predate filter expressions, search the title and require every given genre.
+var MovieFilterSchema = filter.Schema{
+	"id": {Expr: "id", Type: filter.Int, Operators: []filter.Operator{filter.Eq, filter.Ne, filter.In}},
+	"title": {
+		Expr:      "title",
+		Type:      filter.String,
+		Operators: []filter.Operator{filter.Match},
+		Templates: map[filter.Operator]string{
+			filter.Match: `(to_tsvector('simple', title) @@ plainto_tsquery('simple', %[1]s)
+			OR EXISTS (
+				SELECT 1 FROM movie_titles t
+				WHERE t.movie_id = movies.id AND to_tsvector('simple', t.title) @@ plainto_tsquery('simple', %[1]s)))`,
+		},
+		Param:   "title",
+		ParamOp: filter.Match,
+	},
+	"genres": {
+		Expr:      "genres",
+		Type:      filter.StringArray,
+		Operators: []filter.Operator{filter.Contains, filter.In},
+		Param:     "genres",
+		ParamOp:   filter.Contains,
+	},
+	"year":       {Expr: "year", Type: filter.Int, Operators: movieComparisonOperators},
+	"runtime":    {Expr: "runtime", Type: filter.Int, Operators: movieComparisonOperators},
+	"updated_at": {Expr: "updated_at", Type: filter.Time, Operators: []filter.Operator{filter.Gt, filter.Gte, filter.Lt, filter.Lte}},
+}
+
+// movieComparisonOperators are the operators of the numeric fields in MovieFilterSchema.
+var movieComparisonOperators = []filter.Operator{
+	filter.Eq, filter.Ne, filter.Lt, filter.Lte, filter.Gt, filter.Gte, filter.In,
+}
+
+// movieFilterClause returns the WHERE clause shared by every query that filters the movies
+// table with a filter parsed against MovieFilterSchema, so that list results and aggregates
+// (such as facets) are always computed over the same set of rows. Movies in the trash and
+// movies which haven't been published are always excluded.
+func movieFilterClause(where filter.Clause) string {
+	return `
+		WHERE deleted_at IS NULL AND status = 'published'
+		AND ` + where.SQL
+}
+
+// MovieSortKeys are the computed and nullable sort keys of GetAll and Export, for handlers
+// to set in Filters.SortKeys:
+//   - relevance: how well the title matches the title search (use "-relevance" for best first)
+//   - release_date: the movie's earliest release date, which is NULL for movies without releases
+var MovieSortKeys = SortKeys{
+	"relevance":    {Expr: "ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', %[1]s))", Search: "title"},
+	"release_date": {Expr: "(SELECT min(release_date) FROM movie_releases WHERE movie_id = movies.id)", Nullable: true},
+}
+
+// GetAll returns a page of the published movies matching the filter, selecting only the
+// columns needed by the projection.
+func (m MovieModel) GetAll(f filter.Filter, filters Filters, projection MovieProjection) ([]*Movie, Metadata, error) {
+	where := f.Where(1)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM movies
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+		`, projection.selectList(), movieFilterClause(where), filters.orderBy(&where), len(where.Args)+1, len(where.Args)+2)
+	// Create a context with a 3-second timeout to avoid hanging queries.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Prepare the arguments for the SQL query: the values of the filter's conditions,
+	// followed by the limit and offset for pagination.
+	args := append(where.Args, filters.limit(), filters.offset())
+
+	// Execute the SQL query using the constructed query string and arguments for filtering, sorting, and pagination.
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	// Ensure the rows are closed after processing to free up database resources.
+	defer rows.Close()
+
+	// Initialize a variable to store the total number of records returned by the query.
+	totalRecords := 0
+	// Initialize a slice to hold pointers to Movie structs for the result set.
+	movies := []*Movie{}
+
+	// Iterate over the rows in the result set.
+	for rows.Next() {
+		var movie Movie
+
+		// Scan the current row into the movie struct, in the projection's columns.
+		err := rows.Scan(append([]any{&totalRecords}, projection.scanDest(&movie)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -314,3 +708,81 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 
 	return movies, metadata, nil
 }
+
+// exportChunkSize is the number of rows fetched from the cursor at a time by Export.
+const exportChunkSize = 500
+
+// Export streams every movie matching the filter to fn, in the order given by the filters'
+// sort value (pagination is ignored). Rather than loading the whole result set at once the
+// way GetAll does, it reads the movies through a server-side cursor in chunks of
+// exportChunkSize rows. Because an export can take much longer than a normal
+// query, the caller controls its lifetime through ctx. Any error returned by fn stops the
+// export and is returned.
+func (m MovieModel) Export(ctx context.Context, f filter.Filter, filters Filters, fn func(*Movie) error) error {
+	// A cursor only exists for the lifetime of its transaction. The transaction is read-only
+	// and is never committed, so rolling it back when we are done closes the cursor.
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where := f.Where(1)
+
+	query := fmt.Sprintf(`
+		DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movies
+		%s
+		ORDER BY %s
+		`, movieFilterClause(where), filters.orderBy(&where))
+
+	_, err = tx.ExecContext(ctx, query, where.Args...)
+	if err != nil {
+		return err
+	}
+
+	for {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH %d FROM movies_export", exportChunkSize))
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+
+		for rows.Next() {
+			var movie Movie
+
+			err := rows.Scan(
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+			)
+			if err == nil {
+				err = fn(&movie)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			fetched++
+		}
+
+		// Close the rows explicitly rather than with defer, because we are in a loop.
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		// A short chunk means the cursor has been exhausted.
+		if fetched < exportChunkSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// MovieFieldSafelist holds the movie fields that clients may choose with the "fields" query
+// string parameter of the movie show and list endpoints.
+var MovieFieldSafelist = []string{
+	"id", "title", "display_title", "year", "runtime", "genres", "version",
+	"status", "status_reason", "submitted_by", "created_by", "updated_by", "updated_at",
+}
+
+// MovieIncludeSafelist holds the related resources that clients may embed in movies with
+// the "include" query string parameter. "creator" is the user who created the movie.
+var MovieIncludeSafelist = []string{"external_ids", "alternate_titles", "releases", "images", "creator"}
+
+// defaultMovieIncludes are the related resources embedded in movies when the client
+// chooses neither fields nor includes, which is what movie responses have always held.
+var defaultMovieIncludes = []string{"external_ids", "alternate_titles", "releases", "images"}
+
+// MovieCreator is the user who created a movie, as embedded with include=creator.
+type MovieCreator struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// movieCreatorColumn selects the user who created each row of the movies table as JSON.
+const movieCreatorColumn = `(
+			SELECT jsonb_build_object('id', u.id, 'name', u.name)
+			FROM users u
+			WHERE u.id = movies.created_by)`
+
+// MovieProjection chooses which fields of a movie are selected from the database and sent
+// to the client, and which related resources are embedded in it. With neither Fields nor
+// Include set, movies hold every field and the default related resources. With only
+// Include set, they hold every field and the chosen related resources. With Fields set,
+// they hold only the chosen fields and related resources.
+type MovieProjection struct {
+	Fields  []string
+	Include []string
+}
+
+// ValidateMovieProjection checks that every chosen field and related resource is in its
+// safelist, and that none was chosen more than once.
+func ValidateMovieProjection(v *validator.Validator, p MovieProjection) {
+	for _, field := range p.Fields {
+		v.Apply("fields", validator.Enum(field, MovieFieldSafelist...).WithMessage("field_invalid"))
+	}
+	v.Apply("fields", validator.NoDuplicates(p.Fields))
+
+	for _, include := range p.Include {
+		v.Apply("include", validator.Enum(include, MovieIncludeSafelist...).WithMessage("include_invalid"))
+	}
+	v.Apply("include", validator.NoDuplicates(p.Include))
+}
+
+// fields returns the fields the projection chooses.
+func (p MovieProjection) fields() []string {
+	if len(p.Fields) == 0 {
+		return MovieFieldSafelist
+	}
+	return p.Fields
+}
+
+// includes returns the related resources the projection embeds.
+func (p MovieProjection) includes() []string {
+	if len(p.Fields) == 0 && len(p.Include) == 0 {
+		return defaultMovieIncludes
+	}
+	return p.Include
+}
+
+// movieColumn is a column of a movie which can be selected, with a function returning where
+// to scan it in a Movie.
+type movieColumn struct {
+	expr string
+	dest func(movie *Movie) any
+}
+
+// movieRequiredColumns are always selected, whatever the projection, because handlers need
+// them to decide who may see a movie and to set its ETag.
+var movieRequiredColumns = []movieColumn{
+	{"id", func(m *Movie) any { return &m.ID }},
+	{"version", func(m *Movie) any { return &m.Version }},
+	{"status", func(m *Movie) any { return &m.Status }},
+	{"COALESCE(submitted_by, 0)", func(m *Movie) any { return &m.SubmittedBy }},
+}
+
+// movieProjectionColumns maps each field and related resource to the columns it needs. The
+// display title is chosen from the alternate titles, so it needs them as well as the title.
+var movieProjectionColumns = map[string][]movieColumn{
+	"title":         {{"title", func(m *Movie) any { return &m.Title }}},
+	"display_title": {{"title", func(m *Movie) any { return &m.Title }}, {movieAlternateTitlesColumn, func(m *Movie) any { return &m.AlternateTitles }}},
+	"year":          {{"year", func(m *Movie) any { return &m.Year }}},
+	"runtime":       {{"runtime", func(m *Movie) any { return &m.Runtime }}},
+	"genres":        {{"genres", func(m *Movie) any { return pq.Array(&m.Genres) }}},
+	"status_reason": {{"status_reason", func(m *Movie) any { return &m.StatusReason }}},
+	"created_by":    {{"COALESCE(created_by, 0)", func(m *Movie) any { return &m.CreatedBy }}},
+	"updated_by":    {{"COALESCE(updated_by, 0)", func(m *Movie) any { return &m.UpdatedBy }}},
+	"updated_at":    {{"updated_at", func(m *Movie) any { return &m.UpdatedAt }}},
+
+	"external_ids":     {{movieExternalIDsColumn, func(m *Movie) any { return &m.ExternalIDs }}},
+	"alternate_titles": {{movieAlternateTitlesColumn, func(m *Movie) any { return &m.AlternateTitles }}},
+	"releases":         {{movieReleasesColumn, func(m *Movie) any { return &m.Releases }}},
+	"images":           {{movieImagesColumn, func(m *Movie) any { return &m.Images }}},
+	"creator":          {{movieCreatorColumn, func(m *Movie) any { return jsonScanner{&m.Creator} }}},
+}
+
+// columns returns the columns to select for the projection, each only once, starting with
+// movieRequiredColumns.
+func (p MovieProjection) columns() []movieColumn {
+	columns := slices.Clone(movieRequiredColumns)
+
+	for _, name := range append(slices.Clone(p.fields()), p.includes()...) {
+		for _, column := range movieProjectionColumns[name] {
+			if !slices.ContainsFunc(columns, func(c movieColumn) bool { return c.expr == column.expr }) {
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	return columns
+}
+
+// selectList returns the columns of the projection as the select list of a query.
+func (p MovieProjection) selectList() string {
+	var exprs []string
+	for _, column := range p.columns() {
+		exprs = append(exprs, column.expr)
+	}
+
+	return strings.Join(exprs, ", ")
+}
+
+// scanDest returns where to scan each of the projection's columns in the movie.
+func (p MovieProjection) scanDest(movie *Movie) []any {
+	var dest []any
+	for _, column := range p.columns() {
+		dest = append(dest, column.dest(movie))
+	}
+
+	return dest
+}
+
+// Present returns the movie as it should be sent to the client: the movie itself when
+// the client chose neither fields nor includes, or otherwise an object holding only the
+// chosen fields and related resources. Fields which the movie omits when they are empty
+// are still omitted.
+func (p MovieProjection) Present(movie *Movie) (any, error) {
+	if len(p.Fields) == 0 && len(p.Include) == 0 {
+		return movie, nil
+	}
+
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+
+	err = json.Unmarshal(js, &all)
+	if err != nil {
+		return nil, err
+	}
+
+	chosen := make(map[string]json.RawMessage)
+
+	for _, name := range append(slices.Clone(p.fields()), p.includes()...) {
+		if value, ok := all[name]; ok {
+			chosen[name] = value
+		}
+	}
+
+	return chosen, nil
+}
+
+// GetProjected retrieves a movie by its ID, selecting only the columns needed by the
+// projection (and those in movieRequiredColumns). It returns ErrRecordNotFound if there is
+// no such movie outside the trash.
+func (m MovieModel) GetProjected(id int64, p MovieProjection) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + p.selectList() + `
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movie Movie
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(p.scanDest(&movie)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
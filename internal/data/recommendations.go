@@ -0,0 +1,524 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// Recommendation is a movie suggested by a Recommender, with its score (between 0 and 1,
+// higher is better) and short reasons for suggesting it, such as "same genres".
+type Recommendation struct {
+	Movie   *Movie   `json:"movie"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// TasteProfile holds what is known about a user's taste: the movies they rated, with each
+// rating scaled to between 0 (disliked) and 1 (loved), and the movies on their watchlist.
+type TasteProfile struct {
+	Ratings   map[int64]float64
+	Watchlist []int64
+}
+
+// Recommender suggests movies. Similar returns the movies most like the given one, for
+// "more like this" lists, and Recommend returns personal picks for a user. Both return at
+// most limit recommendations, best first, and never include unpublished movies.
+type Recommender interface {
+	Similar(movie *Movie, limit int) ([]Recommendation, error)
+	Recommend(userID int64, limit int) ([]Recommendation, error)
+}
+
+// MovieCatalog supplies the movies a recommender chooses from. Candidates returns up to
+// limit published movies which share a genre or a title word with any of the seed movies,
+// Recent returns the most recently added published movies, and GetMany returns the
+// published movies with the given IDs.
+type MovieCatalog interface {
+	Candidates(seeds []*Movie, limit int) ([]*Movie, error)
+	Recent(limit int) ([]*Movie, error)
+	GetMany(ids []int64) ([]*Movie, error)
+}
+
+// RatingSource supplies the ratings a recommender learns from. CoRatings returns, for the
+// movies rated by the same users as the given movie, how strongly their ratings agree
+// (between 0 and 1), and Profile returns a user's taste profile. This tree doesn't record
+// ratings or watchlists yet, so there is no implementation; a ContentRecommender without
+// one scores movies on their content alone.
+type RatingSource interface {
+	CoRatings(movieID int64) (map[int64]float64, error)
+	Profile(userID int64) (*TasteProfile, error)
+}
+
+// SimilarityWeights sets how much each signal counts towards the similarity of two movies.
+// The co-rating weight is only used when ratings are available.
+type SimilarityWeights struct {
+	Genres   float64
+	Year     float64
+	Runtime  float64
+	Title    float64
+	CoRating float64
+}
+
+// DefaultSimilarityWeights are the weights used by NewContentRecommender.
+var DefaultSimilarityWeights = SimilarityWeights{Genres: 0.5, Year: 0.15, Runtime: 0.1, Title: 0.25, CoRating: 0.5}
+
+// Limits on how far apart two movies' years and runtimes can be while still counting as
+// close. Movies further apart than this score nothing on that signal.
+const (
+	similarYearRange    = 20
+	similarRuntimeRange = 60
+)
+
+// candidatesPerSeed is how many candidate movies are considered for each seed movie.
+const candidatesPerSeed = 200
+
+// ContentRecommender is a deterministic Recommender which scores movies on how alike they
+// are: genre overlap, closeness of year and runtime, shared title words and, when Ratings
+// is set, co-ratings. Equal scores are ordered by movie ID, so the same catalogue and
+// ratings always give the same recommendations. Because it only depends on the MovieCatalog
+// and RatingSource interfaces, it can be run against movies held in memory.
+type ContentRecommender struct {
+	Catalog MovieCatalog
+	Ratings RatingSource
+	Weights SimilarityWeights
+}
+
+// NewContentRecommender returns a ContentRecommender using the default weights. ratings
+// may be nil.
+func NewContentRecommender(catalog MovieCatalog, ratings RatingSource) *ContentRecommender {
+	return &ContentRecommender{Catalog: catalog, Ratings: ratings, Weights: DefaultSimilarityWeights}
+}
+
+// Similar implements the Recommender interface.
+func (r *ContentRecommender) Similar(movie *Movie, limit int) ([]Recommendation, error) {
+	candidates, err := r.Catalog.Candidates([]*Movie{movie}, candidatesPerSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	var coRatings map[int64]float64
+	if r.Ratings != nil {
+		coRatings, err = r.Ratings.CoRatings(movie.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var recommendations []Recommendation
+
+	for _, candidate := range candidates {
+		if candidate.ID == movie.ID {
+			continue
+		}
+
+		coRating, rated := coRatings[candidate.ID]
+		score, reasons := r.similarity(movie, candidate, coRating, rated)
+		if score > 0 {
+			recommendations = append(recommendations, Recommendation{Movie: candidate, Score: score, Reasons: reasons})
+		}
+	}
+
+	return topRecommendations(recommendations, limit), nil
+}
+
+// Recommend implements the Recommender interface. The user's liked and watchlisted movies
+// are used as seeds, and each candidate is scored on its similarity to the seeds, weighted
+// by how much the user liked each seed. Movies the user has already rated are left out.
+// A user with no ratings or watchlist (which, without a RatingSource, is every user) is
+// recommended the newest movies in the catalogue instead.
+func (r *ContentRecommender) Recommend(userID int64, limit int) ([]Recommendation, error) {
+	profile := &TasteProfile{}
+
+	if r.Ratings != nil {
+		p, err := r.Ratings.Profile(userID)
+		if err != nil {
+			return nil, err
+		}
+		profile = p
+	}
+
+	affinity := profile.affinities()
+	if len(affinity) == 0 {
+		return r.recent(limit)
+	}
+
+	seedIDs := make([]int64, 0, len(affinity))
+	for id := range affinity {
+		seedIDs = append(seedIDs, id)
+	}
+	slices.Sort(seedIDs)
+
+	seeds, err := r.Catalog.GetMany(seedIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(seeds) == 0 {
+		return r.recent(limit)
+	}
+
+	candidates, err := r.Catalog.Candidates(seeds, candidatesPerSeed*len(seeds))
+	if err != nil {
+		return nil, err
+	}
+
+	var recommendations []Recommendation
+
+	for _, candidate := range candidates {
+		// Leave out movies the user has already rated or put on their watchlist.
+		if _, rated := profile.Ratings[candidate.ID]; rated || slices.Contains(profile.Watchlist, candidate.ID) {
+			continue
+		}
+
+		var total, weights, best float64
+		var bestSeed *Movie
+
+		for _, seed := range seeds {
+			score, _ := r.similarity(seed, candidate, 0, false)
+
+			total += affinity[seed.ID] * score
+			weights += affinity[seed.ID]
+
+			if contribution := affinity[seed.ID] * score; contribution > best {
+				best, bestSeed = contribution, seed
+			}
+		}
+
+		if bestSeed == nil {
+			continue
+		}
+
+		recommendations = append(recommendations, Recommendation{
+			Movie:   candidate,
+			Score:   round(total / weights),
+			Reasons: []string{fmt.Sprintf("similar to %s", bestSeed.Title)},
+		})
+	}
+
+	return topRecommendations(recommendations, limit), nil
+}
+
+// recent recommends the newest movies in the catalogue, for users about whom nothing is
+// known yet.
+func (r *ContentRecommender) recent(limit int) ([]Recommendation, error) {
+	movies, err := r.Catalog.Recent(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]Recommendation, len(movies))
+	for i, movie := range movies {
+		recommendations[i] = Recommendation{Movie: movie, Score: 0, Reasons: []string{"new in the catalogue"}}
+	}
+
+	return recommendations, nil
+}
+
+// affinities returns how much the user likes each of the movies in the profile: their
+// rating for rated movies which they liked (rated above the middle of the scale), and full
+// affinity for movies on their watchlist which they haven't rated.
+func (p *TasteProfile) affinities() map[int64]float64 {
+	affinity := make(map[int64]float64)
+
+	for id, rating := range p.Ratings {
+		if rating > 0.5 {
+			affinity[id] = rating
+		}
+	}
+
+	for _, id := range p.Watchlist {
+		if _, rated := p.Ratings[id]; !rated {
+			affinity[id] = 1
+		}
+	}
+
+	return affinity
+}
+
+// similarity scores how alike two movies are, between 0 and 1, as the weighted average of
+// each signal, and gives the reasons for the signals which scored well. The co-rating
+// signal only counts if the movies were rated by the same users.
+func (r *ContentRecommender) similarity(a, b *Movie, coRating float64, rated bool) (float64, []string) {
+	w := r.Weights
+
+	genres := jaccard(a.Genres, b.Genres)
+	year := closeness(float64(a.Year), float64(b.Year), similarYearRange)
+	runtime := closeness(float64(a.Runtime), float64(b.Runtime), similarRuntimeRange)
+	title := jaccard(titleTokens(a.Title), titleTokens(b.Title))
+
+	total := w.Genres*genres + w.Year*year + w.Runtime*runtime + w.Title*title
+	weights := w.Genres + w.Year + w.Runtime + w.Title
+
+	if rated {
+		total += w.CoRating * coRating
+		weights += w.CoRating
+	}
+
+	if weights == 0 {
+		return 0, nil
+	}
+
+	// Two movies which share nothing but a similar year and runtime aren't really similar.
+	if genres == 0 && title == 0 && (!rated || coRating == 0) {
+		return 0, nil
+	}
+
+	var reasons []string
+
+	switch {
+	case genres == 1:
+		reasons = append(reasons, "same genres")
+	case genres > 0:
+		reasons = append(reasons, "shared genres")
+	}
+
+	if title > 0 {
+		reasons = append(reasons, "similar title")
+	}
+
+	if year >= 0.75 {
+		reasons = append(reasons, "released around the same time")
+	}
+
+	if rated && coRating >= 0.5 {
+		reasons = append(reasons, "liked by the same people")
+	}
+
+	return round(total / weights), reasons
+}
+
+// topRecommendations sorts recommendations by descending score, and then by movie ID so
+// that the order is deterministic, and returns at most limit of them.
+func topRecommendations(recommendations []Recommendation, limit int) []Recommendation {
+	slices.SortFunc(recommendations, func(a, b Recommendation) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Movie.ID, b.Movie.ID)
+	})
+
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+
+	if recommendations == nil {
+		recommendations = []Recommendation{}
+	}
+
+	return recommendations
+}
+
+// jaccard returns the Jaccard index of two sets of strings: the size of their intersection
+// divided by the size of their union, or 0 if both are empty.
+func jaccard(a, b []string) float64 {
+	setA := make(map[string]bool, len(a))
+	for _, s := range a {
+		setA[s] = true
+	}
+
+	setB := make(map[string]bool, len(b))
+	for _, s := range b {
+		setB[s] = true
+	}
+
+	shared := 0
+	for s := range setB {
+		if setA[s] {
+			shared++
+		}
+	}
+
+	union := len(setA) + len(setB) - shared
+	if union == 0 {
+		return 0
+	}
+
+	return float64(shared) / float64(union)
+}
+
+// closeness returns 1 for equal values, falling linearly to 0 for values which are span
+// or more apart. Missing values (zero) are never close.
+func closeness(a, b, span float64) float64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return max(0, 1-math.Abs(a-b)/span)
+}
+
+// titleStopWords are common words which say nothing about whether two titles are alike.
+var titleStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "of": true, "in": true, "on": true,
+	"to": true, "for": true, "with": true, "part": true,
+}
+
+// titleTokens splits a title into its distinct lower-case words, leaving out stop words
+// and single characters.
+func titleTokens(title string) []string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var tokens []string
+	for _, word := range words {
+		if len([]rune(word)) > 1 && !titleStopWords[word] && !slices.Contains(tokens, word) {
+			tokens = append(tokens, word)
+		}
+	}
+
+	return tokens
+}
+
+// round rounds a score to three decimal places, so that scores are stable across
+// platforms and readable in responses.
+func round(score float64) float64 {
+	return math.Round(score*1000) / 1000
+}
+
+// Candidates implements the MovieCatalog interface. It prefers movies sharing more genres
+// with the seeds, and then newer movies.
+func (m MovieModel) Candidates(seeds []*Movie, limit int) ([]*Movie, error) {
+	var genres, words []string
+	var ids []int64
+
+	for _, seed := range seeds {
+		genres = append(genres, seed.Genres...)
+		words = append(words, titleTokens(seed.Title)...)
+		ids = append(ids, seed.ID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, year, runtime, genres, version, status, %s
+		FROM movies
+		WHERE deleted_at IS NULL AND status = 'published' AND id <> ALL($3)
+		AND (genres && $1 OR to_tsvector('simple', title) @@ to_tsquery('simple', $2))
+		ORDER BY cardinality(ARRAY(SELECT unnest(genres) INTERSECT SELECT unnest($1::text[]))) DESC, id DESC
+		LIMIT $4
+		`, movieImagesColumn)
+
+	return m.queryRecommendable(query, pq.Array(genres), orTSQuery(words), pq.Array(ids), limit)
+}
+
+// Recent implements the MovieCatalog interface.
+func (m MovieModel) Recent(limit int) ([]*Movie, error) {
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, year, runtime, genres, version, status, %s
+		FROM movies
+		WHERE deleted_at IS NULL AND status = 'published'
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+		`, movieImagesColumn)
+
+	return m.queryRecommendable(query, limit)
+}
+
+// GetMany implements the MovieCatalog interface. The movies are returned in ID order.
+func (m MovieModel) GetMany(ids []int64) ([]*Movie, error) {
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, year, runtime, genres, version, status, %s
+		FROM movies
+		WHERE deleted_at IS NULL AND status = 'published' AND id = ANY($1)
+		ORDER BY id
+		`, movieImagesColumn)
+
+	return m.queryRecommendable(query, pq.Array(ids))
+}
+
+// queryRecommendable runs a query for the MovieCatalog methods, which all select the same
+// columns: the movie's own fields and its images, for showing the recommendations.
+func (m MovieModel) queryRecommendable(query string, args ...any) ([]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Status,
+			&movie.Images,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// orTSQuery builds a text search query matching any of the given words. The words come
+// from titleTokens, so they only hold letters and digits and need no escaping. With no
+// words the query is empty, which matches nothing.
+func orTSQuery(words []string) string {
+	return strings.Join(words, " | ")
+}
+
+// MovieSlice is a MovieCatalog holding its movies in memory, for running a recommender
+// without a database. It treats every movie it holds as published.
+type MovieSlice []*Movie
+
+// Candidates implements the MovieCatalog interface.
+func (s MovieSlice) Candidates(seeds []*Movie, limit int) ([]*Movie, error) {
+	var candidates []*Movie
+
+	for _, movie := range s {
+		isSeed := slices.ContainsFunc(seeds, func(seed *Movie) bool { return seed.ID == movie.ID })
+		related := slices.ContainsFunc(seeds, func(seed *Movie) bool {
+			return jaccard(seed.Genres, movie.Genres) > 0 || jaccard(titleTokens(seed.Title), titleTokens(movie.Title)) > 0
+		})
+
+		if !isSeed && related && len(candidates) < limit {
+			candidates = append(candidates, movie)
+		}
+	}
+
+	return candidates, nil
+}
+
+// Recent implements the MovieCatalog interface, treating higher IDs as newer.
+func (s MovieSlice) Recent(limit int) ([]*Movie, error) {
+	movies := slices.Clone(s)
+	slices.SortFunc(movies, func(a, b *Movie) int { return cmp.Compare(b.ID, a.ID) })
+
+	return movies[:min(limit, len(movies))], nil
+}
+
+// GetMany implements the MovieCatalog interface.
+func (s MovieSlice) GetMany(ids []int64) ([]*Movie, error) {
+	var movies []*Movie
+
+	for _, movie := range s {
+		if slices.Contains(ids, movie.ID) {
+			movies = append(movies, movie)
+		}
+	}
+
+	return movies, nil
+}
@@ -0,0 +1,195 @@
+package data
+
+import (
+	"slices"
+	"testing"
+)
+
+// testCatalog is a small catalogue for the recommender tests. Point Break is listed before
+// Speed, although it has the higher ID, to check that equal scores are ordered by ID.
+func testCatalog() MovieSlice {
+	return MovieSlice{
+		{ID: 1, Title: "The Matrix", Year: 1999, Runtime: 136, Genres: []string{"action", "sci-fi"}},
+		{ID: 2, Title: "The Matrix Reloaded", Year: 2003, Runtime: 138, Genres: []string{"action", "sci-fi"}},
+		{ID: 3, Title: "Blade Runner", Year: 1982, Runtime: 118, Genres: []string{"sci-fi", "drama"}},
+		{ID: 4, Title: "Notting Hill", Year: 1999, Runtime: 124, Genres: []string{"comedy", "romance"}},
+		{ID: 6, Title: "Point Break", Year: 1994, Runtime: 116, Genres: []string{"action", "thriller"}},
+		{ID: 5, Title: "Speed", Year: 1994, Runtime: 116, Genres: []string{"action", "thriller"}},
+	}
+}
+
+// fakeRatingSource is an in-memory RatingSource.
+type fakeRatingSource struct {
+	coRatings map[int64]map[int64]float64
+	profiles  map[int64]*TasteProfile
+}
+
+func (s fakeRatingSource) CoRatings(movieID int64) (map[int64]float64, error) {
+	return s.coRatings[movieID], nil
+}
+
+func (s fakeRatingSource) Profile(userID int64) (*TasteProfile, error) {
+	if profile, ok := s.profiles[userID]; ok {
+		return profile, nil
+	}
+	return &TasteProfile{}, nil
+}
+
+// scored is the part of a Recommendation checked by the tests.
+type scored struct {
+	id      int64
+	score   float64
+	reasons []string
+}
+
+func checkRecommendations(t *testing.T, got []Recommendation, want []scored) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d recommendations; want %d: %+v", len(got), len(want), got)
+	}
+
+	for i, w := range want {
+		g := got[i]
+		if g.Movie.ID != w.id || g.Score != w.score || !slices.Equal(g.Reasons, w.reasons) {
+			t.Errorf("recommendation %d: got movie %d, score %v, reasons %q; want movie %d, score %v, reasons %q",
+				i, g.Movie.ID, g.Score, g.Reasons, w.id, w.score, w.reasons)
+		}
+	}
+}
+
+func TestContentRecommenderSimilar(t *testing.T) {
+	matrix := testCatalog()[0]
+
+	tests := []struct {
+		name    string
+		ratings RatingSource
+		limit   int
+		want    []scored
+	}{
+		{
+			name:  "Content only",
+			limit: 10,
+			want: []scored{
+				{2, 0.842, []string{"same genres", "similar title", "released around the same time"}},
+				{5, 0.346, []string{"shared genres", "released around the same time"}},
+				{6, 0.346, []string{"shared genres", "released around the same time"}},
+				{3, 0.259, []string{"shared genres"}},
+			},
+		},
+		{
+			name:  "Limited",
+			limit: 2,
+			want: []scored{
+				{2, 0.842, []string{"same genres", "similar title", "released around the same time"}},
+				{5, 0.346, []string{"shared genres", "released around the same time"}},
+			},
+		},
+		{
+			name:    "With co-ratings",
+			ratings: fakeRatingSource{coRatings: map[int64]map[int64]float64{1: {3: 1}}},
+			limit:   10,
+			want: []scored{
+				{2, 0.842, []string{"same genres", "similar title", "released around the same time"}},
+				{3, 0.506, []string{"shared genres", "liked by the same people"}},
+				{5, 0.346, []string{"shared genres", "released around the same time"}},
+				{6, 0.346, []string{"shared genres", "released around the same time"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recommender := NewContentRecommender(testCatalog(), tt.ratings)
+
+			got, err := recommender.Similar(matrix, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkRecommendations(t, got, tt.want)
+		})
+	}
+}
+
+func TestContentRecommenderRecommend(t *testing.T) {
+	newest := []scored{
+		{6, 0, []string{"new in the catalogue"}},
+		{5, 0, []string{"new in the catalogue"}},
+		{4, 0, []string{"new in the catalogue"}},
+	}
+
+	tests := []struct {
+		name    string
+		ratings RatingSource
+		want    []scored
+	}{
+		{
+			name: "No rating source",
+			want: newest,
+		},
+		{
+			name:    "Unknown user",
+			ratings: fakeRatingSource{},
+			want:    newest,
+		},
+		{
+			name: "Only dislikes",
+			ratings: fakeRatingSource{profiles: map[int64]*TasteProfile{
+				1: {Ratings: map[int64]float64{4: 0.2}},
+			}},
+			want: newest,
+		},
+		{
+			name: "Rated movies are left out",
+			ratings: fakeRatingSource{profiles: map[int64]*TasteProfile{
+				1: {Ratings: map[int64]float64{1: 1, 5: 0.2}},
+			}},
+			want: []scored{
+				{2, 0.842, []string{"similar to The Matrix"}},
+				{6, 0.346, []string{"similar to The Matrix"}},
+			},
+		},
+		{
+			name: "Seeds weighted by affinity",
+			ratings: fakeRatingSource{profiles: map[int64]*TasteProfile{
+				1: {Ratings: map[int64]float64{1: 0.8}, Watchlist: []int64{3}},
+			}},
+			want: []scored{
+				{2, 0.504, []string{"similar to The Matrix"}},
+				{5, 0.154, []string{"similar to The Matrix"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recommender := NewContentRecommender(testCatalog(), tt.ratings)
+
+			got, err := recommender.Recommend(1, len(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkRecommendations(t, got, tt.want)
+		})
+	}
+}
+
+func TestTitleTokens(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"The Matrix Reloaded", []string{"matrix", "reloaded"}},
+		{"Back to the Future Part II", []string{"back", "future", "ii"}},
+		{"Se7en", []string{"se7en"}},
+		{"A", nil},
+	}
+
+	for _, tt := range tests {
+		if got := titleTokens(tt.title); !slices.Equal(got, tt.want) {
+			t.Errorf("titleTokens(%q) = %q; want %q", tt.title, got, tt.want)
+		}
+	}
+}
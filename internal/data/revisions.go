@@ -0,0 +1,234 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Define constants for the operations recorded in the movie_revisions table.
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionMerge   = "merge"
+	RevisionSubmit  = "submit"
+	RevisionApprove = "approve"
+	RevisionReject  = "reject"
+)
+
+// FieldChange holds the previous and the new value of a single movie field.
+// From is null for inserts and To is null for deletes.
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// MovieRevision represents a single entry in the history of a movie. Each insert, update,
+// delete, restore and merge of a movie, and each step of its moderation, records a revision
+// holding a snapshot of the movie as it was after the operation (or, for deletes, as it was
+// when it was deleted), the user who performed it and the fields that changed. Changes to
+// a movie's alternate titles, releases, external IDs and images bump its version without
+// recording a revision, since revisions only hold the movie's own fields, so the versions
+// of a movie's revisions may have gaps.
+type MovieRevision struct {
+	ID        int64                  `json:"id"`
+	MovieID   int64                  `json:"movie_id"`
+	Version   int32                  `json:"version"`
+	Operation string                 `json:"operation"`
+	UserID    int64                  `json:"user_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Movie     Movie                  `json:"movie"`
+	Diff      map[string]FieldChange `json:"diff"`
+}
+
+// MovieRevisionModel wraps a sql.DB connection pool and provides methods for reading
+// the movie_revisions table. Revisions are written by MovieModel, inside the same
+// transaction as the change they describe.
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+// diffMovies returns the fields that differ between two versions of a movie. A nil
+// before means the movie was inserted, and a nil after means it was deleted.
+func diffMovies(before, after *Movie) map[string]FieldChange {
+	// fields returns the comparable fields of a movie, keyed by their JSON names.
+	fields := func(m *Movie) map[string]any {
+		if m == nil {
+			return map[string]any{"title": nil, "year": nil, "runtime": nil, "genres": nil}
+		}
+		return map[string]any{"title": m.Title, "year": m.Year, "runtime": m.Runtime, "genres": m.Genres}
+	}
+
+	from, to := fields(before), fields(after)
+
+	diff := make(map[string]FieldChange)
+
+	for key := range from {
+		changed := false
+
+		switch f := from[key].(type) {
+		case []string:
+			t, _ := to[key].([]string)
+			changed = to[key] == nil || !slices.Equal(f, t)
+		default:
+			changed = fmt.Sprint(from[key]) != fmt.Sprint(to[key])
+		}
+
+		if changed {
+			diff[key] = FieldChange{From: from[key], To: to[key]}
+		}
+	}
+
+	return diff
+}
+
+// insertRevision records a revision of a movie as part of the given transaction.
+// The snapshot argument is the state of the movie stored with the revision, while
+// before and after are used to compute the diff.
+func insertRevision(ctx context.Context, tx *sql.Tx, operation string, userID int64, snapshot, before, after *Movie, version int32) error {
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, operation, user_id, title, year, runtime, genres, diff)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`
+
+	diff, err := json.Marshal(diffMovies(before, after))
+	if err != nil {
+		return err
+	}
+
+	// Anonymous or unknown users are recorded as a NULL user_id.
+	actor := nullUserID(userID)
+
+	args := []any{
+		snapshot.ID,
+		version,
+		operation,
+		actor,
+		snapshot.Title,
+		snapshot.Year,
+		snapshot.Runtime,
+		pq.Array(snapshot.Genres),
+		diff,
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// scanRevision scans a single movie_revisions row into a MovieRevision. Any leading
+// destinations (such as a window function count) can be passed in extra.
+func scanRevision(row interface{ Scan(...any) error }, extra ...any) (*MovieRevision, error) {
+	var (
+		revision MovieRevision
+		userID   sql.NullInt64
+		diff     []byte
+	)
+
+	dest := append(extra,
+		&revision.ID,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Operation,
+		&userID,
+		&revision.CreatedAt,
+		&revision.Movie.Title,
+		&revision.Movie.Year,
+		&revision.Movie.Runtime,
+		pq.Array(&revision.Movie.Genres),
+		&diff,
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.UserID = userID.Int64
+	revision.Movie.ID = revision.MovieID
+	revision.Movie.Version = revision.Version
+
+	err = json.Unmarshal(diff, &revision.Diff)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// GetAllForMovie returns a page of the revisions recorded for a movie, ordered by
+// version according to the filters.
+func (m MovieRevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, movie_id, version, operation, user_id, created_at, title, year, runtime, genres, diff
+		FROM movie_revisions
+		WHERE movie_id = $1
+		ORDER BY %s
+		LIMIT $2 OFFSET $3
+		`, filters.orderBy(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		revision, err := scanRevision(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// Get returns the revision recorded for a specific version of a movie, or
+// ErrRecordNotFound if there is no such revision.
+func (m MovieRevisionModel) Get(movieID int64, version int32) (*MovieRevision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, movie_id, version, operation, user_id, created_at, title, year, runtime, genres, diff
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	revision, err := scanRevision(m.DB.QueryRowContext(ctx, query, movieID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return revision, nil
+}
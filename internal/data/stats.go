@@ -0,0 +1,260 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"greenlight.tomcat.net/internal/filter"
+)
+
+// StatsGroupSafelist holds the values clients may give for the "group_by" query string
+// parameter of the movie statistics endpoint. "month" groups movies by the month they were
+// added to the catalogue, to show its growth over time.
+var StatsGroupSafelist = []string{"genre", "year", "decade", "month"}
+
+// StatsBucket holds the statistics of a group of movies, such as a genre. AverageRuntime
+// is in minutes, rounded to one decimal place. Cumulative is only set when grouping by
+// month, and counts the movies added up to the end of that month.
+type StatsBucket struct {
+	Key            string  `json:"key"`
+	Count          int     `json:"count"`
+	AverageRuntime float64 `json:"average_runtime"`
+	Cumulative     int     `json:"cumulative,omitempty"`
+}
+
+// MovieStats holds statistics about the published catalogue: the totals over all matching
+// movies and, if a grouping was requested, the statistics of each group. AsOf is set when
+// the statistics were read from the materialized views, and is the time of their last
+// refresh.
+type MovieStats struct {
+	GroupBy        string        `json:"group_by,omitempty"`
+	Count          int           `json:"count"`
+	AverageRuntime float64       `json:"average_runtime"`
+	Groups         []StatsBucket `json:"groups,omitempty"`
+	AsOf           *time.Time    `json:"as_of,omitempty"`
+}
+
+// StatsModel wraps a sql.DB connection pool and computes statistics about the catalogue,
+// either live from the movies table or from the materialized views created by the
+// migrations, which are much cheaper to read but only as fresh as their last refresh.
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// statsQuery holds the SQL used to compute a grouping of the statistics, live and from the
+// materialized views. Both select the group key, the number of movies and their total
+// runtime, with the groups in the order they are returned. The live query contains a
+// single %s verb where movieFilterClause is inserted, so that the statistics are computed
+// over the same movies as the movie list returns.
+type statsQuery struct {
+	live string
+	view string
+}
+
+// statsQueries maps each grouping in StatsGroupSafelist, and the empty string for the
+// totals, to its queries.
+var statsQueries = map[string]statsQuery{
+	"": {
+		live: `
+			SELECT '', count(*), COALESCE(sum(runtime), 0)
+			FROM movies
+			%s
+			`,
+		view: `
+			SELECT '', COALESCE(sum(movies), 0), COALESCE(sum(total_runtime), 0)
+			FROM movie_stats_by_year
+			`,
+	},
+	// genre groups the movies by each of their genres, most common first.
+	"genre": {
+		live: `
+			SELECT genre, count(*), sum(runtime)
+			FROM movies CROSS JOIN LATERAL unnest(genres) AS genre
+			%s
+			GROUP BY genre
+			ORDER BY count(*) DESC, genre ASC
+			`,
+		view: `
+			SELECT genre, movies, total_runtime
+			FROM movie_stats_by_genre
+			ORDER BY movies DESC, genre ASC
+			`,
+	},
+	"year": {
+		live: `
+			SELECT year::text, count(*), sum(runtime)
+			FROM movies
+			%s
+			GROUP BY year
+			ORDER BY year ASC
+			`,
+		view: `
+			SELECT year::text, movies, total_runtime
+			FROM movie_stats_by_year
+			ORDER BY year ASC
+			`,
+	},
+	// decade groups the movies by the decade of their release year (e.g. "1990s").
+	"decade": {
+		live: `
+			SELECT ((year / 10) * 10)::text || 's', count(*), sum(runtime)
+			FROM movies
+			%s
+			GROUP BY (year / 10)
+			ORDER BY (year / 10) ASC
+			`,
+		view: `
+			SELECT ((year / 10) * 10)::text || 's', sum(movies), sum(total_runtime)
+			FROM movie_stats_by_year
+			GROUP BY (year / 10)
+			ORDER BY (year / 10) ASC
+			`,
+	},
+	// month groups the movies by the month they were added to the catalogue (e.g. "2024-05").
+	"month": {
+		live: `
+			SELECT to_char(date_trunc('month', created_at), 'YYYY-MM'), count(*), sum(runtime)
+			FROM movies
+			%s
+			GROUP BY date_trunc('month', created_at)
+			ORDER BY date_trunc('month', created_at) ASC
+			`,
+		view: `
+			SELECT to_char(month, 'YYYY-MM'), movies, total_runtime
+			FROM movie_stats_by_month
+			ORDER BY month ASC
+			`,
+	},
+}
+
+// GetMovieStats computes the statistics of the published movies matching the filter, as
+// MovieModel.GetAll does, grouped as requested (an empty groupBy returns only the totals).
+// If fromViews is true the statistics are read from the materialized views instead, which
+// only hold the whole catalogue, so the filter must be empty. The
+// grouping must be in StatsGroupSafelist; an unknown grouping indicates a programming
+// error and results in a panic.
+func (m StatsModel) GetMovieStats(groupBy string, f filter.Filter, fromViews bool) (*MovieStats, error) {
+	query, ok := statsQueries[groupBy]
+	if !ok {
+		panic("unsafe group_by parameter: " + groupBy)
+	}
+
+	// The totals and the groups are read in the same snapshot, so that they always agree.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where := f.Where(1)
+
+	run := func(q statsQuery) ([]StatsBucket, error) {
+		if fromViews {
+			return queryStatsBuckets(ctx, tx, q.view)
+		}
+		return queryStatsBuckets(ctx, tx, fmt.Sprintf(q.live, movieFilterClause(where)), where.Args...)
+	}
+
+	totals, err := run(statsQueries[""])
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &MovieStats{GroupBy: groupBy, Count: totals[0].Count, AverageRuntime: totals[0].AverageRuntime}
+
+	if groupBy != "" {
+		stats.Groups, err = run(query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if groupBy == "month" {
+		cumulative := 0
+		for i := range stats.Groups {
+			cumulative += stats.Groups[i].Count
+			stats.Groups[i].Cumulative = cumulative
+		}
+	}
+
+	if fromViews {
+		var asOf sql.NullTime
+
+		err = tx.QueryRowContext(ctx, `SELECT max(refreshed_at) FROM movie_stats_by_year`).Scan(&asOf)
+		if err != nil {
+			return nil, err
+		}
+
+		if asOf.Valid {
+			stats.AsOf = &asOf.Time
+		}
+	}
+
+	return stats, nil
+}
+
+// queryStatsBuckets runs one of the statsQueries and reads its buckets.
+func queryStatsBuckets(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]StatsBucket, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Always return an empty slice rather than nil, so that a grouping with no movies is
+	// encoded as [] instead of being left out.
+	buckets := []StatsBucket{}
+
+	for rows.Next() {
+		var bucket StatsBucket
+		var totalRuntime int64
+
+		err := rows.Scan(&bucket.Key, &bucket.Count, &totalRuntime)
+		if err != nil {
+			return nil, err
+		}
+
+		if bucket.Count > 0 {
+			bucket.AverageRuntime = math.Round(float64(totalRuntime)/float64(bucket.Count)*10) / 10
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+// RefreshViews recomputes the materialized views behind GetMovieStats. The views are
+// refreshed concurrently, so that they can still be read while they are being refreshed,
+// and in a single transaction, so that they all hold the catalogue at the same moment.
+func (m StatsModel) RefreshViews() error {
+	// Refreshing recomputes the statistics over the whole catalogue, so it is given a
+	// longer timeout than the queries made while handling requests.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, view := range []string{"movie_stats_by_genre", "movie_stats_by_year", "movie_stats_by_month"} {
+		_, err = tx.ExecContext(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY "+view)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -65,8 +65,7 @@ func generateToken(userID int64, ttl time.Duration, scope string) *Token {
 // Validation check that the plaintext token has been
 // provided and is exactly 26 bytes long
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
-	v.Check(tokenPlaintext != "", "token", "must be provided")
-	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+	v.Apply("token", validator.Required(tokenPlaintext), validator.ExactLength(tokenPlaintext, 26))
 }
 
 // Shortcut which creates a new Token struct and then inserts
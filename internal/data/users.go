@@ -91,22 +91,26 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 // and is not more than 72 bytes long (bcrypt's maximum supported length).
 // The validation results are added to the provided validator instance.
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
-	// Check that password is not empty
-	v.Check(password != "", "password", "must be provided")
-	// Check minimum length requirement (8 bytes)
-	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	// Check maximum length requirement (72 bytes - bcrypt limit)
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Apply("password",
+		// Check that password is not empty
+		validator.Required(password),
+		// Check minimum length requirement (8 bytes)
+		validator.MinLength(password, 8),
+		// Check maximum length requirement (72 bytes - bcrypt limit)
+		validator.MaxLength(password, 72),
+	)
 }
 
 // ValidateEmail checks that an email address meets basic format requirements.
 // It validates that the email is not empty and matches a standard email regex pattern.
 // The validation results are added to the provided validator instance.
 func ValidateEmail(v *validator.Validator, email string) {
-	// Check that email is not empty
-	v.Check(email != "", "email", "must be provided")
-	// Check that email matches the standard email regex pattern
-	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+	v.Apply("email",
+		// Check that email is not empty
+		validator.Required(email),
+		// Check that email matches the standard email regex pattern
+		validator.Pattern(email, validator.EmailRX).WithMessage("email"),
+	)
 }
 
 // ValidateUser performs validation checks on a User struct and adds any validation errors to the validator.
@@ -117,8 +121,7 @@ func ValidateEmail(v *validator.Validator, email string) {
 // - Password hash exists (panics if missing as this indicates a programming error)
 func ValidateUser(v *validator.Validator, user *User) {
 	// Validate name field - must be provided and not exceed 500 bytes
-	v.Check(user.Name != "", "name", "must be provided")
-	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Apply("name", validator.Required(user.Name), validator.MaxLength(user.Name, 500))
 
 	// Validate email using standard email validation
 	ValidateEmail(v, user.Email)
@@ -219,6 +222,46 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// Get retrieves a user record from the database by ID.
+// It returns a pointer to a User struct if found, or ErrRecordNotFound if no matching record exists.
+// Any other database errors are returned as-is.
+func (m UserModel) Get(id int64) (*User, error) {
+	// SQL query to select user fields by ID
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, version
+		FROM users
+		WHERE id = $1
+		`
+
+	// Initialize an empty User struct to hold the result
+	var user User
+
+	// Create a context with a 3-second timeout to prevent long-running database operations
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel() // Ensure resources are released when function exits
+
+	// Execute the query and scan the result into the User struct fields
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 // Update modifies a user record in the database. It updates all fields except ID and CreatedAt,
 // and implements optimistic concurrency control using the version field.
 // Returns ErrDuplicateEmail if the email already exists, ErrEditConflict if the version doesn't match,
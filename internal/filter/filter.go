@@ -0,0 +1,349 @@
+// Package filter parses filter expressions from query strings, such as
+// filter[year][gte]=1990&filter[genres][in]=drama,crime, against a schema of the fields
+// and operators a resource allows, and turns them into parameterized SQL conditions.
+//
+// The SQL of each field comes from its schema, which is written by the model, and every
+// value given by the client is passed to the database as a query argument, so filter
+// expressions can never inject SQL.
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// Operator is a comparison which can be applied to a field, given as the second key of a
+// filter expression (e.g. "gte" in filter[year][gte]=1990).
+type Operator string
+
+const (
+	Eq  Operator = "eq"  // The field equals the value.
+	Ne  Operator = "ne"  // The field doesn't equal the value.
+	Lt  Operator = "lt"  // The field is less than the value.
+	Lte Operator = "lte" // The field is less than or equal to the value.
+	Gt  Operator = "gt"  // The field is greater than the value.
+	Gte Operator = "gte" // The field is greater than or equal to the value.
+	// In takes a comma-separated list of values. A scalar field must equal one of them, and
+	// an array field must hold at least one of them.
+	In Operator = "in"
+	// Contains takes a comma-separated list of values, all of which an array field must hold.
+	Contains Operator = "contains"
+	// Match is a full-text search of a string field for the words of the value.
+	Match Operator = "match"
+)
+
+// Type is the type of a field's values, which decides how the values given by clients are
+// parsed and validated. Time fields can't be filtered with In, since lib/pq can't pass a
+// list of timestamps as an array argument.
+type Type int
+
+const (
+	String      Type = iota // Any non-empty string.
+	Int                     // A whole number.
+	Time                    // An RFC 3339 timestamp, or a date such as 2024-05-01.
+	StringArray             // An array of strings, filtered with In and Contains.
+)
+
+// Field describes a field which can be filtered on.
+type Field struct {
+	// Expr is the SQL expression of the field, usually a column name.
+	Expr string
+	// Type is the type of the field's values.
+	Type Type
+	// Operators are the operators clients may apply to the field. The first is used when a
+	// filter expression doesn't give one (e.g. filter[year]=1994).
+	Operators []Operator
+	// Templates overrides the SQL of some of the operators. Each template is a condition
+	// holding %[1]s verbs where the placeholder of the value is inserted.
+	Templates map[Operator]string
+	// Param is an optional plain query string parameter, kept for clients from before
+	// filter expressions, which is read as a condition with the operator ParamOp.
+	Param   string
+	ParamOp Operator
+}
+
+// Schema maps the names of the fields of a resource to their Field.
+type Schema map[string]Field
+
+// MaxConditions is the largest number of conditions a query string can hold.
+const MaxConditions = 20
+
+// condition is a single parsed filter expression.
+type condition struct {
+	field string
+	op    Operator
+	value any
+}
+
+// Filter holds the conditions parsed from a query string. The zero value has no
+// conditions and matches every row.
+type Filter struct {
+	schema     Schema
+	conditions []condition
+}
+
+// Parse reads the filter expressions in the query string, and the plain parameters of the
+// schema's fields, and checks them against the schema. Problems are recorded in v under
+// the key of the offending parameter (e.g. "filter[year][gte]"), so the returned Filter
+// must only be used if v is valid. Empty plain parameters are ignored, as they always have
+// been.
+func Parse(qs url.Values, schema Schema, v *validator.Validator) Filter {
+	f := Filter{schema: schema}
+
+	// Read the parameters in order, so that the same query string always results in the
+	// same SQL.
+	keys := make([]string, 0, len(qs))
+	for key := range qs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		name, op, ok := parseKey(key)
+		if !ok {
+			continue
+		}
+
+		field, exists := schema[name]
+		if !exists {
+			v.AddErrorCode(key, "filter_unknown_field", nil)
+			continue
+		}
+
+		if op == "" {
+			op = field.Operators[0]
+		}
+
+		if !slices.Contains(field.Operators, op) {
+			v.AddErrorCode(key, "filter_operator", map[string]any{"operator": op})
+			continue
+		}
+
+		for _, raw := range qs[key] {
+			f.add(v, key, name, field, op, raw)
+		}
+	}
+
+	// The plain parameters come after the filter expressions, so that the placeholders of
+	// the expressions don't depend on them.
+	names := make([]string, 0, len(schema))
+	for name, field := range schema {
+		if field.Param != "" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		field := schema[name]
+		if raw := qs.Get(field.Param); raw != "" {
+			f.add(v, field.Param, name, field, field.ParamOp, raw)
+		}
+	}
+
+	v.Apply("filter", validator.MaxItems(f.conditions, MaxConditions).WithMessage("filter_max_conditions"))
+
+	return f
+}
+
+// parseKey splits a query string key such as "filter[year][gte]" into its field name and
+// operator. The operator is empty for keys such as "filter[year]". It reports false for
+// keys which aren't filter expressions.
+func parseKey(key string) (name string, op Operator, ok bool) {
+	rest, found := strings.CutPrefix(key, "filter[")
+	if !found {
+		return "", "", false
+	}
+
+	rest, found = strings.CutSuffix(rest, "]")
+	if !found {
+		return "", "", false
+	}
+
+	name, opName, _ := strings.Cut(rest, "][")
+
+	return name, Operator(opName), true
+}
+
+// add parses the raw value of a condition, and adds the condition if it's valid.
+func (f *Filter) add(v *validator.Validator, key, name string, field Field, op Operator, raw string) {
+	var values []string
+
+	if op == In || op == Contains {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	} else if value := strings.TrimSpace(raw); value != "" {
+		values = append(values, value)
+	}
+
+	if len(values) == 0 {
+		v.AddErrorCode(key, "required", nil)
+		return
+	}
+
+	parsed, ok := parseValues(field.Type, values)
+	if !ok {
+		v.AddErrorCode(key, typeErrors[field.Type], nil)
+		return
+	}
+
+	// Lists of values are passed as a single array argument.
+	var value any
+	switch p := parsed.(type) {
+	case []string:
+		value = p[0]
+		if op == In || op == Contains {
+			value = pq.Array(p)
+		}
+	case []int64:
+		value = p[0]
+		if op == In || op == Contains {
+			value = pq.Array(p)
+		}
+	case []time.Time:
+		value = p[0]
+	}
+
+	f.conditions = append(f.conditions, condition{field: name, op: op, value: value})
+}
+
+// typeErrors holds the validation error code for values which aren't of the field's type.
+var typeErrors = map[Type]string{
+	String:      "filter_type_string",
+	Int:         "filter_type_integer",
+	Time:        "filter_type_time",
+	StringArray: "filter_type_string_list",
+}
+
+// parseValues parses values as the given type, returning them as a slice of that type.
+func parseValues(t Type, values []string) (any, bool) {
+	switch t {
+	case Int:
+		ints := make([]int64, len(values))
+		for i, value := range values {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			ints[i] = n
+		}
+		return ints, true
+	case Time:
+		times := make([]time.Time, len(values))
+		for i, value := range values {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				t, err = time.Parse(time.DateOnly, value)
+				if err != nil {
+					return nil, false
+				}
+			}
+			times[i] = t
+		}
+		return times, true
+	default:
+		return values, true
+	}
+}
+
+// Empty reports whether the filter has no conditions.
+func (f Filter) Empty() bool {
+	return len(f.conditions) == 0
+}
+
+// Clause is the SQL of a filter: a condition joining all of its conditions with AND, which
+// is TRUE for a filter without conditions, and the query arguments it refers to.
+type Clause struct {
+	SQL          string
+	Args         []any
+	placeholders map[string]string
+}
+
+// Placeholder returns the placeholder of the value of the first condition applying op to
+// the field, for queries which use the value elsewhere, such as to rank rows by how well
+// they match a search. It reports false if there is no such condition.
+func (c Clause) Placeholder(field string, op Operator) (string, bool) {
+	placeholder, ok := c.placeholders[field+"."+string(op)]
+	return placeholder, ok
+}
+
+// Where returns the SQL of the filter, numbering its placeholders from $start so that it
+// can be placed in queries which have arguments of their own before it. The queries'
+// later arguments start at $start+len(Args).
+func (f Filter) Where(start int) Clause {
+	clause := Clause{SQL: "TRUE", placeholders: make(map[string]string)}
+
+	var conds []string
+
+	for _, cond := range f.conditions {
+		field := f.schema[cond.field]
+		placeholder := "$" + strconv.Itoa(start+len(clause.Args))
+
+		conds = append(conds, fmt.Sprintf(field.template(cond.op), placeholder))
+		clause.Args = append(clause.Args, cond.value)
+
+		key := cond.field + "." + string(cond.op)
+		if _, ok := clause.placeholders[key]; !ok {
+			clause.placeholders[key] = placeholder
+		}
+	}
+
+	if len(conds) > 0 {
+		clause.SQL = strings.Join(conds, " AND ")
+	}
+
+	return clause
+}
+
+// template returns the SQL template of a condition applying op to the field. A schema
+// allowing an operator which has no SQL for the field's type indicates a programming error
+// and results in a panic.
+func (field Field) template(op Operator) string {
+	if tmpl, ok := field.Templates[op]; ok {
+		return tmpl
+	}
+
+	expr := field.Expr
+
+	switch op {
+	case Eq:
+		return expr + " = %[1]s"
+	case Ne:
+		return expr + " <> %[1]s"
+	case Lt:
+		return expr + " < %[1]s"
+	case Lte:
+		return expr + " <= %[1]s"
+	case Gt:
+		return expr + " > %[1]s"
+	case Gte:
+		return expr + " >= %[1]s"
+	case In:
+		if field.Type == StringArray {
+			return expr + " && %[1]s"
+		}
+		if field.Type != Time {
+			return expr + " = ANY(%[1]s)"
+		}
+	case Contains:
+		if field.Type == StringArray {
+			return expr + " @> %[1]s"
+		}
+	case Match:
+		if field.Type == String {
+			return "to_tsvector('simple', " + expr + ") @@ plainto_tsquery('simple', %[1]s)"
+		}
+	}
+
+	panic(fmt.Sprintf("filter operator %q has no SQL for field %q", op, expr))
+}
@@ -0,0 +1,291 @@
+package filter
+
+import (
+	"database/sql/driver"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// testSchema has a field of every type, a field with a template and fields with plain
+// parameters, like the schemas of the models.
+var testSchema = Schema{
+	"id":   {Expr: "id", Type: Int, Operators: []Operator{Eq, Ne, In}},
+	"year": {Expr: "year", Type: Int, Operators: []Operator{Eq, Ne, Lt, Lte, Gt, Gte, In}},
+	"title": {
+		Expr:      "title",
+		Type:      String,
+		Operators: []Operator{Match, Eq},
+		Param:     "title",
+		ParamOp:   Match,
+	},
+	"genres": {
+		Expr:      "genres",
+		Type:      StringArray,
+		Operators: []Operator{Contains, In},
+		Param:     "genres",
+		ParamOp:   Contains,
+	},
+	"updated_at": {Expr: "updated_at", Type: Time, Operators: []Operator{Gt, Gte, Lt, Lte}},
+	"director": {
+		Expr:      "director_id",
+		Type:      Int,
+		Operators: []Operator{Eq},
+		Templates: map[Operator]string{Eq: "EXISTS (SELECT 1 FROM credits c WHERE c.movie_id = movies.id AND c.person_id = %[1]s)"},
+	},
+}
+
+// parse parses a query string against testSchema, failing the test if it can't be parsed.
+func parse(t *testing.T, query string) (Filter, *validator.Validator) {
+	t.Helper()
+
+	qs, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := validator.New()
+	return Parse(qs, testSchema, v), v
+}
+
+// argValue returns the value a query argument is sent to the database as, so that array
+// arguments can be compared.
+func argValue(t *testing.T, arg any) any {
+	t.Helper()
+
+	if valuer, ok := arg.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	return arg
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{"", "TRUE", nil},
+		{"filter[year][eq]=1994", "year = $1", []any{int64(1994)}},
+		{"filter[year]=1994", "year = $1", []any{int64(1994)}},
+		{"filter[year][ne]=1994", "year <> $1", []any{int64(1994)}},
+		{"filter[year][lt]=1994", "year < $1", []any{int64(1994)}},
+		{"filter[year][lte]=1994", "year <= $1", []any{int64(1994)}},
+		{"filter[year][gt]=1994", "year > $1", []any{int64(1994)}},
+		{"filter[year][gte]=-5", "year >= $1", []any{int64(-5)}},
+		{"filter[year][in]=1994, 1995,,", "year = ANY($1)", []any{"{1994,1995}"}},
+		{"filter[title]=the godfather", "to_tsvector('simple', title) @@ plainto_tsquery('simple', $1)", []any{"the godfather"}},
+		{"filter[title][eq]=Heat", "title = $1", []any{"Heat"}},
+		{"filter[genres]=drama,crime", "genres @> $1", []any{`{"drama","crime"}`}},
+		{"filter[genres][in]=drama", "genres && $1", []any{`{"drama"}`}},
+		{"filter[updated_at][gte]=2024-05-01", "updated_at >= $1", []any{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}},
+		{"filter[updated_at][lt]=2024-05-01T12:30:00Z", "updated_at < $1", []any{time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)}},
+		{"filter[director]=7", "EXISTS (SELECT 1 FROM credits c WHERE c.movie_id = movies.id AND c.person_id = $1)", []any{int64(7)}},
+		// Plain parameters are read after the filter expressions, and keys are read in order.
+		{"title=heat&filter[year][gte]=1990&filter[id][ne]=3", "id <> $1 AND year >= $2 AND to_tsvector('simple', title) @@ plainto_tsquery('simple', $3)", []any{int64(3), int64(1990), "heat"}},
+		{"genres=drama&title=", "genres @> $1", []any{`{"drama"}`}},
+		// A key given more than once adds a condition for each value.
+		{"filter[year][gte]=1990&filter[year][gte]=1995", "year >= $1 AND year >= $2", []any{int64(1990), int64(1995)}},
+		// Other parameters, such as pagination, are ignored.
+		{"page=2&sort=-year&filter=x&filter[year", "TRUE", nil},
+	}
+
+	for _, tt := range tests {
+		f, v := parse(t, tt.query)
+		if !v.Valid() {
+			t.Errorf("%q: got errors %+v", tt.query, v.FieldErrors)
+			continue
+		}
+
+		clause := f.Where(1)
+
+		if clause.SQL != tt.wantSQL {
+			t.Errorf("%q: got SQL %q; want %q", tt.query, clause.SQL, tt.wantSQL)
+		}
+
+		var args []any
+		for _, arg := range clause.Args {
+			args = append(args, argValue(t, arg))
+		}
+		if len(args) != len(tt.wantArgs) {
+			t.Errorf("%q: got args %v; want %v", tt.query, args, tt.wantArgs)
+			continue
+		}
+		for i := range args {
+			if want, ok := tt.wantArgs[i].(time.Time); ok {
+				if got, _ := args[i].(time.Time); !got.Equal(want) {
+					t.Errorf("%q: got arg %d %v; want %v", tt.query, i, args[i], want)
+				}
+				continue
+			}
+			if args[i] != tt.wantArgs[i] {
+				t.Errorf("%q: got arg %d %#v; want %#v", tt.query, i, args[i], tt.wantArgs[i])
+			}
+		}
+
+		if f.Empty() != (len(tt.wantArgs) == 0) {
+			t.Errorf("%q: got Empty %t", tt.query, f.Empty())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		key   string
+		code  string
+	}{
+		{"filter[budget][gt]=1", "filter[budget][gt]", "filter_unknown_field"},
+		{"filter[budget]=1", "filter[budget]", "filter_unknown_field"},
+		{"filter[year][like]=1994", "filter[year][like]", "filter_operator"},
+		{"filter[title][gte]=a", "filter[title][gte]", "filter_operator"},
+		{"filter[updated_at][in]=2024-05-01", "filter[updated_at][in]", "filter_operator"},
+		{"filter[year]=nineteen", "filter[year]", "filter_type_integer"},
+		{"filter[year][in]=1994,x", "filter[year][in]", "filter_type_integer"},
+		{"filter[year]=1994.5", "filter[year]", "filter_type_integer"},
+		{"filter[year]=99999999999999999999", "filter[year]", "filter_type_integer"},
+		{"filter[updated_at][gt]=yesterday", "filter[updated_at][gt]", "filter_type_time"},
+		{"filter[updated_at][gt]=2024-13-01", "filter[updated_at][gt]", "filter_type_time"},
+		{"filter[year]=", "filter[year]", "required"},
+		{"filter[year]=%20", "filter[year]", "required"},
+		{"filter[genres][in]=,,", "filter[genres][in]", "required"},
+		{"filter[year][eq]=1994'", "filter[year][eq]", "filter_type_integer"},
+	}
+
+	for _, tt := range tests {
+		_, v := parse(t, tt.query)
+
+		var codes []string
+		for _, e := range v.FieldErrors {
+			codes = append(codes, e.Field+":"+e.Code)
+		}
+
+		if want := []string{tt.key + ":" + tt.code}; !slices.Equal(codes, want) {
+			t.Errorf("%q: got errors %q; want %q", tt.query, codes, want)
+		}
+	}
+}
+
+func TestParseMaxConditions(t *testing.T) {
+	qs := url.Values{}
+	for range MaxConditions + 1 {
+		qs.Add("filter[year][gte]", "1990")
+	}
+
+	v := validator.New()
+	Parse(qs, testSchema, v)
+
+	if len(v.FieldErrors) != 1 || v.FieldErrors[0].Field != "filter" {
+		t.Errorf("got errors %+v; want one for filter", v.FieldErrors)
+	}
+}
+
+// TestWhereStart checks the numbering of placeholders when the query has arguments of its
+// own: the filter's placeholders start at $start, and the query's later arguments (such as
+// the LIMIT and OFFSET of the movie list) go after them.
+func TestWhereStart(t *testing.T) {
+	f, v := parse(t, "filter[year][gte]=1990&filter[title]=heat&filter[genres][in]=drama")
+	if !v.Valid() {
+		t.Fatalf("got errors %+v", v.FieldErrors)
+	}
+
+	clause := f.Where(3)
+
+	want := "genres && $3 AND to_tsvector('simple', title) @@ plainto_tsquery('simple', $4) AND year >= $5"
+	if clause.SQL != want {
+		t.Errorf("got SQL %q; want %q", clause.SQL, want)
+	}
+
+	// The query's own arguments $1 and $2 come first, and its later ones follow the filter's.
+	args := append([]any{"before1", "before2"}, clause.Args...)
+	args = append(args, 20, 0)
+	next := 3 + len(clause.Args)
+	if next != 6 || len(args) != 7 || args[next-1] != 20 {
+		t.Errorf("got next placeholder $%d for args %v", next, args)
+	}
+
+	if placeholder, ok := clause.Placeholder("title", Match); !ok || placeholder != "$4" {
+		t.Errorf("got title placeholder %q, %t; want $4", placeholder, ok)
+	}
+	if _, ok := clause.Placeholder("title", Eq); ok {
+		t.Error("got a placeholder for a condition the filter doesn't have")
+	}
+}
+
+// TestHostileInput checks that values which look like SQL only ever reach the query as
+// arguments, and that the SQL text is the same whatever the values are.
+func TestHostileInput(t *testing.T) {
+	hostile := []string{
+		`'; DROP TABLE movies;--`,
+		`heat' OR '1'='1`,
+		`") OR TRUE --`,
+		`$1`,
+		`%[1]s`,
+		`\'; SELECT pg_sleep(10);--`,
+	}
+
+	for _, value := range hostile {
+		qs := url.Values{}
+		qs.Set("filter[title]", value)
+		qs.Set("filter[genres][in]", value+",drama")
+		qs.Set("title", value)
+
+		v := validator.New()
+		f := Parse(qs, testSchema, v)
+		if !v.Valid() {
+			t.Fatalf("%q: got errors %+v", value, v.FieldErrors)
+		}
+
+		clause := f.Where(1)
+
+		want := "genres && $1 AND to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) AND to_tsvector('simple', title) @@ plainto_tsquery('simple', $3)"
+		if clause.SQL != want {
+			t.Errorf("%q: got SQL %q; want %q", value, clause.SQL, want)
+		}
+		for _, s := range []string{"DROP", ";", "--", "OR TRUE", "pg_sleep"} {
+			if strings.Contains(clause.SQL, s) {
+				t.Errorf("%q: SQL %q contains %q", value, clause.SQL, s)
+			}
+		}
+
+		if got := clause.Args[1]; got != value {
+			t.Errorf("%q: got title arg %#v", value, got)
+		}
+		if got, ok := clause.Args[0].(*pq.StringArray); !ok || (*got)[0] != value {
+			t.Errorf("%q: got genres arg %#v", value, clause.Args[0])
+		}
+	}
+
+	// Field names and operators come from the key, and are only ever looked up in the
+	// schema, so hostile ones are rejected rather than written into the SQL.
+	for _, key := range []string{"filter[year; DROP TABLE movies][eq]", "filter[year][eq; DROP TABLE movies]", "filter[year) OR (1=1][gt]"} {
+		qs := url.Values{}
+		qs.Set(key, "1")
+
+		v := validator.New()
+		f := Parse(qs, testSchema, v)
+
+		if v.Valid() || !f.Empty() {
+			t.Errorf("%q: got no error", key)
+		}
+	}
+}
+
+func TestTemplatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("got no panic for an operator without SQL")
+		}
+	}()
+
+	Field{Expr: "updated_at", Type: Time}.template(In)
+}
@@ -0,0 +1,143 @@
+package i18n
+
+// english is the English catalog, which holds every message key.
+var english = Catalog{
+	// The titles and details of error responses, keyed by their code.
+	"error.server_error.title":                    "Internal server error",
+	"error.server_error.detail":                   "the server encountered a problem and could not process your request",
+	"error.not_found.title":                       "Resource not found",
+	"error.not_found.detail":                      "the requested resource could not be found",
+	"error.method_not_allowed.title":              "Method not allowed",
+	"error.method_not_allowed.detail":             "the {method} method is not supported for this resource",
+	"error.bad_request.title":                     "Bad request",
+	"error.bad_request.invalid_id_parameter":      "invalid id parameter",
+	"error.bad_request.invalid_version_parameter": "invalid version parameter",
+	"error.bad_request.expected_version_invalid":  "X-Expected-Version header must be a positive integer",
+	"error.bad_request.idempotency_key_too_long":  "Idempotency-Key header must not be more than {max} bytes long",
+	"error.bad_request.body_empty":                "body must not be empty",
+	"error.bad_request.body_too_large":            "body must not be larger than {max} bytes",
+	"error.bad_request.body_malformed_json":       "body contains badly-formed JSON",
+	"error.bad_request.body_malformed_json_at":    "body contains badly-formed JSON (at character {offset})",
+	"error.bad_request.body_json_type_field":      "body contains incorrect JSON type for field \"{field}\"",
+	"error.bad_request.body_json_type_at":         "body contains incorrect JSON type (at character {offset})",
+	"error.bad_request.body_unknown_key":          "body contains unknown key \"{key}\"",
+	"error.bad_request.body_multiple_values":      "body must only contain a single JSON value",
+	"error.bad_request.body_runtime_format":       "body contains a runtime which isn't a string in the format \"<minutes> mins\"",
+	"error.bad_request.body_malformed_multipart":  "body must be a valid multipart form",
+	"error.bad_request.patch_invalid":             "body must be a valid patch document",
+	"error.bad_request.patch_operation_failed":    "operation {index} ({op} \"{path}\") can't be applied",
+	"error.bad_request.csv_header_invalid":        "body must start with a valid CSV header",
+	"error.bad_request.csv_header_unknown_column": "CSV header contains unknown column \"{column}\"",
+	"error.bad_request.csv_header_missing_column": "CSV header must contain a \"{column}\" column",
+	"error.validation_failed.title":               "Validation failed",
+	"error.validation_failed.detail":              "the request contains invalid values, see errors for details",
+	"error.edit_conflict.title":                   "Edit conflict",
+	"error.edit_conflict.detail":                  "unable to update the record due to an edit conflict, please try again",
+	"error.precondition_failed.title":             "Precondition failed",
+	"error.precondition_failed.detail":            "the record has been modified since the version you provided, please fetch it again",
+	"error.patch_test_failed.title":               "Patch test failed",
+	"error.patch_test_failed.detail":              "unable to apply the patch because a test operation failed",
+	"error.invalid_status_transition.title":       "Invalid status transition",
+	"error.invalid_status_transition.detail":      "this action is not allowed while the movie is {status}",
+	"error.unsupported_media_type.title":          "Unsupported media type",
+	"error.unsupported_media_type.detail":         "the \"{media_type}\" media type is not supported for this resource",
+	"error.idempotency_key_mismatch.title":        "Idempotency key mismatch",
+	"error.idempotency_key_mismatch.detail":       "the idempotency key has already been used for a different request",
+	"error.idempotency_key_in_use.title":          "Idempotency key in use",
+	"error.idempotency_key_in_use.detail":         "a request with the same idempotency key is still being processed, please try again later",
+	"error.rate_limit_exceeded.title":             "Rate limit exceeded",
+	"error.rate_limit_exceeded.detail":            "rate limit exceeded",
+	"error.invalid_credentials.title":             "Invalid credentials",
+	"error.invalid_credentials.detail":            "invalid authentication credentials",
+	"error.invalid_authentication_token.title":    "Invalid authentication token",
+	"error.invalid_authentication_token.detail":   "invalid or missing authentication token",
+	"error.authentication_required.title":         "Authentication required",
+	"error.authentication_required.detail":        "you must be authenticated to access this resource",
+	"error.inactive_account.title":                "Inactive account",
+	"error.inactive_account.detail":               "your user account must be activated to access this resource",
+	"error.not_permitted.title":                   "Not permitted",
+	"error.not_permitted.detail":                  "your user account doesn't have the necessary permissions to access this resource",
+	"error.failed_dependency.title":               "Failed dependency",
+	"error.failed_dependency.detail":              "not applied because operation {index} failed",
+
+	// The generic validation rules of package validator.
+	"validation.required":          "must be provided",
+	"validation.min_length":        "must be at least {min} bytes long",
+	"validation.max_length":        "must not be more than {max} bytes long",
+	"validation.exact_length":      "must be {length} bytes long",
+	"validation.min_items":         "must contain at least {min} items",
+	"validation.max_items":         "must not contain more than {max} items",
+	"validation.min":               "must be at least {min}",
+	"validation.max":               "must not be more than {max}",
+	"validation.range":             "must be between {min} and {max}",
+	"validation.pattern":           "must be in the required format",
+	"validation.enum":              "must be one of {values}",
+	"validation.unique":            "must not contain duplicate values",
+	"validation.positive":          "must be a positive integer",
+	"validation.greater_than_zero": "must be greater than zero",
+	"validation.maximum":           "must be a maximum of {max}",
+	"validation.integer":           "must be an integer value",
+	"validation.boolean":           "must be a boolean value",
+	"validation.number":            "must be a number",
+	"validation.string":            "must be a string",
+	"validation.array":             "must be an array",
+	"validation.object":            "must be an object",
+	"validation.unknown_field":     "is not a recognized field",
+
+	// The validation messages of particular fields.
+	"validation.email":                       "must be a valid email address",
+	"validation.email_taken":                 "a user with this email address already exists",
+	"validation.activation_token_invalid":    "invalid or expired activation token",
+	"validation.movie_year_min":              "must be greater than {min}",
+	"validation.movie_year_future":           "must not be in the future",
+	"validation.movie_genres_min":            "must contain at least {min} genre",
+	"validation.movie_genres_max":            "must not contain more than {max} genres",
+	"validation.page_max":                    "must be a maximum of 10 million",
+	"validation.sort_max_keys":               "must not contain more than {max} keys",
+	"validation.sort_invalid":                "invalid sort value",
+	"validation.sort_nulls":                  "nulls_first and nulls_last can only be used with keys which can be empty",
+	"validation.sort_duplicate_keys":         "must not contain duplicate keys",
+	"validation.facet_invalid":               "invalid facet value",
+	"validation.field_invalid":               "invalid field value",
+	"validation.include_invalid":             "invalid include value",
+	"validation.external_id_source":          "must be 1-50 lowercase letters, digits, hyphens or underscores",
+	"validation.external_id_taken":           "is already used by another movie",
+	"validation.image_kind":                  "must be poster or backdrop",
+	"validation.image_type":                  "must be a JPEG, PNG or GIF image",
+	"validation.image_too_small":             "must be at least {min} pixels wide and high",
+	"validation.image_too_large":             "must not be more than {max} pixels wide or high",
+	"validation.image_too_many_pixels":       "must not have more than 25 million pixels",
+	"validation.image_invalid":               "must be a valid image",
+	"validation.image_file_too_large":        "must not be larger than {max} bytes",
+	"validation.country_code":                "must be a two-letter uppercase country code",
+	"validation.date_format":                 "must be a date in the form YYYY-MM-DD",
+	"validation.date_min":                    "must be after {min}",
+	"validation.export_format":               "must be csv, ndjson or json",
+	"validation.batch_op":                    "must be create, update or delete",
+	"validation.batch_id_on_create":          "must not be provided for create",
+	"validation.batch_mode":                  "must be atomic or best_effort",
+	"validation.batch_operations_min":        "must contain at least {min} operation",
+	"validation.batch_operations_max":        "must not contain more than {max} operations",
+	"validation.import_mode":                 "must be insert or upsert",
+	"validation.import_csv_record":           "must be a valid CSV record",
+	"validation.import_field_count":          "must have the same number of fields as the header",
+	"validation.import_json_object":          "must be a single valid JSON object",
+	"validation.import_runtime":              "must be an integer number of minutes",
+	"validation.import_external_key_taken":   "a movie with this external key already exists",
+	"validation.import_external_key_trashed": "matches a movie which is in the trash",
+	"validation.runtime_format":              "must be a string in the format \"<minutes> mins\"",
+	"validation.stats_group_by":              "must be genre, year, decade or month",
+	"validation.movie_status":                "must be draft, pending, published or rejected",
+	"validation.movie_status_new":            "must be draft, pending or published",
+	"validation.movie_status_unpublished":    "must be draft or pending",
+	"validation.locale":                      "must be a language (such as fr), a language and region (such as pt-BR) or a region (such as CA)",
+	"validation.duplicate_same_movie":        "must not be the same movie",
+	"validation.sync_token":                  "must be a token returned by an earlier request",
+	"validation.filter_unknown_field":        "unknown filter field",
+	"validation.filter_operator":             "operator \"{operator}\" can't be used with this field",
+	"validation.filter_max_conditions":       "must not contain more than {max} conditions",
+	"validation.filter_type_string":          "must be a string",
+	"validation.filter_type_integer":         "must be an integer",
+	"validation.filter_type_time":            "must be an RFC 3339 timestamp or a date",
+	"validation.filter_type_string_list":     "must be a list of strings",
+}
@@ -0,0 +1,140 @@
+package i18n
+
+// french is the French catalog.
+var french = Catalog{
+	"error.server_error.title":                    "Erreur interne du serveur",
+	"error.server_error.detail":                   "le serveur a rencontré un problème et n'a pas pu traiter votre requête",
+	"error.not_found.title":                       "Ressource introuvable",
+	"error.not_found.detail":                      "la ressource demandée est introuvable",
+	"error.method_not_allowed.title":              "Méthode non autorisée",
+	"error.method_not_allowed.detail":             "la méthode {method} n'est pas prise en charge pour cette ressource",
+	"error.bad_request.title":                     "Requête invalide",
+	"error.bad_request.invalid_id_parameter":      "paramètre id invalide",
+	"error.bad_request.invalid_version_parameter": "paramètre version invalide",
+	"error.bad_request.expected_version_invalid":  "l'en-tête X-Expected-Version doit être un entier positif",
+	"error.bad_request.idempotency_key_too_long":  "l'en-tête Idempotency-Key ne doit pas dépasser {max} octets",
+	"error.bad_request.body_empty":                "le corps ne doit pas être vide",
+	"error.bad_request.body_too_large":            "le corps ne doit pas dépasser {max} octets",
+	"error.bad_request.body_malformed_json":       "le corps contient du JSON mal formé",
+	"error.bad_request.body_malformed_json_at":    "le corps contient du JSON mal formé (au caractère {offset})",
+	"error.bad_request.body_json_type_field":      "le corps contient un type JSON incorrect pour le champ « {field} »",
+	"error.bad_request.body_json_type_at":         "le corps contient un type JSON incorrect (au caractère {offset})",
+	"error.bad_request.body_unknown_key":          "le corps contient la clé inconnue « {key} »",
+	"error.bad_request.body_multiple_values":      "le corps ne doit contenir qu'une seule valeur JSON",
+	"error.bad_request.body_runtime_format":       "le corps contient une durée qui n'est pas une chaîne au format « <minutes> mins »",
+	"error.bad_request.body_malformed_multipart":  "le corps doit être un formulaire multipart valide",
+	"error.bad_request.patch_invalid":             "le corps doit être un document de correctif valide",
+	"error.bad_request.patch_operation_failed":    "l'opération {index} ({op} « {path} ») ne peut pas être appliquée",
+	"error.bad_request.csv_header_invalid":        "le corps doit commencer par un en-tête CSV valide",
+	"error.bad_request.csv_header_unknown_column": "l'en-tête CSV contient la colonne inconnue « {column} »",
+	"error.bad_request.csv_header_missing_column": "l'en-tête CSV doit contenir une colonne « {column} »",
+	"error.validation_failed.title":               "Échec de la validation",
+	"error.validation_failed.detail":              "la requête contient des valeurs invalides, voir errors pour plus de détails",
+	"error.edit_conflict.title":                   "Conflit de modification",
+	"error.edit_conflict.detail":                  "impossible de mettre à jour l'enregistrement à cause d'un conflit de modification, veuillez réessayer",
+	"error.precondition_failed.title":             "Échec de la précondition",
+	"error.precondition_failed.detail":            "l'enregistrement a été modifié depuis la version fournie, veuillez le récupérer à nouveau",
+	"error.patch_test_failed.title":               "Échec du test du correctif",
+	"error.patch_test_failed.detail":              "impossible d'appliquer le correctif car une opération test a échoué",
+	"error.invalid_status_transition.title":       "Changement de statut invalide",
+	"error.invalid_status_transition.detail":      "cette action n'est pas autorisée tant que le film est {status}",
+	"error.unsupported_media_type.title":          "Type de média non pris en charge",
+	"error.unsupported_media_type.detail":         "le type de média « {media_type} » n'est pas pris en charge pour cette ressource",
+	"error.idempotency_key_mismatch.title":        "Clé d'idempotence incohérente",
+	"error.idempotency_key_mismatch.detail":       "la clé d'idempotence a déjà été utilisée pour une autre requête",
+	"error.idempotency_key_in_use.title":          "Clé d'idempotence en cours d'utilisation",
+	"error.idempotency_key_in_use.detail":         "une requête avec la même clé d'idempotence est toujours en cours de traitement, veuillez réessayer plus tard",
+	"error.rate_limit_exceeded.title":             "Limite de débit dépassée",
+	"error.rate_limit_exceeded.detail":            "limite de débit dépassée",
+	"error.invalid_credentials.title":             "Identifiants invalides",
+	"error.invalid_credentials.detail":            "identifiants d'authentification invalides",
+	"error.invalid_authentication_token.title":    "Jeton d'authentification invalide",
+	"error.invalid_authentication_token.detail":   "jeton d'authentification invalide ou manquant",
+	"error.authentication_required.title":         "Authentification requise",
+	"error.authentication_required.detail":        "vous devez être authentifié pour accéder à cette ressource",
+	"error.inactive_account.title":                "Compte inactif",
+	"error.inactive_account.detail":               "votre compte utilisateur doit être activé pour accéder à cette ressource",
+	"error.not_permitted.title":                   "Non autorisé",
+	"error.not_permitted.detail":                  "votre compte utilisateur n'a pas les autorisations nécessaires pour accéder à cette ressource",
+	"error.failed_dependency.title":               "Dépendance échouée",
+	"error.failed_dependency.detail":              "non appliquée car l'opération {index} a échoué",
+
+	"validation.required":          "doit être renseigné",
+	"validation.min_length":        "doit faire au moins {min} octets",
+	"validation.max_length":        "ne doit pas dépasser {max} octets",
+	"validation.exact_length":      "doit faire {length} octets",
+	"validation.min_items":         "doit contenir au moins {min} éléments",
+	"validation.max_items":         "ne doit pas contenir plus de {max} éléments",
+	"validation.min":               "doit être au moins {min}",
+	"validation.max":               "ne doit pas dépasser {max}",
+	"validation.range":             "doit être compris entre {min} et {max}",
+	"validation.pattern":           "n'est pas au format requis",
+	"validation.enum":              "doit être l'une des valeurs suivantes : {values}",
+	"validation.unique":            "ne doit pas contenir de doublons",
+	"validation.positive":          "doit être un entier positif",
+	"validation.greater_than_zero": "doit être supérieur à zéro",
+	"validation.maximum":           "doit être au maximum {max}",
+	"validation.integer":           "doit être un nombre entier",
+	"validation.boolean":           "doit être un booléen",
+	"validation.number":            "doit être un nombre",
+	"validation.string":            "doit être une chaîne de caractères",
+	"validation.array":             "doit être un tableau",
+	"validation.object":            "doit être un objet",
+	"validation.unknown_field":     "n'est pas un champ reconnu",
+
+	"validation.email":                       "doit être une adresse e-mail valide",
+	"validation.email_taken":                 "un utilisateur avec cette adresse e-mail existe déjà",
+	"validation.activation_token_invalid":    "jeton d'activation invalide ou expiré",
+	"validation.movie_year_min":              "doit être supérieure à {min}",
+	"validation.movie_year_future":           "ne doit pas être dans le futur",
+	"validation.movie_genres_min":            "doit contenir au moins {min} genre",
+	"validation.movie_genres_max":            "ne doit pas contenir plus de {max} genres",
+	"validation.page_max":                    "doit être au maximum 10 millions",
+	"validation.sort_max_keys":               "ne doit pas contenir plus de {max} clés",
+	"validation.sort_invalid":                "valeur de tri invalide",
+	"validation.sort_nulls":                  "nulls_first et nulls_last ne peuvent être utilisés qu'avec des clés qui peuvent être vides",
+	"validation.sort_duplicate_keys":         "ne doit pas contenir de clés en double",
+	"validation.facet_invalid":               "valeur de facette invalide",
+	"validation.field_invalid":               "valeur de champ invalide",
+	"validation.include_invalid":             "valeur d'inclusion invalide",
+	"validation.external_id_source":          "doit contenir de 1 à 50 lettres minuscules, chiffres, tirets ou tirets bas",
+	"validation.external_id_taken":           "est déjà utilisé par un autre film",
+	"validation.image_kind":                  "doit être poster ou backdrop",
+	"validation.image_type":                  "doit être une image JPEG, PNG ou GIF",
+	"validation.image_too_small":             "doit faire au moins {min} pixels de large et de haut",
+	"validation.image_too_large":             "ne doit pas dépasser {max} pixels de large ou de haut",
+	"validation.image_too_many_pixels":       "ne doit pas dépasser 25 millions de pixels",
+	"validation.image_invalid":               "doit être une image valide",
+	"validation.image_file_too_large":        "ne doit pas dépasser {max} octets",
+	"validation.country_code":                "doit être un code pays de deux lettres majuscules",
+	"validation.date_format":                 "doit être une date au format AAAA-MM-JJ",
+	"validation.date_min":                    "doit être postérieure à {min}",
+	"validation.export_format":               "doit être csv, ndjson ou json",
+	"validation.batch_op":                    "doit être create, update ou delete",
+	"validation.batch_id_on_create":          "ne doit pas être renseigné pour create",
+	"validation.batch_mode":                  "doit être atomic ou best_effort",
+	"validation.batch_operations_min":        "doit contenir au moins {min} opération",
+	"validation.batch_operations_max":        "ne doit pas contenir plus de {max} opérations",
+	"validation.import_mode":                 "doit être insert ou upsert",
+	"validation.import_csv_record":           "doit être un enregistrement CSV valide",
+	"validation.import_field_count":          "doit avoir le même nombre de champs que l'en-tête",
+	"validation.import_json_object":          "doit être un unique objet JSON valide",
+	"validation.import_runtime":              "doit être un nombre entier de minutes",
+	"validation.import_external_key_taken":   "un film avec cette clé externe existe déjà",
+	"validation.import_external_key_trashed": "correspond à un film qui est dans la corbeille",
+	"validation.runtime_format":              "doit être une chaîne au format \"<minutes> mins\"",
+	"validation.stats_group_by":              "doit être genre, year, decade ou month",
+	"validation.movie_status":                "doit être draft, pending, published ou rejected",
+	"validation.movie_status_new":            "doit être draft, pending ou published",
+	"validation.movie_status_unpublished":    "doit être draft ou pending",
+	"validation.locale":                      "doit être une langue (comme fr), une langue et une région (comme pt-BR) ou une région (comme CA)",
+	"validation.duplicate_same_movie":        "ne doit pas être le même film",
+	"validation.sync_token":                  "doit être un jeton renvoyé par une requête précédente",
+	"validation.filter_unknown_field":        "champ de filtre inconnu",
+	"validation.filter_operator":             "l'opérateur « {operator} » ne peut pas être utilisé avec ce champ",
+	"validation.filter_max_conditions":       "ne doit pas contenir plus de {max} conditions",
+	"validation.filter_type_string":          "doit être une chaîne de caractères",
+	"validation.filter_type_integer":         "doit être un nombre entier",
+	"validation.filter_type_time":            "doit être un horodatage RFC 3339 ou une date",
+	"validation.filter_type_string_list":     "doit être une liste de chaînes de caractères",
+}
@@ -0,0 +1,138 @@
+// Package i18n holds the message catalogs used to translate the API's error and validation
+// messages, and chooses the locale to translate them into from the client's preferences.
+//
+// Messages are keyed by a stable code, such as "error.not_found.detail" or
+// "validation.max_length", rather than by their English text. They may contain {name}
+// placeholders which are replaced by parameters, as in "must not be more than {max} bytes
+// long". English is the default locale and its catalog is the source of truth: every other
+// catalog should hold the same keys, and messages missing from one fall back to English.
+package i18n
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// DefaultLocale is the locale messages are sent in when the client asks for none of the
+// supported locales.
+const DefaultLocale = "en"
+
+// Catalog maps message keys to message templates.
+type Catalog map[string]string
+
+// catalogs maps each supported locale to its catalog.
+var catalogs = map[string]Catalog{
+	"en": english,
+	"fr": french,
+}
+
+// Locales returns the supported locales, in alphabetical order.
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+
+	return locales
+}
+
+// Match returns the supported locale which best matches the client's preferred locales,
+// which are given most preferred first, such as ["fr-CA", "en"]. A locale matches if it
+// is supported itself or if its language is (so "fr-CA" matches "fr"). It returns
+// DefaultLocale if none of the preferred locales match.
+func Match(preferred []string) string {
+	for _, locale := range preferred {
+		if _, ok := catalogs[locale]; ok {
+			return locale
+		}
+
+		language, _, _ := strings.Cut(locale, "-")
+		if _, ok := catalogs[strings.ToLower(language)]; ok {
+			return strings.ToLower(language)
+		}
+	}
+
+	return DefaultLocale
+}
+
+// Has reports whether the English catalog holds the key.
+func Has(key string) bool {
+	_, ok := english[key]
+	return ok
+}
+
+// Translate returns the message with the given key in the locale, with its placeholders
+// replaced by the parameters. Messages missing from the locale's catalog are taken from
+// the English catalog, and keys missing from that too are returned as they are.
+func Translate(locale, key string, params map[string]any) string {
+	template, ok := catalogs[locale][key]
+	if !ok {
+		template, ok = english[key]
+		if !ok {
+			return key
+		}
+	}
+
+	return format(template, params)
+}
+
+// format replaces each {name} placeholder of the template with the parameter of that name.
+// Lists are written as comma-separated values.
+func format(template string, params map[string]any) string {
+	if len(params) == 0 {
+		return template
+	}
+
+	pairs := make([]string, 0, len(params)*2)
+
+	for name, value := range params {
+		text := fmt.Sprint(value)
+
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice {
+			items := make([]string, rv.Len())
+			for i := range items {
+				items[i] = fmt.Sprint(rv.Index(i).Interface())
+			}
+			text = strings.Join(items, ", ")
+		}
+
+		pairs = append(pairs, "{"+name+"}", text)
+	}
+
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// Missing returns the keys of the English catalog which are missing from each of the other
+// catalogs, and the keys of other catalogs which the English catalog doesn't have, by
+// locale. It returns an empty map when every catalog is complete.
+func Missing() map[string][]string {
+	missing := make(map[string][]string)
+
+	for locale, catalog := range catalogs {
+		if locale == DefaultLocale {
+			continue
+		}
+
+		for key := range english {
+			if _, ok := catalog[key]; !ok {
+				missing[locale] = append(missing[locale], key)
+			}
+		}
+
+		for key := range catalog {
+			if _, ok := english[key]; !ok {
+				missing[DefaultLocale] = append(missing[DefaultLocale], key)
+			}
+		}
+	}
+
+	for locale := range missing {
+		slices.Sort(missing[locale])
+		missing[locale] = slices.Compact(missing[locale])
+	}
+
+	return missing
+}
@@ -0,0 +1,78 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// TestCatalogsComplete fails if any catalog is missing a key of the English catalog, or
+// holds a key which the English catalog doesn't.
+func TestCatalogsComplete(t *testing.T) {
+	for locale, keys := range Missing() {
+		for _, key := range keys {
+			t.Errorf("%s catalog is missing %q", locale, key)
+		}
+	}
+}
+
+// TestCatalogPlaceholders fails if a translation uses different placeholders from the
+// English message, which would leave a placeholder unreplaced or drop a parameter.
+func TestCatalogPlaceholders(t *testing.T) {
+	placeholderRX := regexp.MustCompile(`\{[a-z_]+\}`)
+
+	placeholders := func(message string) []string {
+		found := placeholderRX.FindAllString(message, -1)
+		slices.Sort(found)
+		return slices.Compact(found)
+	}
+
+	for locale, catalog := range catalogs {
+		for key, message := range catalog {
+			want := placeholders(english[key])
+			if got := placeholders(message); !slices.Equal(got, want) {
+				t.Errorf("%s %q: got placeholders %v; want %v", locale, key, got, want)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		preferred []string
+		want      string
+	}{
+		{nil, "en"},
+		{[]string{"fr"}, "fr"},
+		{[]string{"fr-CA", "en"}, "fr"},
+		{[]string{"FR-ca"}, "fr"},
+		{[]string{"de", "fr"}, "fr"},
+		{[]string{"de"}, "en"},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.preferred); got != tt.want {
+			t.Errorf("Match(%q) = %q; want %q", tt.preferred, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		locale string
+		key    string
+		params map[string]any
+		want   string
+	}{
+		{"en", "validation.max_length", map[string]any{"max": 500}, "must not be more than 500 bytes long"},
+		{"fr", "validation.integer", nil, "doit être un nombre entier"},
+		{"de", "validation.integer", nil, "must be an integer value"},
+		{"en", "validation.no_such_key", nil, "validation.no_such_key"},
+	}
+
+	for _, tt := range tests {
+		if got := Translate(tt.locale, tt.key, tt.params); got != tt.want {
+			t.Errorf("Translate(%q, %q) = %q; want %q", tt.locale, tt.key, got, tt.want)
+		}
+	}
+}
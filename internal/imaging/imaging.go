@@ -0,0 +1,152 @@
+// Package imaging inspects uploaded images and makes resized copies of them, using only the
+// decoders and encoders of the standard library. JPEG, PNG and GIF images are supported.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // Register the GIF decoder with image.Decode and image.DecodeConfig.
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// The content types of the supported image formats.
+const (
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypePNG  = "image/png"
+	ContentTypeGIF  = "image/gif"
+)
+
+// ErrUnsupportedFormat is returned for data which isn't a JPEG, PNG or GIF image.
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// Info describes an image without decoding its pixels.
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Inspect sniffs the content type of data from its first bytes, ignoring any type the
+// client claimed for it, and reads the image's dimensions from its header. Decoding the
+// header alone means that the dimensions can be checked before committing the memory
+// needed to decode the whole image.
+func Inspect(data []byte) (Info, error) {
+	contentType := http.DetectContentType(data)
+
+	switch contentType {
+	case ContentTypeJPEG, ContentTypePNG, ContentTypeGIF:
+	default:
+		return Info{}, ErrUnsupportedFormat
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{ContentType: contentType, Width: config.Width, Height: config.Height}, nil
+}
+
+// Extension returns the file extension, including the leading dot, used for images of the
+// given content type.
+func Extension(contentType string) string {
+	switch contentType {
+	case ContentTypePNG:
+		return ".png"
+	case ContentTypeGIF:
+		return ".gif"
+	default:
+		return ".jpg"
+	}
+}
+
+// Resized is an encoded copy of an image made by Resize.
+type Resized struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Decode decodes a whole image, which should already have been checked with Inspect. Only
+// the first frame of an animated GIF is decoded.
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Resize scales img down to the given width, keeping its aspect ratio, and encodes the
+// result. Images which are already no wider than width are encoded at their own size
+// rather than enlarged. PNG and GIF images are encoded as PNG, keeping any transparency,
+// and JPEG images as JPEG.
+func Resize(img image.Image, contentType string, width int) (*Resized, error) {
+	bounds := img.Bounds()
+
+	width = max(min(width, bounds.Dx()), 1)
+	height := max(bounds.Dy()*width/max(bounds.Dx(), 1), 1)
+
+	resized := boxResize(img, width, height)
+
+	var buf bytes.Buffer
+	var err error
+
+	switch contentType {
+	case ContentTypePNG, ContentTypeGIF:
+		contentType = ContentTypePNG
+		err = png.Encode(&buf, resized)
+	default:
+		contentType = ContentTypeJPEG
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resized{Data: buf.Bytes(), ContentType: contentType, Width: width, Height: height}, nil
+}
+
+// boxResize scales img to width x height by averaging the source pixels covered by each
+// destination pixel. It is only used to shrink images, where it gives good results with
+// little code. The source is first drawn into an RGBA image so that the averaging can work
+// on the premultiplied pixel bytes directly, rather than through the slow At method.
+func boxResize(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+					a += uint64(row[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
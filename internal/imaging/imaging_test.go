@@ -0,0 +1,159 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage returns a width x height image whose left half is red and right half blue.
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encode(t *testing.T, contentType string, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var err error
+
+	switch contentType {
+	case ContentTypeJPEG:
+		err = jpeg.Encode(&buf, img, nil)
+	case ContentTypePNG:
+		err = png.Encode(&buf, img)
+	case ContentTypeGIF:
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	for _, contentType := range []string{ContentTypeJPEG, ContentTypePNG, ContentTypeGIF} {
+		info, err := Inspect(encode(t, contentType, testImage(40, 30)))
+		if err != nil {
+			t.Errorf("%s: %v", contentType, err)
+			continue
+		}
+
+		want := Info{ContentType: contentType, Width: 40, Height: 30}
+		if info != want {
+			t.Errorf("got %+v; want %+v", info, want)
+		}
+	}
+}
+
+func TestInspectUnsupported(t *testing.T) {
+	tests := map[string][]byte{
+		"text":  []byte("not an image"),
+		"empty": nil,
+		"svg":   []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`),
+		"webp":  []byte("RIFF\x00\x00\x00\x00WEBPVP8 "),
+	}
+
+	for name, data := range tests {
+		if _, err := Inspect(data); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("%s: got %v; want ErrUnsupportedFormat", name, err)
+		}
+	}
+
+	// A PNG signature followed by garbage is sniffed as a PNG, but its header can't be read.
+	truncated := encode(t, ContentTypePNG, testImage(4, 4))[:12]
+	if _, err := Inspect(truncated); err == nil {
+		t.Error("truncated PNG: got no error")
+	}
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentType     string
+		width, height   int
+		resizeTo        int
+		wantContentType string
+		wantWidth       int
+		wantHeight      int
+	}{
+		{"jpeg", ContentTypeJPEG, 400, 300, 200, ContentTypeJPEG, 200, 150},
+		{"png", ContentTypePNG, 400, 300, 100, ContentTypePNG, 100, 75},
+		{"gif as png", ContentTypeGIF, 400, 300, 100, ContentTypePNG, 100, 75},
+		{"not enlarged", ContentTypePNG, 80, 60, 200, ContentTypePNG, 80, 60},
+		{"very wide", ContentTypePNG, 1000, 2, 10, ContentTypePNG, 10, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Decode(encode(t, tt.contentType, testImage(tt.width, tt.height)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resized, err := Resize(img, tt.contentType, tt.resizeTo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resized.ContentType != tt.wantContentType || resized.Width != tt.wantWidth || resized.Height != tt.wantHeight {
+				t.Errorf("got %s %dx%d; want %s %dx%d", resized.ContentType, resized.Width, resized.Height,
+					tt.wantContentType, tt.wantWidth, tt.wantHeight)
+			}
+
+			// The encoded image must match what Resize reports.
+			info, err := Inspect(resized.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.ContentType != resized.ContentType || info.Width != resized.Width || info.Height != resized.Height {
+				t.Errorf("encoded image is %+v; Resize reported %s %dx%d", info, resized.ContentType, resized.Width, resized.Height)
+			}
+		})
+	}
+}
+
+func TestBoxResize(t *testing.T) {
+	// Each destination pixel averages a 2x2 block of source pixels.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	src.Set(0, 0, color.RGBA{R: 200, A: 255})
+	src.Set(1, 0, color.RGBA{R: 100, A: 255})
+	src.Set(0, 1, color.RGBA{R: 0, A: 255})
+	src.Set(1, 1, color.RGBA{R: 100, A: 255})
+	for y := 0; y < 2; y++ {
+		for x := 2; x < 4; x++ {
+			src.Set(x, y, color.RGBA{B: 40, A: 255})
+		}
+	}
+
+	dst := boxResize(src, 2, 1)
+
+	if got, want := dst.RGBAAt(0, 0), (color.RGBA{R: 100, A: 255}); got != want {
+		t.Errorf("left pixel: got %v; want %v", got, want)
+	}
+	if got, want := dst.RGBAAt(1, 0), (color.RGBA{B: 40, A: 255}); got != want {
+		t.Errorf("right pixel: got %v; want %v", got, want)
+	}
+
+	// Images whose bounds don't start at the origin are resized from their bounds.
+	offset := testImage(8, 8).SubImage(image.Rect(4, 0, 8, 8)).(*image.RGBA)
+	if got, want := boxResize(offset, 2, 4).RGBAAt(0, 0), (color.RGBA{B: 255, A: 255}); got != want {
+		t.Errorf("sub-image: got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,591 @@
+// Package openapi reads the API's OpenAPI 3.1 document and checks requests against it: that
+// their query string parameters and JSON bodies match the schemas of the operation they are
+// sent to. It also lists the operations of the document, so that the routes a server
+// registers can be compared with the routes the document describes.
+//
+// Only the parts of OpenAPI and JSON Schema which the document uses are supported: the
+// type (a single type or a list of them, such as ["string", "null"]), properties,
+// required, additionalProperties, items, enum, minimum, maximum,
+// minLength, maxLength, minItems, maxItems, uniqueItems and pattern keywords, and $ref to
+// the document's components. As in the validator package, lengths are counted in bytes.
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"greenlight.tomcat.net/internal/validator"
+)
+
+// Document is an OpenAPI document. Only the members which are used to check requests are
+// decoded; everything else is kept in the original JSON only.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// PathItem maps the lowercase HTTP methods of a path to their operations.
+type PathItem map[string]*Operation
+
+// Operation is a single API operation: a method on a path.
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []Parameter  `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+// Parameter is a parameter of an operation. Only query parameters are checked, and of
+// those only the ones with the default "form" style: deepObject parameters, such as the
+// filter expressions of the movie endpoints, are left to the handlers.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Style    string  `json:"style"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody is the request body of an operation, keyed by media type.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// MediaType holds the schema of a request body in one media type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Types is the type keyword of a schema, which is either a single type or a list of them.
+type Types []string
+
+// UnmarshalJSON decodes both forms of the type keyword.
+func (t *Types) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.New("type must be a string or a list of strings")
+	}
+
+	*t = list
+	return nil
+}
+
+// Schema is a JSON Schema. Ref is resolved by Load, after which the schema it names is
+// used in its place. A schema can also be the boolean true, which allows any value, or
+// false, which allows none and is used for additionalProperties.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 Types              `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *Schema            `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	UniqueItems          bool               `json:"uniqueItems"`
+	Pattern              string             `json:"pattern"`
+
+	pattern  *regexp.Regexp
+	resolved bool
+	never    bool
+}
+
+// UnmarshalJSON decodes a schema, which is either an object or a boolean.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	var allow bool
+	if err := json.Unmarshal(b, &allow); err == nil {
+		*s = Schema{never: !allow}
+		return nil
+	}
+
+	// Decode the object with a type which doesn't have this method.
+	type schema Schema
+	return json.Unmarshal(b, (*schema)(s))
+}
+
+// Route is an operation's method and path, such as GET /v1/movies/{id}.
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Path
+}
+
+// Load decodes an OpenAPI document, resolves the $refs of its schemas and compiles their
+// patterns.
+func Load(js []byte) (*Document, error) {
+	var doc Document
+
+	err := json.Unmarshal(js, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.1") {
+		return nil, fmt.Errorf("openapi: unsupported version %q", doc.OpenAPI)
+	}
+
+	for name, schema := range doc.Components.Schemas {
+		if err := doc.resolve(schema); err != nil {
+			return nil, fmt.Errorf("openapi: components.schemas.%s: %w", name, err)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			for i := range op.Parameters {
+				schema, err := doc.resolveRef(op.Parameters[i].Schema)
+				if err != nil {
+					return nil, fmt.Errorf("openapi: %s %s: %w", method, path, err)
+				}
+				op.Parameters[i].Schema = schema
+			}
+
+			if op.RequestBody == nil {
+				continue
+			}
+
+			for mediaType, content := range op.RequestBody.Content {
+				schema, err := doc.resolveRef(content.Schema)
+				if err != nil {
+					return nil, fmt.Errorf("openapi: %s %s: %w", method, path, err)
+				}
+				op.RequestBody.Content[mediaType] = MediaType{Schema: schema}
+			}
+		}
+	}
+
+	return &doc, nil
+}
+
+// resolve replaces the $refs in the subschemas of a schema with the schemas they name, and
+// compiles its pattern. Each schema is only resolved once, so schemas which refer to
+// themselves are allowed.
+func (d *Document) resolve(schema *Schema) error {
+	if schema == nil || schema.resolved {
+		return nil
+	}
+	schema.resolved = true
+
+	if schema.Pattern != "" {
+		rx, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+		schema.pattern = rx
+	}
+
+	for name, property := range schema.Properties {
+		resolved, err := d.resolveRef(property)
+		if err != nil {
+			return err
+		}
+		schema.Properties[name] = resolved
+	}
+
+	if schema.Items != nil {
+		resolved, err := d.resolveRef(schema.Items)
+		if err != nil {
+			return err
+		}
+		schema.Items = resolved
+	}
+
+	if schema.AdditionalProperties != nil {
+		resolved, err := d.resolveRef(schema.AdditionalProperties)
+		if err != nil {
+			return err
+		}
+		schema.AdditionalProperties = resolved
+	}
+
+	return nil
+}
+
+// resolveRef returns the schema a $ref names, or the schema itself if it isn't a $ref,
+// after resolving it. Only references to the document's components
+// (#/components/schemas/Name) are supported.
+func (d *Document) resolveRef(schema *Schema) (*Schema, error) {
+	if schema != nil && schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+		if !ok {
+			return nil, fmt.Errorf("unsupported $ref %q", schema.Ref)
+		}
+
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown $ref %q", schema.Ref)
+		}
+
+		schema = resolved
+	}
+
+	return schema, d.resolve(schema)
+}
+
+// Routes returns the method and path of every operation in the document, sorted by path
+// and then method.
+func (d *Document) Routes() []Route {
+	var routes []Route
+
+	for path, item := range d.Paths {
+		for method := range item {
+			routes = append(routes, Route{Method: strings.ToUpper(method), Path: path})
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+// Missing returns the routes which aren't described by any operation of the document. A
+// route is described by an operation with the same method whose path it would serve, so
+// a route with a parameter, such as POST /v1/movies/{id}, is also described by operations
+// for paths with a fixed value in its place, such as POST /v1/movies/batch.
+func (d *Document) Missing(routes []Route) []Route {
+	var missing []Route
+
+	for _, route := range routes {
+		template := strings.Split(strings.Trim(route.Path, "/"), "/")
+
+		described := false
+		for path, item := range d.Paths {
+			if _, ok := item[strings.ToLower(route.Method)]; !ok {
+				continue
+			}
+			if _, ok := match(template, strings.Split(strings.Trim(path, "/"), "/")); ok {
+				described = true
+				break
+			}
+		}
+
+		if !described {
+			missing = append(missing, route)
+		}
+	}
+
+	return missing
+}
+
+// Find returns the operation which a request with the given method and path is sent to,
+// or nil if there isn't one. A path template matches a path with the same number of
+// segments whose fixed segments are equal, and when several templates match, the one
+// with the most fixed segments is chosen, so /v1/movies/trash is preferred over
+// /v1/movies/{id}.
+func (d *Document) Find(method, path string) *Operation {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var (
+		found *Operation
+		best  = -1
+	)
+
+	for template, item := range d.Paths {
+		op, ok := item[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+
+		score, ok := match(strings.Split(strings.Trim(template, "/"), "/"), segments)
+		if ok && score > best {
+			found, best = op, score
+		}
+	}
+
+	return found
+}
+
+// match reports whether the segments of a path match those of a template, and how many
+// of the template's segments are fixed.
+func match(template, segments []string) (int, bool) {
+	if len(template) != len(segments) {
+		return 0, false
+	}
+
+	fixed := 0
+
+	for i, segment := range template {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			continue
+		}
+		if segment != segments[i] {
+			return 0, false
+		}
+		fixed++
+	}
+
+	return fixed, true
+}
+
+// ValidateQuery checks the query string parameters of a request against the operation's
+// query parameters, adding an error to v for each which doesn't match its schema. Empty
+// parameters are treated as missing, as they are by the handlers. Arrays are given as
+// comma-separated lists.
+func (op *Operation) ValidateQuery(qs url.Values, v *validator.Validator) {
+	for _, param := range op.Parameters {
+		if param.In != "query" || param.Schema == nil || (param.Style != "" && param.Style != "form") {
+			continue
+		}
+
+		s := qs.Get(param.Name)
+		if s == "" {
+			if param.Required {
+				v.AddErrorCode(param.Name, "required", nil)
+			}
+			continue
+		}
+
+		value, ok := parseParam(s, param.Schema)
+		if !ok {
+			addTypeError(v, param.Name, param.Schema)
+			continue
+		}
+
+		validateValue(v, param.Name, value, param.Schema)
+	}
+}
+
+// parseParam converts the string value of a query string parameter to the type of its
+// schema, with the same JSON types a body would decode to.
+func parseParam(s string, schema *Schema) (any, bool) {
+	switch {
+	case schema.allows("integer"), schema.allows("number"):
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(s), true
+	case schema.allows("boolean"):
+		b, err := strconv.ParseBool(s)
+		return b, err == nil
+	case schema.allows("array"):
+		var values []any
+		for _, item := range strings.Split(s, ",") {
+			value := any(item)
+			if schema.Items != nil && !schema.Items.allows("string") {
+				var ok bool
+				if value, ok = parseParam(item, schema.Items); !ok {
+					return nil, false
+				}
+			}
+			values = append(values, value)
+		}
+		return values, true
+	default:
+		return s, true
+	}
+}
+
+// ValidateBody checks a request body of the given media type against the operation's
+// request body, adding an error to v for each field which doesn't match its schema. The
+// fields are named by their path, as in validator.Path. Bodies in media types without a
+// schema, and bodies which aren't valid JSON, aren't checked; it is left to the handler to
+// report them.
+func (op *Operation) ValidateBody(mediaType string, body []byte, v *validator.Validator) {
+	if op.RequestBody == nil {
+		return
+	}
+
+	content, ok := op.RequestBody.Content[mediaType]
+	if !ok || content.Schema == nil {
+		return
+	}
+
+	var value any
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		return
+	}
+
+	validateValue(v, "", value, content.Schema)
+}
+
+// HasBody reports whether the operation has a request body in the media type.
+func (op *Operation) HasBody(mediaType string) bool {
+	if op.RequestBody == nil {
+		return false
+	}
+
+	content, ok := op.RequestBody.Content[mediaType]
+	return ok && content.Schema != nil
+}
+
+// allows reports whether the schema allows values of the JSON type. A schema without a
+// type allows any value, and "number" also allows integers.
+func (s *Schema) allows(typ string) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+	if typ == "integer" && slices.Contains(s.Type, "number") {
+		return true
+	}
+	return slices.Contains(s.Type, typ)
+}
+
+// typeOf returns the JSON type of a decoded value, which is "integer" for numbers without
+// a fractional part.
+func typeOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		f, err := value.Float64()
+		if err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// addTypeError adds an error for a value which isn't of the schema's type. The code of
+// these errors is always "type", and their message is the one for the schema's first type,
+// such as "must be an integer value".
+func addTypeError(v *validator.Validator, field string, schema *Schema) {
+	v.AddFieldError(validator.FieldError{
+		Field:      field,
+		Code:       "type",
+		Params:     map[string]any{"type": strings.Join(schema.Type, ", ")},
+		MessageKey: schema.Type[0],
+	})
+}
+
+// validateValue checks a decoded value against a schema, adding an error to v for each
+// keyword the value fails. Once a value is found to be of the wrong type, nothing else is
+// checked. The false schema is only used for additionalProperties, so a value it rejects
+// is reported as an unknown field.
+func validateValue(v *validator.Validator, field string, value any, schema *Schema) {
+	if schema.never {
+		v.AddErrorCode(field, "unknown_field", nil)
+		return
+	}
+
+	typ := typeOf(value)
+	if !schema.allows(typ) {
+		addTypeError(v, field, schema)
+		return
+	}
+
+	if len(schema.Enum) > 0 {
+		ok := slices.ContainsFunc(schema.Enum, func(permitted any) bool {
+			return fmt.Sprint(permitted) == fmt.Sprint(value)
+		})
+		v.Apply(field, validator.Assert(ok, "enum").WithParams(map[string]any{"values": schema.Enum}))
+	}
+
+	switch value := value.(type) {
+	case json.Number:
+		f, _ := value.Float64()
+		if schema.Minimum != nil {
+			v.Apply(field, validator.Min(f, *schema.Minimum))
+		}
+		if schema.Maximum != nil {
+			v.Apply(field, validator.Max(f, *schema.Maximum))
+		}
+
+	case string:
+		if schema.MinLength != nil {
+			v.Apply(field, validator.MinLength(value, *schema.MinLength))
+		}
+		if schema.MaxLength != nil {
+			v.Apply(field, validator.MaxLength(value, *schema.MaxLength))
+		}
+		if schema.pattern != nil {
+			v.Apply(field, validator.Pattern(value, schema.pattern))
+		}
+
+	case []any:
+		if schema.MinItems != nil {
+			v.Apply(field, validator.MinItems(value, *schema.MinItems))
+		}
+		if schema.MaxItems != nil {
+			v.Apply(field, validator.MaxItems(value, *schema.MaxItems))
+		}
+		if schema.UniqueItems {
+			seen := make(map[string]bool, len(value))
+			for _, item := range value {
+				js, _ := json.Marshal(item)
+				seen[string(js)] = true
+			}
+			v.Apply(field, validator.Assert(len(seen) == len(value), "unique"))
+		}
+		if schema.Items != nil {
+			for i, item := range value {
+				validateValue(v, path(field, i), item, schema.Items)
+			}
+		}
+
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				v.AddErrorCode(path(field, name), "required", nil)
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				property = schema.AdditionalProperties
+			}
+
+			if property != nil {
+				validateValue(v, path(field, name), value[name], property)
+			}
+		}
+	}
+}
+
+// path returns the path of a property or item of the field, which is just the property's
+// name at the top level of a body.
+func path(field string, part any) string {
+	if field == "" {
+		return validator.Path(part)
+	}
+	return validator.Path(field, part)
+}
@@ -0,0 +1,67 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MediaTypeMergePatch is the media type of an RFC 7396 JSON Merge Patch document.
+const MediaTypeMergePatch = "application/merge-patch+json"
+
+// MergePatch applies an RFC 7396 JSON Merge Patch to a JSON document and returns the
+// patched document. Members of the patch which are objects are merged recursively, members
+// which are null are removed from the target, and any other value replaces the target
+// value (arrays are always replaced as a whole).
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+// mergeValue implements the MergePatch algorithm from section 2 of RFC 7396.
+func mergeValue(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+
+		t[key] = mergeValue(t[key], value)
+	}
+
+	return t
+}
+
+// decode unmarshals a JSON document into generic Go values, keeping numbers as
+// json.Number so that they are written back exactly as they were read.
+func decode(doc []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	var v any
+
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
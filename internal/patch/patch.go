@@ -0,0 +1,402 @@
+// Package patch implements the two standard formats for partially updating a JSON
+// document: JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902).
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MediaTypeJSONPatch is the media type of an RFC 6902 JSON Patch document.
+const MediaTypeJSONPatch = "application/json-patch+json"
+
+var (
+	// ErrInvalidPatch is returned when a patch document is not valid JSON, or is not a
+	// well-formed JSON Patch document.
+	ErrInvalidPatch = errors.New("invalid patch document")
+	// ErrTestFailed is returned when a "test" operation of a JSON Patch doesn't match
+	// the document. In that case none of the operations are applied.
+	ErrTestFailed = errors.New("patch test operation failed")
+)
+
+// Operation is a single operation of a JSON Patch document, such as
+// {"op": "add", "path": "/genres/-", "value": "drama"}.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// OperationError describes why a JSON Patch operation couldn't be applied.
+type OperationError struct {
+	Index int    // The position of the operation in the patch document.
+	Op    string // The name of the operation.
+	Path  string // The target path of the operation.
+	Err   error  // The underlying problem.
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %q): %s", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeOperations parses a JSON Patch document, which must be a JSON array of operations.
+func DecodeOperations(b []byte) ([]Operation, error) {
+	var ops []Operation
+
+	err := json.Unmarshal(b, &ops)
+	if err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	return ops, nil
+}
+
+// Apply applies the operations of a JSON Patch to a JSON document in order and returns the
+// patched document. Patches are atomic: if any operation fails (including a failed "test"
+// operation) an error is returned and the document is left unchanged.
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		root, err = applyOperation(root, op)
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+// applyOperation applies a single operation to the document and returns the new root.
+func applyOperation(root any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// value decodes the "value" member, which is required by add, replace and test.
+	value := func() (any, error) {
+		if op.Value == nil {
+			return nil, errors.New(`missing "value" member`)
+		}
+		return decode(op.Value)
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, v)
+
+	case "remove":
+		root, _, err = remove(root, path)
+		return root, err
+
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		// The whole document can be replaced, although it can't be removed.
+		if len(path) == 0 {
+			return v, nil
+		}
+		root, _, err = remove(root, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, v)
+
+	case "move":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if isProperPrefix(from, path) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		root, v, err := remove(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, v)
+
+	case "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+		// Copy the value by round-tripping it through JSON, so that the copy doesn't
+		// share any maps or slices with the original.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		v, err = decode(b)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, v)
+
+	case "test":
+		expected, err := value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(root, path)
+		if err != nil || !equal(actual, expected) {
+			return nil, ErrTestFailed
+		}
+		return root, nil
+
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+// The empty pointer "" refers to the whole document and results in no tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// isProperPrefix reports whether the prefix pointer refers to an ancestor of path.
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// arrayIndex parses an array index token. When appending is true the "-" token, meaning
+// the position after the last element, is accepted and the index may equal the length.
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return length, nil
+	}
+
+	// Indexes must be plain non-negative integers without leading zeros.
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i > length || (!appending && i == length) {
+		return 0, fmt.Errorf("array index %q out of range", token)
+	}
+
+	return i, nil
+}
+
+// get returns the value the tokens refer to.
+func get(node any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path member %q not found", token)
+			}
+			node = child
+		case []any:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("path member %q not found", token)
+		}
+	}
+
+	return node, nil
+}
+
+// add adds a value at the location the tokens refer to and returns the new node. Object
+// members are added or replaced, and array elements are inserted at the given index.
+func add(node any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	token, rest := tokens[0], tokens[1:]
+
+	switch n := node.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			n[token] = value
+			return n, nil
+		}
+
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("path member %q not found", token)
+		}
+
+		child, err := add(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+
+	case []any:
+		if len(rest) == 0 {
+			i, err := arrayIndex(token, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := add(n[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+
+	default:
+		return nil, fmt.Errorf("path member %q not found", token)
+	}
+}
+
+// remove removes the value at the location the tokens refer to, and returns the new node
+// along with the removed value.
+func remove(node any, tokens []string) (any, any, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+
+	token, rest := tokens[0], tokens[1:]
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path member %q not found", token)
+		}
+
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+
+		child, removed, err := remove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+
+	case []any:
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(rest) == 0 {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+
+		child, removed, err := remove(n[i], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = child
+		return n, removed, nil
+
+	default:
+		return nil, nil, fmt.Errorf("path member %q not found", token)
+	}
+}
+
+// equal reports whether two decoded JSON values are equal, as defined for the "test"
+// operation: numbers are compared by value, arrays element by element and objects
+// member by member regardless of order.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return a == b
+	}
+}
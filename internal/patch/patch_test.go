@@ -0,0 +1,327 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// canonical re-encodes a JSON document with its object members sorted, so that documents
+// can be compared as strings.
+func canonical(t *testing.T, doc string) string {
+	t.Helper()
+
+	v, err := decode([]byte(doc))
+	if err != nil {
+		t.Fatalf("decoding %s: %v", doc, err)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// The examples of Appendix A of RFC 6902, followed by the edge cases they don't cover.
+// A want of "" means the patch must fail.
+var applyTests = []struct {
+	name  string
+	doc   string
+	patch string
+	want  string
+}{
+	{
+		name:  "A.1 Adding an Object Member",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+		want:  `{"baz": "qux", "foo": "bar"}`,
+	},
+	{
+		name:  "A.2 Adding an Array Element",
+		doc:   `{"foo": ["bar", "baz"]}`,
+		patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+		want:  `{"foo": ["bar", "qux", "baz"]}`,
+	},
+	{
+		name:  "A.3 Removing an Object Member",
+		doc:   `{"baz": "qux", "foo": "bar"}`,
+		patch: `[{"op": "remove", "path": "/baz"}]`,
+		want:  `{"foo": "bar"}`,
+	},
+	{
+		name:  "A.4 Removing an Array Element",
+		doc:   `{"foo": ["bar", "qux", "baz"]}`,
+		patch: `[{"op": "remove", "path": "/foo/1"}]`,
+		want:  `{"foo": ["bar", "baz"]}`,
+	},
+	{
+		name:  "A.5 Replacing a Value",
+		doc:   `{"baz": "qux", "foo": "bar"}`,
+		patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+		want:  `{"baz": "boo", "foo": "bar"}`,
+	},
+	{
+		name:  "A.6 Moving a Value",
+		doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+		patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+		want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+	},
+	{
+		name:  "A.7 Moving an Array Element",
+		doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+		patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+		want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+	},
+	{
+		name:  "A.8 Testing a Value: Success",
+		doc:   `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		patch: `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+		want:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+	},
+	{
+		name:  "A.9 Testing a Value: Error",
+		doc:   `{"baz": "qux"}`,
+		patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+	},
+	{
+		name:  "A.10 Adding a Nested Member Object",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+		want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+	},
+	{
+		name:  "A.11 Ignoring Unrecognized Elements",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+		want:  `{"foo": "bar", "baz": "qux"}`,
+	},
+	{
+		name:  "A.12 Adding to a Nonexistent Target",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+	},
+	{
+		name:  "A.14 ~ Escape Ordering",
+		doc:   `{"/": 9, "~1": 10}`,
+		patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+		want:  `{"/": 9, "~1": 10}`,
+	},
+	{
+		name:  "A.15 Comparing Strings and Numbers",
+		doc:   `{"/": 9, "~1": 10}`,
+		patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+	},
+	{
+		name:  "A.16 Adding an Array Value",
+		doc:   `{"foo": ["bar"]}`,
+		patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+		want:  `{"foo": ["bar", ["abc", "def"]]}`,
+	},
+	{
+		name:  "Escaped slash",
+		doc:   `{"a/b": 1, "m~n": 2}`,
+		patch: `[{"op": "replace", "path": "/a~1b", "value": 3}, {"op": "remove", "path": "/m~0n"}]`,
+		want:  `{"a/b": 3}`,
+	},
+	{
+		name:  "Appending with -",
+		doc:   `{"genres": ["drama"]}`,
+		patch: `[{"op": "add", "path": "/genres/-", "value": "crime"}, {"op": "add", "path": "/genres/-", "value": "war"}]`,
+		want:  `{"genres": ["drama", "crime", "war"]}`,
+	},
+	{
+		name:  "Removing with -",
+		doc:   `{"genres": ["drama"]}`,
+		patch: `[{"op": "remove", "path": "/genres/-"}]`,
+	},
+	{
+		name:  "Index past the end",
+		doc:   `{"genres": ["drama"]}`,
+		patch: `[{"op": "add", "path": "/genres/2", "value": "crime"}]`,
+	},
+	{
+		name:  "Index with a leading zero",
+		doc:   `{"genres": ["drama", "crime"]}`,
+		patch: `[{"op": "remove", "path": "/genres/01"}]`,
+	},
+	{
+		name:  "Moving into its own child",
+		doc:   `{"a": {"b": {}}}`,
+		patch: `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`,
+	},
+	{
+		name:  "Moving to the same location",
+		doc:   `{"a": {"b": 1}}`,
+		patch: `[{"op": "move", "from": "/a", "path": "/a"}]`,
+		want:  `{"a": {"b": 1}}`,
+	},
+	{
+		name:  "Copying a value",
+		doc:   `{"a": {"b": [1]}}`,
+		patch: `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "add", "path": "/c/b/-", "value": 2}]`,
+		want:  `{"a": {"b": [1]}, "c": {"b": [1, 2]}}`,
+	},
+	{
+		name:  "Replacing the whole document",
+		doc:   `{"a": 1}`,
+		patch: `[{"op": "replace", "path": "", "value": {"b": 2}}]`,
+		want:  `{"b": 2}`,
+	},
+	{
+		name:  "Removing the whole document",
+		doc:   `{"a": 1}`,
+		patch: `[{"op": "remove", "path": ""}]`,
+	},
+	{
+		name:  "Replacing a missing member",
+		doc:   `{"a": 1}`,
+		patch: `[{"op": "replace", "path": "/b", "value": 2}]`,
+	},
+	{
+		name:  "Adding null",
+		doc:   `{"a": 1}`,
+		patch: `[{"op": "add", "path": "/b", "value": null}]`,
+		want:  `{"a": 1, "b": null}`,
+	},
+	{
+		name:  "Missing value",
+		doc:   `{"a": 1}`,
+		patch: `[{"op": "add", "path": "/b"}]`,
+	},
+	{
+		name:  "Testing numbers by value",
+		doc:   `{"a": 1.0, "b": {"x": [1, 2], "y": null}}`,
+		patch: `[{"op": "test", "path": "/a", "value": 1}, {"op": "test", "path": "/b", "value": {"y": null, "x": [1, 2]}}]`,
+		want:  `{"a": 1.0, "b": {"x": [1, 2], "y": null}}`,
+	},
+	{
+		name:  "Testing an array in another order",
+		doc:   `{"a": [1, 2]}`,
+		patch: `[{"op": "test", "path": "/a", "value": [2, 1]}]`,
+	},
+	{
+		name:  "Testing a missing member",
+		doc:   `{"a": 1}`,
+		patch: `[{"op": "test", "path": "/b", "value": null}]`,
+	},
+	{
+		name:  "Unknown operation",
+		doc:   `{"a": 1}`,
+		patch: `[{"op": "increment", "path": "/a", "value": 1}]`,
+	},
+	{
+		name:  "Pointer without a leading slash",
+		doc:   `{"a": 1}`,
+		patch: `[{"op": "remove", "path": "a"}]`,
+	},
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range applyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := DecodeOperations([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("DecodeOperations: %v", err)
+			}
+
+			got, err := Apply([]byte(tt.doc), ops)
+
+			if tt.want == "" {
+				var opErr *OperationError
+				if !errors.As(err, &opErr) {
+					t.Fatalf("got %s, %v; want an OperationError", got, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if g, w := canonical(t, string(got)), canonical(t, tt.want); g != w {
+				t.Errorf("got %s; want %s", g, w)
+			}
+		})
+	}
+}
+
+func TestApplyTestFailed(t *testing.T) {
+	ops, err := DecodeOperations([]byte(`[{"op": "test", "path": "/baz", "value": "bar"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Apply([]byte(`{"baz": "qux"}`), ops)
+
+	var opErr *OperationError
+	if !errors.Is(err, ErrTestFailed) || !errors.As(err, &opErr) || opErr.Index != 0 || opErr.Op != "test" || opErr.Path != "/baz" {
+		t.Errorf("got error %v; want ErrTestFailed for operation 0", err)
+	}
+}
+
+// TestApplyAtomic checks that a patch whose last operation fails returns no document and
+// leaves the original untouched, even though the earlier operations changed it in memory.
+func TestApplyAtomic(t *testing.T) {
+	doc := []byte(`{"title": "Casablanca", "genres": ["drama"]}`)
+	original := string(doc)
+
+	ops, err := DecodeOperations([]byte(`[
+		{"op": "replace", "path": "/title", "value": "Alien"},
+		{"op": "add", "path": "/genres/-", "value": "horror"},
+		{"op": "remove", "path": "/genres/0"},
+		{"op": "test", "path": "/year", "value": 1979}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Apply(doc, ops)
+
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.Index != 3 {
+		t.Fatalf("got error %v; want operation 3 to fail", err)
+	}
+	if got != nil {
+		t.Errorf("got document %s; want none", got)
+	}
+	if string(doc) != original {
+		t.Errorf("the document changed to %s", doc)
+	}
+}
+
+func TestDecodeOperations(t *testing.T) {
+	for _, patch := range []string{`{"op": "add"}`, `[{"op": "add"`, `"add"`, ``} {
+		if _, err := DecodeOperations([]byte(patch)); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("%q: got error %v; want ErrInvalidPatch", patch, err)
+		}
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+	}{
+		{"", nil},
+		{"/", []string{""}},
+		{"/foo/0", []string{"foo", "0"}},
+		{"/a~1b", []string{"a/b"}},
+		{"/m~0n", []string{"m~n"}},
+		{"/~01", []string{"~1"}},
+		{"/~10", []string{"/0"}},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePointer(tt.pointer)
+		if err != nil || len(got) != len(tt.want) {
+			t.Errorf("parsePointer(%q) = %q, %v; want %q", tt.pointer, got, err, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("parsePointer(%q) = %q; want %q", tt.pointer, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps blobs as files under a directory on the local filesystem. Its signed
+// URLs point back at the API itself, under URLPrefix, where the LocalStore serves the
+// blobs as an http.Handler after checking the signature. Signatures are HMAC-SHA256
+// digests of the key and the expiry time, made with a secret key.
+type LocalStore struct {
+	dir       string
+	urlPrefix string
+	secret    []byte
+}
+
+// NewLocalStore returns a LocalStore which keeps its blobs under dir, creating the
+// directory if it doesn't exist. Signed URLs have the form
+// <urlPrefix><key>?expires=<unix time>&signature=<hex>, and are signed with secret.
+func NewLocalStore(dir, urlPrefix string, secret []byte) (*LocalStore, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("storage: a secret is required to sign URLs")
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{dir: dir, urlPrefix: urlPrefix, secret: secret}, nil
+}
+
+// path returns the path of the file holding the blob with the given key.
+func (s *LocalStore) path(key string) (string, error) {
+	err := validateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file and renames it into place, so that a blob is
+// never seen half-written. The content type isn't kept; it is detected when the blob is
+// served.
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// Delete removes the file holding the blob.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// SignedURL returns a URL under the store's URL prefix which is valid until expiry has
+// passed.
+func (s *LocalStore) SignedURL(key string, expiry time.Duration) (string, error) {
+	err := validateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(key, expires))
+
+	return s.urlPrefix + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// sign returns the hex-encoded signature of a key and expiry time.
+func (s *LocalStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP serves the blob named by the part of the request path after the URL prefix,
+// if the request carries a valid signature which hasn't expired. Otherwise it responds
+// with 403 Forbidden, or 404 Not Found if there is no such blob.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, s.urlPrefix)
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix || !hmac.Equal([]byte(signature), []byte(s.sign(key, expires))) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	path, err := s.path(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The URL is only valid until it expires, so don't let it be cached for any longer.
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", max(unix-time.Now().Unix(), 0)))
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3MaxPresignExpiry is the longest expiry S3 accepts for a presigned URL.
+	s3MaxPresignExpiry = 7 * 24 * time.Hour
+	s3Algorithm        = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3TimeFormat       = "20060102T150405Z"
+	s3DateFormat       = "20060102"
+)
+
+// S3Config holds the settings of an S3Store.
+type S3Config struct {
+	// Endpoint is the base URL of the object store, such as "https://s3.eu-west-1.amazonaws.com"
+	// or "http://localhost:9000" for a local stand-in such as MinIO.
+	Endpoint string
+	// Region is the region requests are signed for. Most stand-ins accept any region,
+	// commonly "us-east-1".
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket in the path of the URL (http://host/bucket/key) rather
+	// than as a subdomain (http://bucket.host/key). Local stand-ins generally need it.
+	PathStyle bool
+}
+
+// S3Store keeps blobs in a bucket of an S3-compatible object store. Requests are signed
+// with AWS Signature Version 4, and signed URLs are presigned GET requests, so that clients
+// download blobs straight from the object store.
+type S3Store struct {
+	endpoint *url.URL
+	config   S3Config
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Store returns an S3Store using the given settings. It doesn't contact the object
+// store, so a missing bucket or bad credentials are only noticed when blobs are stored.
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid S3 endpoint: %w", err)
+	}
+
+	switch {
+	case endpoint.Scheme != "http" && endpoint.Scheme != "https":
+		return nil, errors.New("storage: the S3 endpoint must be an http or https URL")
+	case cfg.Region == "":
+		return nil, errors.New("storage: an S3 region is required")
+	case cfg.Bucket == "":
+		return nil, errors.New("storage: an S3 bucket is required")
+	case cfg.AccessKey == "" || cfg.SecretKey == "":
+		return nil, errors.New("storage: S3 credentials are required")
+	}
+
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/")
+
+	return &S3Store{
+		endpoint: endpoint,
+		config:   cfg,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of the object with the given key.
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+
+	if s.config.PathStyle {
+		u.Path = u.Path + "/" + s.config.Bucket + "/" + key
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+
+	// Keep the encoding used to sign the request, rather than Go's own.
+	u.RawPath = s3EscapePath(u.Path)
+
+	return &u
+}
+
+// Put uploads the blob with a PUT Object request.
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	err := validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	sum := sha256.Sum256(data)
+	s.sign(req, hex.EncodeToString(sum[:]))
+
+	return s.do(req)
+}
+
+// Delete removes the blob with a DELETE Object request.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	err := validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(nil)
+	s.sign(req, hex.EncodeToString(sum[:]))
+
+	err = s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// SignedURL returns a presigned GET URL for the blob. Expiries longer than S3 allows are
+// shortened to seven days.
+func (s *S3Store) SignedURL(key string, expiry time.Duration) (string, error) {
+	err := validateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	expiry = min(expiry, s3MaxPresignExpiry)
+	now := s.now().UTC()
+	u := s.objectURL(key)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     s3Algorithm,
+		"X-Amz-Credential":    s.config.AccessKey + "/" + s.scope(now),
+		"X-Amz-Date":          now.Format(s3TimeFormat),
+		"X-Amz-Expires":       strconv.Itoa(int(expiry.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	u.RawQuery = s3CanonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+
+	return u.String(), nil
+}
+
+// sign adds the headers and Authorization header of Signature Version 4 to a request
+// whose body has the given hex-encoded SHA-256 hash.
+func (s *S3Store) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(nil),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.config.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonicalRequest)))
+}
+
+// scope returns the credential scope of requests signed at the given time.
+func (s *S3Store) scope(t time.Time) string {
+	return t.Format(s3DateFormat) + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// signature returns the hex-encoded signature of a canonical request made at the given
+// time, using a signing key derived from the secret key and the credential scope.
+func (s *S3Store) signature(t time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3TimeFormat),
+		s.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + s.config.SecretKey)
+	for _, part := range []string{t.Format(s3DateFormat), s.config.Region, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+
+	return hex.EncodeToString(key)
+}
+
+// do sends a signed request, returning ErrNotFound for a 404 Not Found response and an
+// error holding the start of the response body for any other unsuccessful response.
+func (s *S3Store) do(req *http.Request) error {
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("storage: %s %s: %s: %s", req.Method, req.URL.Path, res.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// s3CanonicalQuery returns the query string of a canonical request: parameters sorted by
+// name, with names and values escaped as described by s3Escape.
+func s3CanonicalQuery(params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = s3Escape(name) + "=" + s3Escape(params[name])
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// s3EscapePath escapes each segment of a path with s3Escape, leaving the slashes between
+// them as they are.
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// s3Escape percent-encodes every byte of s except the unreserved characters of RFC 3986,
+// which is the encoding Signature Version 4 expects. It differs from url.QueryEscape,
+// which encodes spaces as "+".
+func s3Escape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
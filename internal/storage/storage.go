@@ -0,0 +1,49 @@
+// Package storage stores binary objects (blobs), such as uploaded images, behind the
+// BlobStore interface. LocalStore keeps them on the local filesystem and S3Store keeps
+// them in any S3-compatible object store. Blobs are downloaded directly by clients using
+// signed URLs which expire after a given time.
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a blob doesn't exist.
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for keys which are empty, absolute, or contain "." or ".."
+	// path segments.
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore is implemented by the stores blobs can be kept in. Keys are slash-separated
+// paths such as "movies/1/poster.jpg".
+type BlobStore interface {
+	// Put stores a blob under the given key, replacing any blob already stored there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes the blob stored under the given key. Deleting a blob which
+	// doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL from which the blob can be downloaded without any other
+	// credentials, until the expiry duration has passed.
+	SignedURL(key string, expiry time.Duration) (string, error)
+}
+
+// validateKey checks that a key is a relative slash-separated path without any empty,
+// "." or ".." segments, so that it can't escape the store's directory or bucket.
+func validateKey(key string) error {
+	if key == "" {
+		return ErrInvalidKey
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
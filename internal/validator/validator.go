@@ -1,17 +1,56 @@
 package validator
 
 import (
+	"cmp"
+	"fmt"
 	"regexp"
 	"slices"
+	"strconv"
+	"strings"
+
+	"greenlight.tomcat.net/internal/i18n"
 )
 
 // EmailRX is a regular expression for validating email addresses.
 // It requires a local part, an @ symbol, a domain name, and at least one top-level domain part (e.g., .com).
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+$")
 
-// Validator type which contains a map of validation errors.
+// CodeInvalid is the code of errors added with Check and AddError, which don't say more
+// precisely what was wrong.
+const CodeInvalid = "invalid"
+
+// FieldError is a single validation error. Field is the path of the field which failed
+// validation, such as "title" or "genres[2]" (see Path). Code is a stable, machine-readable
+// code such as "max_length", and Params holds the values the rule checked against, such as
+// {"max": 500}, so that clients can build their own messages. Message is the English
+// message for the error.
+//
+// MessageKey is the key of the message in the i18n catalogs, without its "validation."
+// prefix, which is used to translate the message. It is empty for the free-form messages
+// of Check and AddError, which aren't translated.
+type FieldError struct {
+	Field      string         `json:"field"`
+	Code       string         `json:"code"`
+	Message    string         `json:"message"`
+	Params     map[string]any `json:"params,omitempty"`
+	MessageKey string         `json:"-"`
+}
+
+// Localize returns the error with its message in the given locale. Errors without a
+// MessageKey are returned as they are.
+func (e FieldError) Localize(locale string) FieldError {
+	if e.MessageKey != "" {
+		e.Message = i18n.Translate(locale, "validation."+e.MessageKey, e.Params)
+	}
+	return e
+}
+
+// Validator type which contains the validation errors. FieldErrors holds every error, in
+// the order they were added, and Errors holds the first message for each field, which is
+// the shape validation errors have always been reported in.
 type Validator struct {
-	Errors map[string]string
+	Errors      map[string]string
+	FieldErrors []FieldError
 }
 
 // New creates a new Validator instance with an initialized errors map.
@@ -24,10 +63,38 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-// AddError adds an error message to the errors map, only if the key does not already exist.
+// AddError adds an error message for the field, with the code CodeInvalid. Every distinct
+// message is kept in FieldErrors, while the errors map only keeps the first message of
+// each field. The message isn't translated; prefer AddErrorCode for errors clients see.
 func (v *Validator) AddError(key, message string) {
-	if _, exists := v.Errors[key]; !exists {
-		v.Errors[key] = message
+	v.AddFieldError(FieldError{Field: key, Code: CodeInvalid, Message: message})
+}
+
+// AddErrorCode adds an error for the field with the given code, whose message is the one
+// with the same key in the i18n catalogs.
+func (v *Validator) AddErrorCode(key, code string, params map[string]any) {
+	v.AddFieldError(FieldError{Field: key, Code: code, Params: params, MessageKey: code})
+}
+
+// AddFieldError adds a validation error. If the error has a MessageKey but no Message, its
+// message is set from the English catalog. An error repeating the field, code and message
+// of an earlier one, such as from a check made in a loop, is ignored.
+func (v *Validator) AddFieldError(e FieldError) {
+	if e.Message == "" {
+		e = e.Localize(i18n.DefaultLocale)
+	}
+
+	duplicate := slices.ContainsFunc(v.FieldErrors, func(other FieldError) bool {
+		return other.Field == e.Field && other.Code == e.Code && other.Message == e.Message
+	})
+	if duplicate {
+		return
+	}
+
+	v.FieldErrors = append(v.FieldErrors, e)
+
+	if _, exists := v.Errors[e.Field]; !exists {
+		v.Errors[e.Field] = e.Message
 	}
 }
 
@@ -38,6 +105,165 @@ func (v *Validator) Check(ok bool, key, message string) {
 	}
 }
 
+// Localized returns every error with its message in the given locale.
+func (v *Validator) Localized(locale string) []FieldError {
+	errors := make([]FieldError, len(v.FieldErrors))
+	for i, e := range v.FieldErrors {
+		errors[i] = e.Localize(locale)
+	}
+	return errors
+}
+
+// LocalizedErrors returns the first message for each field in the given locale, in the
+// same shape as the errors map.
+func (v *Validator) LocalizedErrors(locale string) map[string]string {
+	errors := make(map[string]string, len(v.Errors))
+	for _, e := range v.Localized(locale) {
+		if _, exists := errors[e.Field]; !exists {
+			errors[e.Field] = e.Message
+		}
+	}
+	return errors
+}
+
+// Rule is the result of checking a value against one of the rule helpers below, such as
+// MaxLength. Rules are applied to a field with Apply. The error message of a rule is the
+// one in the i18n catalogs with its MessageKey, which is its code unless changed with
+// WithMessage.
+type Rule struct {
+	OK         bool           // Whether the value passed the rule.
+	Code       string         // The code of the error if it didn't.
+	Params     map[string]any // The values the rule checked against.
+	MessageKey string         // The key of the error message in the catalogs.
+	required   bool           // Whether the rule is Required, which stops Apply when it fails.
+}
+
+// WithMessage returns the rule with a different error message, given by its key in the
+// catalogs, for fields whose message is more specific than the rule's own.
+func (r Rule) WithMessage(key string) Rule {
+	r.MessageKey = key
+	return r
+}
+
+// WithParams returns the rule with the given parameters, for the placeholders of its
+// message.
+func (r Rule) WithParams(params map[string]any) Rule {
+	r.Params = params
+	return r
+}
+
+// Apply checks the field against each of the rules, adding an error for every rule which
+// failed. If a Required or RequiredSlice rule fails, the rules after it aren't applied,
+// since a missing value would only fail them too.
+func (v *Validator) Apply(key string, rules ...Rule) {
+	for _, rule := range rules {
+		if rule.OK {
+			continue
+		}
+
+		v.AddFieldError(FieldError{Field: key, Code: rule.Code, Params: rule.Params, MessageKey: rule.MessageKey})
+
+		if rule.required {
+			return
+		}
+	}
+}
+
+// Assert is a rule checking a condition which none of the other rules cover. The code is
+// also the key of its message.
+func Assert(ok bool, code string) Rule {
+	return Rule{OK: ok, Code: code, MessageKey: code}
+}
+
+// Required checks that a value isn't the zero value of its type.
+func Required[T comparable](value T) Rule {
+	var zero T
+	return Rule{OK: value != zero, Code: "required", MessageKey: "required", required: true}
+}
+
+// RequiredSlice checks that a slice was provided, which for a slice decoded from JSON means
+// that it wasn't missing or null. An empty slice was provided.
+func RequiredSlice[T any](values []T) Rule {
+	return Rule{OK: values != nil, Code: "required", MessageKey: "required", required: true}
+}
+
+// MinLength checks that a string is at least min bytes long.
+func MinLength(value string, min int) Rule {
+	return Rule{OK: len(value) >= min, Code: "min_length", Params: map[string]any{"min": min}, MessageKey: "min_length"}
+}
+
+// MaxLength checks that a string is at most max bytes long.
+func MaxLength(value string, max int) Rule {
+	return Rule{OK: len(value) <= max, Code: "max_length", Params: map[string]any{"max": max}, MessageKey: "max_length"}
+}
+
+// ExactLength checks that a string is exactly length bytes long.
+func ExactLength(value string, length int) Rule {
+	return Rule{OK: len(value) == length, Code: "exact_length", Params: map[string]any{"length": length}, MessageKey: "exact_length"}
+}
+
+// MinItems checks that a slice holds at least min items.
+func MinItems[T any](values []T, min int) Rule {
+	return Rule{OK: len(values) >= min, Code: "min_items", Params: map[string]any{"min": min}, MessageKey: "min_items"}
+}
+
+// MaxItems checks that a slice holds at most max items.
+func MaxItems[T any](values []T, max int) Rule {
+	return Rule{OK: len(values) <= max, Code: "max_items", Params: map[string]any{"max": max}, MessageKey: "max_items"}
+}
+
+// Min checks that a value is at least min.
+func Min[T cmp.Ordered](value, min T) Rule {
+	return Rule{OK: value >= min, Code: "min", Params: map[string]any{"min": min}, MessageKey: "min"}
+}
+
+// Max checks that a value is at most max.
+func Max[T cmp.Ordered](value, max T) Rule {
+	return Rule{OK: value <= max, Code: "max", Params: map[string]any{"max": max}, MessageKey: "max"}
+}
+
+// Range checks that a value is between min and max, inclusive.
+func Range[T cmp.Ordered](value, min, max T) Rule {
+	return Rule{OK: value >= min && value <= max, Code: "range", Params: map[string]any{"min": min, "max": max}, MessageKey: "range"}
+}
+
+// Pattern checks that a string matches a regular expression.
+func Pattern(value string, rx *regexp.Regexp) Rule {
+	return Rule{OK: rx.MatchString(value), Code: "pattern", Params: map[string]any{"pattern": rx.String()}, MessageKey: "pattern"}
+}
+
+// Enum checks that a value is one of the permitted values.
+func Enum[T comparable](value T, permittedValues ...T) Rule {
+	return Rule{OK: slices.Contains(permittedValues, value), Code: "enum", Params: map[string]any{"values": permittedValues}, MessageKey: "enum"}
+}
+
+// NoDuplicates checks that all values in a slice are unique.
+func NoDuplicates[T comparable](values []T) Rule {
+	return Rule{OK: Unique(values), Code: "unique", MessageKey: "unique"}
+}
+
+// Path returns the path of a nested or indexed field, for the keys of errors about the
+// items of a list or the fields of an object. Strings are joined with dots and integers
+// are added as indexes, so Path("genres", 2) is "genres[2]" and Path("releases", 0,
+// "country") is "releases[0].country".
+func Path(parts ...any) string {
+	var b strings.Builder
+
+	for _, part := range parts {
+		switch part := part.(type) {
+		case int:
+			b.WriteString("[" + strconv.Itoa(part) + "]")
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, part)
+		}
+	}
+
+	return b.String()
+}
+
 // PermittedValue checks if a value is present in a list of permitted values.
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return slices.Contains(permittedValues, value)
@@ -0,0 +1,207 @@
+package validator
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+// codes returns the field and code of each error, in order, such as "title:required".
+func codes(v *Validator) []string {
+	var codes []string
+	for _, e := range v.FieldErrors {
+		codes = append(codes, e.Field+":"+e.Code)
+	}
+	return codes
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		apply func(v *Validator)
+		want  []string
+	}{
+		{
+			name: "passing rules",
+			apply: func(v *Validator) {
+				v.Apply("title", Required("Heat"), MaxLength("Heat", 500))
+			},
+		},
+		{
+			// A missing value would fail MinLength too, so only required is reported.
+			name: "stops at required",
+			apply: func(v *Validator) {
+				v.Apply("title", Required(""), MinLength("", 2), Assert(false, "pattern"))
+			},
+			want: []string{"title:required"},
+		},
+		{
+			name: "stops at required slice",
+			apply: func(v *Validator) {
+				var genres []string
+				v.Apply("genres", RequiredSlice(genres), MinItems(genres, 1))
+			},
+			want: []string{"genres:required"},
+		},
+		{
+			// An empty slice was provided, so the rules after RequiredSlice still apply.
+			name: "empty slice",
+			apply: func(v *Validator) {
+				v.Apply("genres", RequiredSlice([]string{}), MinItems([]string{}, 1))
+			},
+			want: []string{"genres:min_items"},
+		},
+		{
+			name: "every failed rule",
+			apply: func(v *Validator) {
+				v.Apply("code", Required("x"), ExactLength("x", 2), Enum("x", "fr", "en"))
+			},
+			want: []string{"code:exact_length", "code:enum"},
+		},
+		{
+			name: "fields are independent",
+			apply: func(v *Validator) {
+				v.Apply("title", Required(""), MaxLength("", 500))
+				v.Apply("year", Required(int32(1800)), Range(int32(1800), 1888, 2100))
+			},
+			want: []string{"title:required", "year:range"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			tt.apply(v)
+
+			if got := codes(v); !slices.Equal(got, tt.want) {
+				t.Errorf("got errors %q; want %q", got, tt.want)
+			}
+			if v.Valid() != (len(tt.want) == 0) {
+				t.Errorf("got Valid %t", v.Valid())
+			}
+		})
+	}
+}
+
+func TestRuleMessages(t *testing.T) {
+	v := New()
+	v.Apply("title", MaxLength("Heat", 2))
+	v.Apply("runtime", Assert(false, "positive").WithMessage("greater_than_zero"))
+	v.Apply("year", Min(1800, 1888).WithParams(map[string]any{"min": 1887}).WithMessage("movie_year_min"))
+
+	want := []FieldError{
+		{Field: "title", Code: "max_length", Message: "must not be more than 2 bytes long", Params: map[string]any{"max": 2}, MessageKey: "max_length"},
+		{Field: "runtime", Code: "positive", Message: "must be greater than zero", MessageKey: "greater_than_zero"},
+		{Field: "year", Code: "min", Message: "must be greater than 1887", Params: map[string]any{"min": 1887}, MessageKey: "movie_year_min"},
+	}
+
+	if len(v.FieldErrors) != len(want) {
+		t.Fatalf("got errors %+v", v.FieldErrors)
+	}
+	for i, e := range v.FieldErrors {
+		if e.Field != want[i].Field || e.Code != want[i].Code || e.Message != want[i].Message || e.MessageKey != want[i].MessageKey || !maps.Equal(e.Params, want[i].Params) {
+			t.Errorf("got %+v; want %+v", e, want[i])
+		}
+	}
+}
+
+func TestAddFieldError(t *testing.T) {
+	v := New()
+
+	// The same check made for each item of a list adds its error once.
+	for range 3 {
+		v.AddErrorCode("genres", "unique", nil)
+	}
+	// A different message or code for the same field is kept, but Errors keeps the first.
+	v.AddError("genres", "must not contain drama")
+	v.AddError("genres", "must not contain drama")
+	v.AddErrorCode("genres", "max_items", map[string]any{"max": 5})
+	// The same code for another field is kept too.
+	v.AddErrorCode("genres[1]", "unique", nil)
+
+	want := []string{"genres:unique", "genres:invalid", "genres:max_items", "genres[1]:unique"}
+	if got := codes(v); !slices.Equal(got, want) {
+		t.Errorf("got errors %q; want %q", got, want)
+	}
+
+	wantErrors := map[string]string{
+		"genres":    "must not contain duplicate values",
+		"genres[1]": "must not contain duplicate values",
+	}
+	if !maps.Equal(v.Errors, wantErrors) {
+		t.Errorf("got Errors %q; want %q", v.Errors, wantErrors)
+	}
+
+	// A message given with the error is kept rather than taken from the catalog.
+	v = New()
+	v.AddFieldError(FieldError{Field: "email", Code: "email_taken", Message: "already registered", MessageKey: "email_taken"})
+	if v.Errors["email"] != "already registered" {
+		t.Errorf("got message %q", v.Errors["email"])
+	}
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		parts []any
+		want  string
+	}{
+		{[]any{"title"}, "title"},
+		{[]any{"genres", 2}, "genres[2]"},
+		{[]any{"releases", 0, "country"}, "releases[0].country"},
+		{[]any{"operations", 1, "movie", "genres", 0}, "operations[1].movie.genres[0]"},
+		{[]any{"matrix", 0, 1}, "matrix[0][1]"},
+		{[]any{0, "title"}, "[0].title"},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Path(tt.parts...); got != tt.want {
+			t.Errorf("Path(%v) = %q; want %q", tt.parts, got, tt.want)
+		}
+	}
+}
+
+func TestLocalized(t *testing.T) {
+	v := New()
+	v.Apply("title", Required(""))
+	v.Apply("title", MaxLength("", -1))
+	v.Apply("genres", NoDuplicates([]string{"drama", "drama"}), MaxItems([]string{"drama", "drama"}, 1))
+	v.AddError("year", "must be a year")
+
+	// Every error is translated, and free-form messages are left as they are.
+	wantMessages := []string{
+		"title:doit être renseigné",
+		"title:ne doit pas dépasser -1 octets",
+		"genres:ne doit pas contenir de doublons",
+		"genres:ne doit pas contenir plus de 1 éléments",
+		"year:must be a year",
+	}
+
+	var got []string
+	for _, e := range v.Localized("fr") {
+		got = append(got, e.Field+":"+e.Message)
+	}
+	if !slices.Equal(got, wantMessages) {
+		t.Errorf("got %q; want %q", got, wantMessages)
+	}
+
+	// Localizing doesn't change the validator's own English messages.
+	if v.FieldErrors[0].Message != "must be provided" {
+		t.Errorf("got message %q after localizing", v.FieldErrors[0].Message)
+	}
+
+	// LocalizedErrors holds the first message for each field, like Errors.
+	wantErrors := map[string]string{
+		"title":  "doit être renseigné",
+		"genres": "ne doit pas contenir de doublons",
+		"year":   "must be a year",
+	}
+	if got := v.LocalizedErrors("fr"); !maps.Equal(got, wantErrors) {
+		t.Errorf("got LocalizedErrors %q; want %q", got, wantErrors)
+	}
+
+	// Unsupported locales fall back to English.
+	if got := v.LocalizedErrors("de"); !maps.Equal(got, v.Errors) {
+		t.Errorf("got LocalizedErrors %q; want %q", got, v.Errors)
+	}
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    format text NOT NULL,
+    mode text NOT NULL,
+    dry_run bool NOT NULL,
+    status text NOT NULL,
+    report jsonb NOT NULL DEFAULT '{}',
+    error text NOT NULL DEFAULT ''
+);
@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code IN ('movies:submit', 'movies:moderate');
+DROP INDEX IF EXISTS movies_status_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS submitted_by;
+ALTER TABLE movies DROP COLUMN IF EXISTS status_reason;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_status_check;
+ALTER TABLE movies DROP COLUMN IF EXISTS status;
\ No newline at end of file
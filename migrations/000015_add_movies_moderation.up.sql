@@ -0,0 +1,9 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'published';
+ALTER TABLE movies ADD CONSTRAINT movies_status_check CHECK (status IN ('draft', 'pending', 'published', 'rejected'));
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS status_reason text NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS submitted_by bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS movies_status_idx ON movies (status);
+
+INSERT INTO permissions (code)
+VALUES ('movies:submit'), ('movies:moderate');
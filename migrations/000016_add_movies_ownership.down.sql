@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'movies:write:own';
+DROP INDEX IF EXISTS movies_created_by_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE movies DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE movies DROP COLUMN IF EXISTS created_by;
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES users ON DELETE SET NULL;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS updated_by bigint REFERENCES users ON DELETE SET NULL;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+-- Existing movies were last changed at an unknown time, so start from their creation time.
+UPDATE movies SET updated_at = created_at;
+
+CREATE INDEX IF NOT EXISTS movies_created_by_idx ON movies (created_by);
+
+INSERT INTO permissions (code)
+VALUES ('movies:write:own');
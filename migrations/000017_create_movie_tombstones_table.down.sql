@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS movies_updated_at_idx;
+DROP TABLE IF EXISTS movie_tombstones;
\ No newline at end of file
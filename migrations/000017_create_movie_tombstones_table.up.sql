@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS movie_tombstones (
+    movie_id bigint PRIMARY KEY,
+    deleted_at timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_tombstones_deleted_at_idx ON movie_tombstones (deleted_at, movie_id);
+CREATE INDEX IF NOT EXISTS movies_updated_at_idx ON movies (updated_at, id);
@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'stats:read';
+DROP MATERIALIZED VIEW IF EXISTS movie_stats_by_month;
+DROP MATERIALIZED VIEW IF EXISTS movie_stats_by_year;
+DROP MATERIALIZED VIEW IF EXISTS movie_stats_by_genre;
\ No newline at end of file
@@ -0,0 +1,25 @@
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats_by_genre AS
+SELECT genre, count(*) AS movies, sum(runtime) AS total_runtime, NOW() AS refreshed_at
+FROM movies CROSS JOIN LATERAL unnest(genres) AS genre
+WHERE deleted_at IS NULL AND status = 'published'
+GROUP BY genre;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats_by_year AS
+SELECT year, count(*) AS movies, sum(runtime) AS total_runtime, NOW() AS refreshed_at
+FROM movies
+WHERE deleted_at IS NULL AND status = 'published'
+GROUP BY year;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats_by_month AS
+SELECT date_trunc('month', created_at) AS month, count(*) AS movies, sum(runtime) AS total_runtime, NOW() AS refreshed_at
+FROM movies
+WHERE deleted_at IS NULL AND status = 'published'
+GROUP BY month;
+
+-- Unique indexes allow the views to be refreshed concurrently, without blocking reads.
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_by_genre_idx ON movie_stats_by_genre (genre);
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_by_year_idx ON movie_stats_by_year (year);
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_by_month_idx ON movie_stats_by_month (month);
+
+INSERT INTO permissions (code)
+VALUES ('stats:read');